@@ -95,6 +95,15 @@ func TestTmpDir() string {
 	return os.TempDir()
 }
 
+// TestUndeclaredOutputsDir returns the path of the directory where Bazel collects undeclared test outputs.
+// If TEST_UNDECLARED_OUTPUTS_DIR is not defined, it returns TestTmpDir().
+func TestUndeclaredOutputsDir() string {
+	if dir, ok := os.LookupEnv("TEST_UNDECLARED_OUTPUTS_DIR"); ok {
+		return dir
+	}
+	return TestTmpDir()
+}
+
 // TestWorkspace returns the name of the Bazel workspace for this test.
 // If TEST_WORKSPACE is not defined, it returns DefaultWorkspace.
 func TestWorkspace() string {
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/bazel"
 )
@@ -132,3 +133,26 @@ func (s *SampleExtension2) Merge(other Extension) (Extension, error) {
 func (s *SampleExtension2) Normalize() error {
 	return nil
 }
+
+func TestDuration(t *testing.T) {
+	for _, tc := range []struct {
+		value   interface{}
+		want    time.Duration
+		wantErr bool
+	}{
+		{float64(90), 90 * time.Second, false},
+		{0.5, 500 * time.Millisecond, false},
+		{"1m30s", 90 * time.Second, false},
+		{"soon", 0, true},
+		{true, 0, true},
+	} {
+		got, err := Duration(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Duration(%#v) got error %v, want error %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Duration(%#v) got %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
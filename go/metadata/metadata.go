@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/httphelper"
 	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
@@ -270,3 +271,16 @@ func (m *Metadata) ExtensionMap() (map[string]interface{}, bool) {
 
 	return map[string]interface{}(*ext), true
 }
+
+// Duration converts an extension value that is either a number of seconds or a duration string
+// (e.g. "90s") into a time.Duration.
+func Duration(v interface{}) (time.Duration, error) {
+	switch t := v.(type) {
+	case float64:
+		return time.Duration(t * float64(time.Second)), nil
+	case string:
+		return time.ParseDuration(t)
+	default:
+		return 0, fmt.Errorf("%#v is not a number or string", v)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import "strings"
+
+// windowCommands are the commands that can follow /window that are not window handles.
+var windowCommands = map[string]bool{
+	"current":    true,
+	"fullscreen": true,
+	"handles":    true,
+	"maximize":   true,
+	"minimize":   true,
+	"new":        true,
+	"position":   true,
+	"rect":       true,
+	"size":       true,
+}
+
+// CommandEndpoint returns a label for a WebDriver session command suitable for use in metrics.
+// command is the path of the command relative to the session (e.g. ["element", "abc", "click"]).
+// Element ids, window handles, and other values are replaced with placeholders so that the
+// number of distinct labels is bounded, e.g. "/session/{sessionId}/element/{elementId}/click".
+func CommandEndpoint(command []string) string {
+	tokens := []string{"", "session", "{sessionId}"}
+
+	for i := 0; i < len(command); i++ {
+		token := command[i]
+		tokens = append(tokens, token)
+		if i+1 == len(command) {
+			break
+		}
+		next := command[i+1]
+		placeholder := ""
+		switch token {
+		case "element":
+			if next != "active" {
+				placeholder = "{elementId}"
+			}
+		case "shadow":
+			placeholder = "{shadowId}"
+		case "equals":
+			placeholder = "{otherId}"
+		case "attribute", "cookie", "css", "property":
+			placeholder = "{name}"
+		case "window":
+			if !windowCommands[next] {
+				placeholder = "{windowHandle}"
+			}
+		}
+		if placeholder != "" {
+			tokens = append(tokens, placeholder)
+			i++
+		}
+	}
+
+	return strings.Join(tokens, "/")
+}
@@ -0,0 +1,344 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides counters and histograms that can be exported in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/httphelper"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// DefaultRegistry is the Registry used by NewCounter, NewHistogram, and Handler.
+var DefaultRegistry = NewRegistry()
+
+// NewCounter returns the counter in DefaultRegistry with the given name, creating it if necessary.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// NewHistogram returns the histogram in DefaultRegistry with the given name, creating it if necessary.
+// If buckets is nil, DefBuckets is used.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// Handler returns an http.Handler that serves the metrics in DefaultRegistry.
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+// A Registry is a set of named metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+type family interface {
+	desc() *desc
+	write(w io.Writer)
+}
+
+// NewRegistry creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]family{}}
+}
+
+// NewCounter returns the counter in r with the given name, creating it if necessary. It panics if
+// a metric with the same name but a different type, help text, or labels already exists.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		d:      desc{name: name, help: help, kind: "counter", labels: labels},
+		values: map[string]*counterValue{},
+	}
+	return r.register(c).(*Counter)
+}
+
+// NewHistogram returns the histogram in r with the given name, creating it if necessary. It panics if
+// a metric with the same name but a different type, help text, or labels already exists. If buckets is nil,
+// DefBuckets is used.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{
+		d:       desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  map[string]*histogramValue{},
+	}
+	return r.register(h).(*Histogram)
+}
+
+func (r *Registry) register(f family) family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := f.desc()
+	if existing, ok := r.families[d.name]; ok {
+		if e := existing.desc(); !e.compatible(d) {
+			panic(fmt.Sprintf("metric %q is already registered as a %s with labels %v and help %q", d.name, e.kind, e.labels, e.help))
+		}
+		return existing
+	}
+	r.families[d.name] = f
+	return f
+}
+
+// WriteText writes all metrics in r to w in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	var families []family
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].desc().name < families[j].desc().name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		d := f.desc()
+		fmt.Fprintf(bw, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", d.name, d.kind)
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in r in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	httphelper.SetDefaultResponseHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+	r.WriteText(w)
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) compatible(o *desc) bool {
+	if d.kind != o.kind || d.help != o.help || len(d.labels) != len(o.labels) {
+		return false
+	}
+	for i := range d.labels {
+		if d.labels[i] != o.labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %q has labels %v, got %d label values", d.name, d.labels, len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// labelPairs formats the labels for a series, including any extra label (such as le for histogram
+// buckets).
+func (d *desc) labelPairs(labelValues []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, l := range d.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escapeLabelValue(labelValues[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, escapeLabelValue(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// A Counter is a monotonically increasing value, partitioned by label values.
+type Counter struct {
+	d      desc
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc increments the counter for the given label values by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %q cannot be decreased", c.d.name))
+	}
+	key := c.d.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = cv
+	}
+	cv.value += v
+}
+
+// Value returns the current value of the counter for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.d.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cv, ok := c.values[key]; ok {
+		return cv.value
+	}
+	return 0
+}
+
+func (c *Counter) desc() *desc {
+	return &c.d
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		cv := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.d.name, c.d.labelPairs(cv.labelValues, "", ""), formatFloat(cv.value))
+	}
+}
+
+// A Histogram counts observations in configurable buckets, partitioned by label values.
+type Histogram struct {
+	d       desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Observe adds a single observation to the histogram for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.d.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hv
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count returns the number of observations for the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.d.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hv, ok := h.values[key]; ok {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *Histogram) desc() *desc {
+	return &h.d
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.d.name, h.d.labelPairs(hv.labelValues, "le", formatFloat(upper)), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.d.name, h.d.labelPairs(hv.labelValues, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.d.name, h.d.labelPairs(hv.labelValues, "", ""), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.d.name, h.d.labelPairs(hv.labelValues, "", ""), hv.count)
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]*counterValue:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramValue:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
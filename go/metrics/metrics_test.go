@@ -0,0 +1,141 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounter("test_requests_total", "Total requests.", "method")
+	c.Inc("GET")
+	c.Inc("GET")
+	c.Add(3, `PO"ST`)
+
+	h := r.NewHistogram("test_latency_seconds", "Request latency.", []float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 2.55
+test_latency_seconds_count 3
+# HELP test_requests_total Total requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET"} 2
+test_requests_total{method="PO\"ST"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNewCounterReturnsExisting(t *testing.T) {
+	r := NewRegistry()
+
+	c1 := r.NewCounter("test_total", "help", "a")
+	c2 := r.NewCounter("test_total", "help", "a")
+	if c1 != c2 {
+		t.Error("Got different counters for the same name, want the same counter")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Got no panic registering a histogram with a counter's name, want panic")
+		}
+	}()
+	r.NewHistogram("test_total", "help", nil, "a")
+}
+
+func TestHelpMismatch(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "help", "a")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Got no panic registering a counter with different help text, want panic")
+		}
+	}()
+	r.NewCounter("test_total", "other help", "a")
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	c := NewRegistry().NewCounter("test_total", "help", "a", "b")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Got no panic with wrong number of label values, want panic")
+		}
+	}()
+	c.Inc("a")
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "help").Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Got Content-Type %q, want text/plain; version=0.0.4", ct)
+	}
+	if !strings.Contains(w.Body.String(), "test_total 1\n") {
+		t.Errorf("Got body %q, want it to contain test_total 1", w.Body.String())
+	}
+}
+
+func TestCommandEndpoint(t *testing.T) {
+	testCases := []struct {
+		command []string
+		want    string
+	}{
+		{nil, "/session/{sessionId}"},
+		{[]string{"url"}, "/session/{sessionId}/url"},
+		{[]string{"element"}, "/session/{sessionId}/element"},
+		{[]string{"element", "active"}, "/session/{sessionId}/element/active"},
+		{[]string{"element", "abc-123", "click"}, "/session/{sessionId}/element/{elementId}/click"},
+		{[]string{"element", "abc", "attribute", "href"}, "/session/{sessionId}/element/{elementId}/attribute/{name}"},
+		{[]string{"element", "abc", "element"}, "/session/{sessionId}/element/{elementId}/element"},
+		{[]string{"cookie", "SID"}, "/session/{sessionId}/cookie/{name}"},
+		{[]string{"window", "rect"}, "/session/{sessionId}/window/rect"},
+		{[]string{"window", "CDwindow-1", "size"}, "/session/{sessionId}/window/{windowHandle}/size"},
+		{[]string{"shadow", "xyz", "element"}, "/session/{sessionId}/shadow/{shadowId}/element"},
+	}
+
+	for _, tc := range testCases {
+		if got := CommandEndpoint(tc.command); got != tc.want {
+			t.Errorf("CommandEndpoint(%v) got %q, want %q", tc.command, got, tc.want)
+		}
+	}
+}
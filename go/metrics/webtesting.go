@@ -0,0 +1,35 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+// Metrics reported by both WTL and WSL. They are defined once here so that both export them with
+// the same help text and labels.
+var (
+	// SessionsCreated counts WebDriver sessions successfully created, by browser.
+	SessionsCreated = NewCounter("webtesting_sessions_created_total",
+		"Number of WebDriver sessions successfully created, by browser.", "browser")
+	// SessionsFailed counts new session requests that failed, by browser.
+	SessionsFailed = NewCounter("webtesting_sessions_failed_total",
+		"Number of new session requests that failed, by browser.", "browser")
+	// CommandLatency is the latency of WebDriver commands, by method and endpoint.
+	CommandLatency = NewHistogram("webtesting_command_duration_seconds",
+		"Latency of WebDriver commands, by method and endpoint.", nil, "method", "endpoint")
+	// DriverStarts counts driver processes started, by driver.
+	DriverStarts = NewCounter("webtesting_driver_starts_total",
+		"Number of driver processes started, by driver.", "driver")
+	// DriverCrashes counts driver processes that exited unexpectedly, by driver.
+	DriverCrashes = NewCounter("webtesting_driver_crashes_total",
+		"Number of driver processes that exited unexpectedly, by driver.", "driver")
+)
@@ -21,15 +21,32 @@ import (
 	"net"
 	"strconv"
 	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 )
 
 var (
 	mu           sync.Mutex
 	claimedPorts = map[int]bool{}
+
+	allocations = metrics.NewCounter("webtesting_port_allocations_total",
+		"Number of PickUnusedPort calls, by result (allocated or failed).", "result")
+	recycled = metrics.NewCounter("webtesting_ports_recycled_total",
+		"Number of ports returned by RecycleUnusedPort.")
 )
 
 // PickUnusedPort picks an unused TCP port.
 func PickUnusedPort() (int, error) {
+	port, err := pickUnusedPort()
+	if err != nil {
+		allocations.Inc("failed")
+	} else {
+		allocations.Inc("allocated")
+	}
+	return port, err
+}
+
+func pickUnusedPort() (int, error) {
 	mu.Lock()
 	defer mu.Unlock()
 	var listeners []io.Closer
@@ -68,6 +85,7 @@ func PickUnusedPort() (int, error) {
 func RecycleUnusedPort(port int) error {
 	mu.Lock()
 	defer mu.Unlock()
+	recycled.Inc()
 	delete(claimedPorts, port)
 	return nil
 }
@@ -0,0 +1,144 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Forward proxies the WebSocket upgrade request r to target, a ws or wss URL, and then copies
+// data in both directions until either side closes its connection. Frames are passed through
+// unchanged. If target does not accept the upgrade, its response is written to w.
+func Forward(ctx context.Context, target *url.URL, w http.ResponseWriter, r *http.Request) error {
+	if !IsUpgrade(r) {
+		http.Error(w, "expected a WebSocket upgrade request", http.StatusBadRequest)
+		return errors.New("not a WebSocket upgrade request")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be hijacked", http.StatusInternalServerError)
+		return errors.New("connection cannot be hijacked")
+	}
+
+	backend, err := dialTarget(ctx, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return err
+	}
+	defer backend.Close()
+
+	out := r.Clone(ctx)
+	out.URL = &url.URL{Path: target.Path, RawQuery: target.RawQuery}
+	if out.URL.RawQuery == "" {
+		out.URL.RawQuery = r.URL.RawQuery
+	}
+	out.Host = target.Host
+	out.RequestURI = ""
+	// Remote ends such as Chrome reject WebSocket connections from unexpected origins. The
+	// connection is made by WTL, not by a page, so the client's origin does not apply.
+	out.Header.Del("Origin")
+	if err := out.Write(backend); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return err
+	}
+
+	br := bufio.NewReader(backend)
+	resp, err := http.ReadResponse(br, out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		for k, vs := range resp.Header {
+			w.Header()[k] = vs
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return fmt.Errorf("%s refused WebSocket upgrade with status %q", target, resp.Status)
+	}
+
+	client, brw, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, err := fmt.Fprintf(client, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(client); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(client, "\r\n"); err != nil {
+		return err
+	}
+
+	// Closing both connections when either direction finishes unblocks the other.
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(backend, brw.Reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, br)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func dialTarget(ctx context.Context, target *url.URL) (net.Conn, error) {
+	host, port := target.Hostname(), target.Port()
+	switch target.Scheme {
+	case "ws":
+		if port == "" {
+			port = "80"
+		}
+	case "wss":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a WebSocket URL", target)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "wss" {
+		// Remote ends commonly use self-signed certificates, as httphelper.Forward also allows.
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
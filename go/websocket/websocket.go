@@ -0,0 +1,294 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket provides a minimal server-side implementation of the WebSocket protocol
+// (RFC 6455), sufficient for serving browser-based tools from WTL, and a pass-through proxy for
+// WebSocket connections to remote ends.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Message types, as defined in RFC 6455 section 5.2.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+
+	continuationFrame = 0
+	closeMessage      = 8
+	pingMessage       = 9
+	pongMessage       = 10
+)
+
+// maxMessageSize is the largest message that will be read.
+const maxMessageSize = 32 << 20
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Conn is a WebSocket connection.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// Whether frames sent by this end must be masked, i.e. this is the client end.
+	client bool
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// IsUpgrade returns true if r is a request to upgrade to the WebSocket protocol.
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade upgrades the HTTP server connection to the WebSocket protocol. If the upgrade fails, an
+// HTTP error response has already been sent.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		http.Error(w, "expected a WebSocket upgrade request", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported WebSocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be hijacked", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, br: brw.Reader}, nil
+}
+
+// NewClientConn returns a Conn for the client end of a connection that has already completed the
+// opening handshake. br must buffer reads from conn, if not nil.
+func NewClientConn(conn net.Conn, br *bufio.Reader) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{conn: conn, br: br, client: true}
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// ReadMessage reads the next text or binary message. Ping frames are answered automatically.
+// If the peer closes the connection, ReadMessage replies to the close and returns io.EOF.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var msgType int
+	var msg []byte
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case pingMessage:
+			if err := c.writeFrame(pongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongMessage:
+			continue
+		case closeMessage:
+			c.writeFrame(closeMessage, payload)
+			c.Close()
+			return 0, nil, io.EOF
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, errors.New("websocket: new message started before previous message finished")
+			}
+			msgType = opcode
+		case continuationFrame:
+			if msgType == 0 {
+				return 0, nil, errors.New("websocket: continuation frame without a message")
+			}
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", opcode)
+		}
+
+		if len(msg)+len(payload) > maxMessageSize {
+			return 0, nil, errors.New("websocket: message too large")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msgType, msg, nil
+		}
+	}
+}
+
+// WriteMessage writes data as a single message of type msgType. It is safe to call WriteMessage
+// from multiple goroutines.
+func (c *Conn) WriteMessage(msgType int, data []byte) error {
+	return c.writeFrame(msgType, data)
+}
+
+// Close sends a close frame, if one has not been sent, and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	if !c.closed {
+		c.closed = true
+		c.conn.Write(c.frame(closeMessage, nil))
+	}
+	c.wmu.Unlock()
+	return c.conn.Close()
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, errors.New("websocket: frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return errors.New("websocket: connection closed")
+	}
+	if opcode == closeMessage {
+		c.closed = true
+	}
+	_, err := c.conn.Write(c.frame(opcode, payload))
+	return err
+}
+
+func (c *Conn) frame(opcode int, payload []byte) []byte {
+	frame := []byte{0x80 | byte(opcode)}
+
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], uint16(n))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(n))
+	}
+
+	if !c.client {
+		return append(frame, payload...)
+	}
+
+	// The mask only needs to be unpredictable to defeat cache poisoning by intermediaries,
+	// which does not apply to the connections WTL makes, so a fixed mask is used.
+	mask := [4]byte{0x5a, 0x3c, 0xa5, 0xc3}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
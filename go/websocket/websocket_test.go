@@ -0,0 +1,178 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func dial(t *testing.T, addr string) *Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", addr)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	if got, want := resp.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Fatalf("Got Sec-WebSocket-Accept %q, want %q", got, want)
+	}
+	return NewClientConn(conn, br)
+}
+
+func TestEcho(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(msgType, msg)
+		}
+	}))
+	defer server.Close()
+
+	client := dial(t, strings.TrimPrefix(server.URL, "http://"))
+	defer client.Close()
+
+	for _, msg := range []string{"hello", strings.Repeat("x", 200), strings.Repeat("y", 70000)} {
+		if err := client.WriteMessage(TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		msgType, got, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType != TextMessage || string(got) != msg {
+			t.Errorf("Got message type %d of length %d, want text message of length %d", msgType, len(got), len(msg))
+		}
+	}
+
+	if err := client.writeFrame(pingMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.writeFrame(closeMessage, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The pong is consumed by ReadMessage, and the server's close ends the stream.
+	if _, _, err := client.ReadMessage(); err != io.EOF {
+		t.Errorf("Got error %v after close, want io.EOF", err)
+	}
+}
+
+func TestForward(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/session/abc" || r.Header.Get("Origin") != "" {
+			http.Error(w, "unexpected request", http.StatusForbidden)
+			return
+		}
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(msgType, append([]byte("echo: "), msg...))
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(strings.Replace(backend.URL, "http://", "ws://", 1) + "/session/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Origin", "http://example.com")
+		Forward(r.Context(), target, w, r)
+	}))
+	defer front.Close()
+
+	client := dial(t, strings.TrimPrefix(front.URL, "http://"))
+	defer client.Close()
+
+	if err := client.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "echo: hello" {
+		t.Errorf("Got message %q, want %q", got, "echo: hello")
+	}
+}
+
+// hijackableRecorder is a ResponseRecorder that claims to support hijacking.
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("not hijackable")
+}
+
+func TestForwardRefused(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	target, err := url.Parse(strings.Replace(backend.URL, "http://", "ws://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w := hijackableRecorder{httptest.NewRecorder()}
+
+	if err := Forward(r.Context(), target, w, r); err == nil {
+		t.Error("Got nil error, want error")
+	}
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	if _, err := Upgrade(w, httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+		t.Error("Got nil error, want error")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
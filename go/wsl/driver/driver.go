@@ -26,14 +26,17 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/cmdhelper"
 	"github.com/bazelbuild/rules_webtesting/go/httphelper"
 	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 	"github.com/bazelbuild/rules_webtesting/go/webdriver"
 )
 
@@ -46,6 +49,8 @@ type Driver struct {
 	stopped      chan error
 	cmd          *exec.Cmd
 	portRecycler PortRecycler
+	// Set to non-zero when Shutdown is called, so that exits can be distinguished from crashes.
+	stopping int32
 
 	// Mutex to prevent overlapping commands to remote end.
 	mu sync.Mutex
@@ -341,10 +346,16 @@ func (d *Driver) startDriver() (chan error, error) {
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
+	driverName := filepath.Base(d.caps.binary)
+	metrics.DriverStarts.Inc(driverName)
 
 	go func() {
 		err := cmd.Wait()
 
+		if atomic.LoadInt32(&d.stopping) == 0 {
+			metrics.DriverCrashes.Inc(driverName)
+		}
+
 		if err := d.portRecycler.RecyclePorts(); err != nil {
 			log.Printf("Error cleaning up used ports: %v", err)
 		}
@@ -472,6 +483,7 @@ func (d *Driver) Quit(w http.ResponseWriter, r *http.Request) {
 
 // Shutdown shuts down a running WebDriver server.
 func (d *Driver) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&d.stopping, 1)
 	if d.cmd == nil {
 		close(d.stopped)
 		return nil
@@ -30,6 +30,7 @@ import (
 
 	"github.com/bazelbuild/rules_webtesting/go/httphelper"
 	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 	"github.com/bazelbuild/rules_webtesting/go/wsl/driver"
 	"github.com/bazelbuild/rules_webtesting/go/wsl/resolver"
 )
@@ -87,7 +88,9 @@ func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	start := time.Now()
 	driver.Forward(r.Context(), w, r)
+	metrics.CommandLatency.Observe(time.Since(start).Seconds(), r.Method, metrics.CommandEndpoint(path[2:]))
 }
 
 func (h *Hub) driver(session string) *driver.Driver {
@@ -100,23 +103,33 @@ func (h *Hub) newSession(w http.ResponseWriter, r *http.Request) {
 	reqJSON := map[string]interface{}{}
 
 	if err := json.NewDecoder(r.Body).Decode(&reqJSON); err != nil {
+		metrics.SessionsFailed.Inc("unknown")
 		errorResponse(w, http.StatusBadRequest, 13, "invalid argument", err.Error())
 		return
 	}
 
 	caps, err := capabilities.FromNewSessionArgs(reqJSON)
 	if err != nil {
+		metrics.SessionsFailed.Inc("unknown")
 		errorResponse(w, http.StatusBadRequest, 13, "invalid argument", err.Error())
 		return
 	}
 
+	browser := "unknown"
+	if bn, ok := caps.AlwaysMatch["browserName"].(string); ok && bn != "" {
+		browser = bn
+	}
+
 	session, driver, err := h.newSessionFromCaps(r.Context(), caps, w)
 	if err != nil {
+		metrics.SessionsFailed.Inc(browser)
 		errorResponse(w, http.StatusInternalServerError, 33, "session not created", fmt.Sprintf("unable to create session: %v", err))
 		log.Printf("Error creating webdriver session: %v", err)
 		return
 	}
 
+	metrics.SessionsCreated.Inc(browser)
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.sessions[session] = driver
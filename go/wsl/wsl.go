@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/httphelper"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 	"github.com/bazelbuild/rules_webtesting/go/wsl/hub"
 	"github.com/bazelbuild/rules_webtesting/go/wsl/upload"
 )
@@ -89,6 +90,8 @@ func createHandler(hub http.Handler, downloadRoot string, shutdown func()) http.
 		w.Write([]byte("ok"))
 	})
 
+	handler.Handle("/metrics", metrics.Handler())
+
 	handler.Handle("/session", hub)
 	handler.Handle("/session/", hub)
 
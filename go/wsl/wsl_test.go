@@ -35,6 +35,33 @@ func TestHandleHealthz(t *testing.T) {
 	}
 }
 
+func TestHandleMetrics(t *testing.T) {
+	handler := createHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), "", func() {})
+
+	// Allocate a port so that the port allocations metric has a sample.
+	port, err := portpicker.PickUnusedPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer portpicker.RecycleUnusedPort(port)
+
+	w := newFakeResponseWriter()
+	r, err := http.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(w, r)
+
+	if w.status != http.StatusOK {
+		t.Errorf(`Got status %d, want %d`, w.status, http.StatusOK)
+	}
+
+	if !strings.Contains(string(w.Bytes()), `webtesting_port_allocations_total{result="allocated"}`) {
+		t.Errorf(`Got %q, want to contain port allocations metric`, string(w.Bytes()))
+	}
+}
+
 func TestHandleQuitQuitQuit(t *testing.T) {
 	cancelCalled := 0
 
@@ -0,0 +1,61 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics
+
+import "sync"
+
+// Recorder is a Diagnostics that records the warnings and severe errors reported to it instead of
+// logging them. It is intended for tests.
+type Recorder struct {
+	Diagnostics
+	mu       sync.Mutex
+	warnings []error
+	severe   []error
+}
+
+// NewRecorder creates a new empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{Diagnostics: NoOP()}
+}
+
+// Severe records err.
+func (r *Recorder) Severe(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.severe = append(r.severe, err)
+	return nil
+}
+
+// Warning records err.
+func (r *Recorder) Warning(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, err)
+	return nil
+}
+
+// Warnings returns the warnings reported so far.
+func (r *Recorder) Warnings() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.warnings...)
+}
+
+// SevereErrors returns the severe errors reported so far.
+func (r *Recorder) SevereErrors() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.severe...)
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+)
+
+// options is the set of options common to all vendors that can be defined in a vendor's section
+// of a Metadata.Extension field.
+type options struct {
+	params Params
+	// Overrides Vendor.HubURL.
+	hubURL string
+	// Whether to start the vendor's tunnel. Defaults to false.
+	startTunnel bool
+}
+
+func extractOptions(v *Vendor, m *metadata.Metadata) (options, error) {
+	var opts options
+
+	vMap := map[string]interface{}{}
+	if extMap, ok := m.ExtensionMap(); ok {
+		if o, ok := extMap[v.OptionsKey]; ok {
+			om, ok := o.(map[string]interface{})
+			if !ok {
+				return opts, fmt.Errorf("%s %#v is not an object", v.OptionsKey, o)
+			}
+			vMap = om
+		}
+	}
+	opts.params.Options = vMap
+
+	if v.Credentials != nil {
+		creds, err := v.Credentials(vMap)
+		if err != nil {
+			return opts, err
+		}
+		opts.params.Credentials = creds
+	}
+
+	if h, ok := vMap["hubUrl"]; ok {
+		hs, ok := h.(string)
+		if !ok {
+			return opts, fmt.Errorf("%s.hubUrl %#v is not a string", v.OptionsKey, h)
+		}
+		opts.hubURL = hs
+	}
+
+	if v.TunnelOption != "" {
+		if st, ok := vMap[v.TunnelOption]; ok {
+			stb, ok := st.(bool)
+			if !ok {
+				return opts, fmt.Errorf("%s.%s %#v is not a boolean", v.OptionsKey, v.TunnelOption, st)
+			}
+			opts.startTunnel = stb
+		}
+	}
+
+	tunnelID := ""
+	if v.TunnelIDEnvVar != "" {
+		tunnelID = os.Getenv(v.TunnelIDEnvVar)
+	}
+	if tid, ok := vMap["tunnelId"]; ok {
+		tids, ok := tid.(string)
+		if !ok {
+			return opts, fmt.Errorf("%s.tunnelId %#v is not a string", v.OptionsKey, tid)
+		}
+		tunnelID = tids
+	} else if opts.startTunnel && v.DefaultTunnelID != "" {
+		tunnelID = v.DefaultTunnelID
+	}
+
+	if strings.Contains(tunnelID, "%d") {
+		r, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return opts, err
+		}
+		tunnelID = fmt.Sprintf(tunnelID, r)
+	}
+	opts.params.TunnelID = tunnelID
+
+	if v.ValidateOptions != nil {
+		if err := v.ValidateOptions(vMap); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+// EnvCredentials returns a CredentialSource that uses the username and accessKey options, or if
+// they are not defined, the environment variables usernameVar and accessKeyVar.
+func EnvCredentials(usernameVar, accessKeyVar string) CredentialSource {
+	return func(options map[string]interface{}) (Credentials, error) {
+		creds := Credentials{
+			Username:  os.Getenv(usernameVar),
+			AccessKey: os.Getenv(accessKeyVar),
+		}
+		if u, ok := options["username"]; ok {
+			us, ok := u.(string)
+			if !ok {
+				return creds, fmt.Errorf("username %#v is not a string", u)
+			}
+			creds.Username = us
+		}
+		if ak, ok := options["accessKey"]; ok {
+			aks, ok := ak.(string)
+			if !ok {
+				return creds, fmt.Errorf("accessKey %#v is not a string", ak)
+			}
+			creds.AccessKey = aks
+		}
+		return creds, nil
+	}
+}
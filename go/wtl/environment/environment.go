@@ -49,6 +49,44 @@ type Env interface {
 	WDAddress(context.Context) string
 }
 
+// Selector is implemented by Envs that manage several browser environments, each with its own
+// WebDriver server.
+type Selector interface {
+	// Select returns the Env that should be used for a new session requested with caps. The
+	// returned Env's StartSession, StopSession, and WDAddress are used for that session.
+	Select(caps *capabilities.Capabilities) (Env, error)
+}
+
+// SessionObserver is implemented by Envs that need to know the WebDriver session ID of each session
+// started in them, e.g. to look the session up in a remote service.
+type SessionObserver interface {
+	// SessionCreated is called after the WebDriver server has created the session with the given
+	// id, which was passed to StartSession, and WebDriver session ID.
+	SessionCreated(ctx context.Context, id int, sessionID string)
+}
+
+// NotifySessionCreated calls e.SessionCreated if e is a SessionObserver.
+func NotifySessionCreated(ctx context.Context, e Env, id int, sessionID string) {
+	if o, ok := e.(SessionObserver); ok {
+		o.SessionCreated(ctx, id, sessionID)
+	}
+}
+
+// TestObserver is implemented by Envs that need to know the outcome of the test, e.g. to report it
+// to a remote service.
+type TestObserver interface {
+	// TestFinished is called with the exit status of the test after it has finished, before the
+	// environment is torn down.
+	TestFinished(ctx context.Context, exitStatus int)
+}
+
+// NotifyTestFinished calls e.TestFinished if e is a TestObserver.
+func NotifyTestFinished(ctx context.Context, e Env, exitStatus int) {
+	if o, ok := e.(TestObserver); ok {
+		o.TestFinished(ctx, exitStatus)
+	}
+}
+
 // Base is a partial implementation of Env useful as the base struct for
 // implementations of Env.
 type Base struct {
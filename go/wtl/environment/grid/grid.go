@@ -0,0 +1,360 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grid provides an environment for running browsers on a Selenium Grid 4 at
+// SELENIUM_GRID_ADDRESS. It polls the grid's /status endpoint to learn which nodes have free
+// slots: the environment is not healthy until a node matching the browser's capabilities has had
+// a free slot, and new sessions wait until a matching slot is free. Each new session reserves its
+// slot until the session is created, so that concurrent sessions do not wait for the same slot.
+// The node that serves each
+// session is reported as timing data that covers the wait for a slot and session creation.
+//
+// It is configured by the gridOptions section of a Metadata.Extension field, e.g.:
+//
+//	"gridOptions": {
+//	  "address": "http://grid.example.com:4444",
+//	  "pollInterval": "500ms",
+//	  "capacityTimeout": 600
+//	}
+package grid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/httphelper"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+const (
+	name          = "Selenium Grid Environment"
+	addressEnvVar = "SELENIUM_GRID_ADDRESS"
+
+	defaultPollInterval    = time.Second
+	defaultCapacityTimeout = 5 * time.Minute
+)
+
+type grid struct {
+	*environment.Base
+	opts gridOptions
+
+	stopPolling context.CancelFunc
+	pollingDone chan struct{}
+
+	mu          sync.Mutex
+	status      *status
+	statusErr   error
+	updated     chan struct{}
+	hadCapacity bool
+	// pending counts the slots reserved by sessions that are starting, by slot stereotype.
+	pending      map[string]int
+	reservations map[int]reservation
+}
+
+// reservation is a slot reserved by a session that is starting.
+type reservation struct {
+	stereotype string
+	start      time.Time
+}
+
+// NewEnv creates a new environment that runs browsers on a Selenium Grid.
+func NewEnv(m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error) {
+	opts, err := extractOptions(m)
+	if err != nil {
+		return nil, errors.New(name, err)
+	}
+	if opts.address == "" {
+		return nil, errors.New(name, fmt.Errorf("gridOptions.address is not defined and environment variable %q is not set", addressEnvVar))
+	}
+
+	base, err := environment.NewBase(name, m, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grid{
+		Base:         base,
+		opts:         opts,
+		updated:      make(chan struct{}),
+		pending:      map[string]int{},
+		reservations: map[int]reservation{},
+	}, nil
+}
+
+// SetUp starts polling the grid's status.
+func (g *grid) SetUp(ctx context.Context) error {
+	if err := g.Base.SetUp(ctx); err != nil {
+		return err
+	}
+
+	pollCtx, cancel := context.WithCancel(context.Background())
+	g.stopPolling = cancel
+	g.pollingDone = make(chan struct{})
+	go func() {
+		defer close(g.pollingDone)
+		for {
+			g.poll(pollCtx)
+			select {
+			case <-pollCtx.Done():
+				return
+			case <-time.After(g.opts.pollInterval):
+			}
+		}
+	}()
+	return nil
+}
+
+// TearDown stops polling the grid's status.
+func (g *grid) TearDown(ctx context.Context) error {
+	if err := g.Base.TearDown(ctx); err != nil {
+		return err
+	}
+	g.stopPolling()
+	<-g.pollingDone
+	return nil
+}
+
+// Healthy returns nil once a node matching the browser's capabilities has had a free slot, as
+// long as the grid is ready and such a node is still available.
+func (g *grid) Healthy(ctx context.Context) error {
+	if err := g.Base.Healthy(ctx); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.statusErr != nil {
+		return errors.New(g.Name(), fmt.Errorf("error getting grid status: %v", g.statusErr))
+	}
+	if g.status == nil {
+		return errors.New(g.Name(), "waiting for grid status")
+	}
+	if !g.status.Value.Ready {
+		return errors.New(g.Name(), fmt.Sprintf("grid is not ready: %s", g.status.Value.Message))
+	}
+	if !g.hadCapacity {
+		return errors.New(g.Name(), fmt.Sprintf("waiting for a free slot on a node matching %s", describe(g.Metadata.Capabilities)))
+	}
+	if _, ok := g.status.findSlot([]map[string]interface{}{g.Metadata.Capabilities}, false); !ok {
+		return errors.New(g.Name(), fmt.Sprintf("no available node matches %s", describe(g.Metadata.Capabilities)))
+	}
+	return nil
+}
+
+// StartSession waits, for up to gridOptions.capacityTimeout, until a node matching the session's
+// capabilities has a free slot that is not reserved by another starting session, and reserves it.
+func (g *grid) StartSession(ctx context.Context, id int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	start := time.Now()
+	updated, err := g.Base.StartSession(ctx, id, caps)
+	if err != nil {
+		return nil, err
+	}
+	candidates := candidateCaps(updated)
+
+	waitCtx, cancel := context.WithTimeout(ctx, g.opts.capacityTimeout)
+	defer cancel()
+	for {
+		g.mu.Lock()
+		reserved := g.reserve(id, candidates, start)
+		ch := g.updated
+		g.mu.Unlock()
+
+		if reserved {
+			return updated, nil
+		}
+		select {
+		case <-ch:
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, errors.New(g.Name(), ctx.Err())
+			}
+			return nil, errors.New(g.Name(), fmt.Sprintf("no node matching %s had a free slot within %v", describe(candidates[0]), g.opts.capacityTimeout))
+		}
+	}
+}
+
+// reserve reserves a free slot matching candidates for session id if one is not already reserved
+// by another starting session. g.mu must be held.
+func (g *grid) reserve(id int, candidates []map[string]interface{}, start time.Time) bool {
+	if g.status == nil {
+		return false
+	}
+	free := g.status.freeSlots(candidates)
+	var stereotypes []string
+	for st := range free {
+		stereotypes = append(stereotypes, st)
+	}
+	sort.Strings(stereotypes)
+	for _, st := range stereotypes {
+		if free[st] > g.pending[st] {
+			g.pending[st]++
+			g.reservations[id] = reservation{stereotype: st, start: start}
+			return true
+		}
+	}
+	return false
+}
+
+// release releases the slot reserved by session id, if any, and returns when it was reserved.
+func (g *grid) release(id int) (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r, ok := g.reservations[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	delete(g.reservations, id)
+	g.pending[r.stereotype]--
+	if g.pending[r.stereotype] == 0 {
+		delete(g.pending, r.stereotype)
+	}
+	return r.start, true
+}
+
+// SessionCreated reports the node that is serving the session and releases its reserved slot,
+// which the grid now reports as in use.
+func (g *grid) SessionCreated(ctx context.Context, id int, sessionID string) {
+	end := time.Now()
+
+	node := "unknown node"
+	s, err := g.poll(ctx)
+	start, ok := g.release(id)
+	if !ok {
+		start = end
+	}
+	if err == nil {
+		if n, ok := s.nodeForSession(sessionID); ok {
+			node = fmt.Sprintf("node %s (%s)", n.URI, n.ID)
+		}
+	}
+
+	if err := g.Timing(g.Name(), "grid session", fmt.Sprintf("session %s (WTL session %d) on %s", sessionID, id, node), start, end); err != nil {
+		g.Warning(err)
+	}
+}
+
+// StopSession releases the session's reserved slot if the session was never created.
+func (g *grid) StopSession(ctx context.Context, id int) error {
+	g.release(id)
+	return g.Base.StopSession(ctx, id)
+}
+
+// WDAddress returns the grid's address.
+func (g *grid) WDAddress(context.Context) string {
+	return g.opts.address
+}
+
+// poll gets the grid's status, records it, and wakes anything waiting for a status update.
+func (g *grid) poll(ctx context.Context) (*status, error) {
+	s, err := g.getStatus(ctx)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status, g.statusErr = s, err
+	if err == nil && s.Value.Ready {
+		if _, ok := s.findSlot([]map[string]interface{}{g.Metadata.Capabilities}, true); ok {
+			g.hadCapacity = true
+		}
+	}
+	close(g.updated)
+	g.updated = make(chan struct{})
+	return s, err
+}
+
+func (g *grid) getStatus(ctx context.Context) (*status, error) {
+	url := strings.TrimSuffix(g.opts.address, "/") + "/status"
+	resp, err := httphelper.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	s := &status{}
+	if err := json.NewDecoder(resp.Body).Decode(s); err != nil {
+		return nil, fmt.Errorf("error parsing response from %s: %v", url, err)
+	}
+	return s, nil
+}
+
+// gridOptions is the set of options that can be defined in the gridOptions section of a
+// Metadata.Extension field.
+type gridOptions struct {
+	// The address of the grid. If not defined in Extension, uses the env variable SELENIUM_GRID_ADDRESS.
+	address string
+	// How often to poll the grid's status. Defaults to 1s.
+	pollInterval time.Duration
+	// How long a new session waits for a free slot. Defaults to 5m.
+	capacityTimeout time.Duration
+}
+
+func extractOptions(m *metadata.Metadata) (gridOptions, error) {
+	opts := gridOptions{
+		address:         os.Getenv(addressEnvVar),
+		pollInterval:    defaultPollInterval,
+		capacityTimeout: defaultCapacityTimeout,
+	}
+
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return opts, nil
+	}
+
+	goMap, ok := extMap["gridOptions"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+
+	if a, ok := goMap["address"]; ok {
+		as, ok := a.(string)
+		if !ok {
+			return opts, fmt.Errorf("gridOptions.address %#v is not a string", a)
+		}
+		opts.address = as
+	}
+
+	if p, ok := goMap["pollInterval"]; ok {
+		d, err := metadata.Duration(p)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("gridOptions.pollInterval %#v is not a positive duration", p)
+		}
+		opts.pollInterval = d
+	}
+
+	if c, ok := goMap["capacityTimeout"]; ok {
+		d, err := metadata.Duration(c)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("gridOptions.capacityTimeout %#v is not a positive duration", c)
+		}
+		opts.capacityTimeout = d
+	}
+
+	return opts, nil
+}
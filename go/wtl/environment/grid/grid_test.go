@@ -0,0 +1,247 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+// fakeGrid serves a /status response with a single node with one Chrome slot.
+type fakeGrid struct {
+	*httptest.Server
+	mu        sync.Mutex
+	ready     bool
+	sessionID string
+}
+
+func newFakeGrid() *fakeGrid {
+	g := &fakeGrid{ready: true}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		var session interface{}
+		if g.sessionID != "" {
+			session = map[string]interface{}{"sessionId": g.sessionID}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"value": map[string]interface{}{
+				"ready":   g.ready,
+				"message": "fake grid",
+				"nodes": []interface{}{
+					map[string]interface{}{
+						"id":           "node-1",
+						"uri":          "http://node-1:5555",
+						"availability": "UP",
+						"slots": []interface{}{
+							map[string]interface{}{
+								"session":    session,
+								"stereotype": map[string]interface{}{"browserName": "chrome", "platformName": "LINUX"},
+							},
+						},
+					},
+				},
+			},
+		})
+	}))
+	return g
+}
+
+func (g *fakeGrid) setSession(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sessionID = id
+}
+
+// timingDiagnostics records the details of timing data reported to it.
+type timingDiagnostics struct {
+	diagnostics.Diagnostics
+	mu      sync.Mutex
+	details []string
+}
+
+func (d *timingDiagnostics) Timing(_, _, detail string, _, _ time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.details = append(d.details, detail)
+	return nil
+}
+
+func newEnv(t *testing.T, g *fakeGrid, browserName string, d diagnostics.Diagnostics) *grid {
+	t.Helper()
+	m, err := metadata.FromBytes([]byte(`{
+		"capabilities": {"browserName": "`+browserName+`"},
+		"extension": {"gridOptions": {"address": "`+g.URL+`", "pollInterval": "10ms", "capacityTimeout": "200ms"}}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := NewEnv(m, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := env.(*grid)
+	if err := e.SetUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.TearDown(context.Background()) })
+	return e
+}
+
+func waitForHealth(e *grid, timeout time.Duration) error {
+	ctx := context.Background()
+	deadline := time.Now().Add(timeout)
+	for {
+		err := e.Healthy(ctx)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForPoll waits until e has polled the grid after any change made before it was called.
+func waitForPoll(e *grid) {
+	for i := 0; i < 2; i++ {
+		e.mu.Lock()
+		ch := e.updated
+		e.mu.Unlock()
+		<-ch
+	}
+}
+
+func TestHealthyWaitsForFreeSlot(t *testing.T) {
+	g := newFakeGrid()
+	defer g.Close()
+	g.setSession("busy")
+
+	e := newEnv(t, g, "chrome", diagnostics.NoOP())
+	if err := waitForHealth(e, 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "free slot") {
+		t.Fatalf("Got %v, want error waiting for a free slot", err)
+	}
+
+	g.setSession("")
+	if err := waitForHealth(e, time.Second); err != nil {
+		t.Errorf("Got %v, want healthy once a slot is free", err)
+	}
+
+	// Once healthy, a busy grid stays healthy; new sessions wait for capacity instead.
+	g.setSession("busy")
+	waitForPoll(e)
+	if err := e.Healthy(context.Background()); err != nil {
+		t.Errorf("Got %v, want healthy while the matching node is busy", err)
+	}
+}
+
+func TestHealthyNoMatchingNode(t *testing.T) {
+	g := newFakeGrid()
+	defer g.Close()
+
+	e := newEnv(t, g, "firefox", diagnostics.NoOP())
+	if err := waitForHealth(e, 100*time.Millisecond); err == nil {
+		t.Error("Got nil, want error when no node runs firefox")
+	}
+}
+
+func TestStartSessionWaitsForCapacity(t *testing.T) {
+	g := newFakeGrid()
+	defer g.Close()
+
+	d := &timingDiagnostics{Diagnostics: diagnostics.NoOP()}
+	e := newEnv(t, g, "chrome", d)
+	if err := waitForHealth(e, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	g.setSession("other")
+	waitForPoll(e)
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{}, W3CSupported: true}
+	if _, err := e.StartSession(context.Background(), 1, caps); err == nil || !strings.Contains(err.Error(), "free slot") {
+		t.Fatalf("Got %v, want error after capacityTimeout", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		g.setSession("")
+	}()
+	if _, err := e.StartSession(context.Background(), 2, caps); err != nil {
+		t.Fatalf("Got %v, want session started once the slot is free", err)
+	}
+
+	g.setSession("abc")
+	e.SessionCreated(context.Background(), 2, "abc")
+	if len(d.details) != 1 || !strings.Contains(d.details[0], "session abc") || !strings.Contains(d.details[0], "http://node-1:5555") {
+		t.Errorf("Got timing details %q, want session abc on node-1", d.details)
+	}
+}
+
+func TestStartSessionReservesSlot(t *testing.T) {
+	g := newFakeGrid()
+	defer g.Close()
+
+	e := newEnv(t, g, "chrome", diagnostics.NoOP())
+	if err := waitForHealth(e, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{}, W3CSupported: true}
+	if _, err := e.StartSession(context.Background(), 1, caps); err != nil {
+		t.Fatal(err)
+	}
+
+	// The grid still reports the only slot as free, but session 1 has reserved it.
+	if _, err := e.StartSession(context.Background(), 2, caps); err == nil || !strings.Contains(err.Error(), "free slot") {
+		t.Fatalf("Got %v, want error while the only slot is reserved", err)
+	}
+
+	if err := e.StopSession(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.StartSession(context.Background(), 3, caps); err != nil {
+		t.Fatalf("Got %v, want session started once the reservation is released", err)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	stereotype := map[string]interface{}{"browserName": "chrome", "browserVersion": "120", "platformName": "LINUX"}
+	for _, tc := range []struct {
+		caps map[string]interface{}
+		want bool
+	}{
+		{map[string]interface{}{}, true},
+		{map[string]interface{}{"browserName": "chrome", "platformName": "linux"}, true},
+		{map[string]interface{}{"browserName": "chrome", "platformName": "ANY"}, true},
+		{map[string]interface{}{"browserName": "chrome", "browserVersion": "121"}, false},
+		{map[string]interface{}{"browserName": "firefox"}, false},
+	} {
+		if got := matches(stereotype, tc.caps); got != tc.want {
+			t.Errorf("matches(%v) got %v, want %v", tc.caps, got, tc.want)
+		}
+	}
+}
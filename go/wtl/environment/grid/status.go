@@ -0,0 +1,155 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+)
+
+// matchedCaps are the capabilities compared against slot stereotypes, as by the grid's default
+// slot matcher.
+var matchedCaps = []string{"browserName", "browserVersion", "platformName"}
+
+// status is the response to a Selenium Grid 4 /status request.
+type status struct {
+	Value struct {
+		Ready   bool   `json:"ready"`
+		Message string `json:"message"`
+		Nodes   []node `json:"nodes"`
+	} `json:"value"`
+}
+
+type node struct {
+	ID           string `json:"id"`
+	URI          string `json:"uri"`
+	Availability string `json:"availability"`
+	Slots        []slot `json:"slots"`
+}
+
+type slot struct {
+	Session *struct {
+		SessionID string `json:"sessionId"`
+	} `json:"session"`
+	Stereotype map[string]interface{} `json:"stereotype"`
+}
+
+// findSlot returns an available node with a slot whose stereotype matches any of candidates.
+// If free is true, the slot must not have a session.
+func (s *status) findSlot(candidates []map[string]interface{}, free bool) (node, bool) {
+	for _, n := range s.Value.Nodes {
+		if n.Availability != "" && n.Availability != "UP" {
+			continue
+		}
+		for _, sl := range n.Slots {
+			if free && sl.Session != nil {
+				continue
+			}
+			for _, c := range candidates {
+				if matches(sl.Stereotype, c) {
+					return n, true
+				}
+			}
+		}
+	}
+	return node{}, false
+}
+
+// freeSlots counts the free slots on available nodes whose stereotype matches any of candidates,
+// keyed by the stereotype's matched capabilities.
+func (s *status) freeSlots(candidates []map[string]interface{}) map[string]int {
+	free := map[string]int{}
+	for _, n := range s.Value.Nodes {
+		if n.Availability != "" && n.Availability != "UP" {
+			continue
+		}
+		for _, sl := range n.Slots {
+			if sl.Session != nil {
+				continue
+			}
+			for _, c := range candidates {
+				if matches(sl.Stereotype, c) {
+					free[describe(sl.Stereotype)]++
+					break
+				}
+			}
+		}
+	}
+	return free
+}
+
+// nodeForSession returns the node running the session with sessionID.
+func (s *status) nodeForSession(sessionID string) (node, bool) {
+	for _, n := range s.Value.Nodes {
+		for _, sl := range n.Slots {
+			if sl.Session != nil && sl.Session.SessionID == sessionID {
+				return n, true
+			}
+		}
+	}
+	return node{}, false
+}
+
+func matches(stereotype, caps map[string]interface{}) bool {
+	for _, k := range matchedCaps {
+		want, _ := caps[k].(string)
+		if want == "" {
+			continue
+		}
+		got, _ := stereotype[k].(string)
+		if k == "platformName" {
+			if strings.EqualFold(want, "any") {
+				continue
+			}
+			if !strings.EqualFold(got, want) {
+				return false
+			}
+		} else if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// candidateCaps returns the capabilities a slot may match for caps: alwaysMatch merged with each
+// firstMatch entry.
+func candidateCaps(caps *capabilities.Capabilities) []map[string]interface{} {
+	if len(caps.FirstMatch) == 0 {
+		return []map[string]interface{}{caps.AlwaysMatch}
+	}
+	var candidates []map[string]interface{}
+	for _, fm := range caps.FirstMatch {
+		candidates = append(candidates, capabilities.Merge(caps.AlwaysMatch, fm))
+	}
+	return candidates
+}
+
+// describe describes the matched capabilities in caps.
+func describe(caps map[string]interface{}) string {
+	var parts []string
+	for _, k := range matchedCaps {
+		if v, ok := caps[k].(string); ok && v != "" {
+			parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	if len(parts) == 0 {
+		return "any browser"
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,286 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multibrowser provides an environment that runs several browser environments at once,
+// so that a single test can use sessions with different browsers.
+//
+// Additional browsers are declared in the browsers section of a Metadata.Extension field, keyed
+// by name. Each is a Metadata object whose fields are merged over the test's environment, labels,
+// web test files, and extension (but not its capabilities), e.g.:
+//
+//	"browsers": {
+//	  "firefox": {
+//	    "environment": "local",
+//	    "capabilities": {"browserName": "firefox", ...},
+//	    "webTestFiles": [...]
+//	  }
+//	}
+//
+// The browser configured by the rest of the metadata is named "default". New sessions are
+// routed to the browser named by the google:browser capability if set, otherwise to the first
+// browser whose capabilities have the requested browserName, otherwise to the default browser.
+package multibrowser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+const (
+	name = "Multi-browser Environment"
+	// DefaultBrowser is the name of the browser configured by the top-level metadata.
+	DefaultBrowser = "default"
+	// Capability is the capability that selects a browser by name.
+	Capability = "google:browser"
+)
+
+// Browser is a named browser configuration and its environment.
+type Browser struct {
+	Name     string
+	Metadata *metadata.Metadata
+	Env      environment.Env
+}
+
+type env struct {
+	diagnostics.Diagnostics
+	// browsers[0] is the default browser.
+	browsers []*Browser
+
+	mu       sync.Mutex
+	sessions map[int]environment.Env
+}
+
+// Browsers returns the metadata for each browser declared in the browsers section of m's
+// extension, ordered by name. It returns nil if there are none.
+func Browsers(m *metadata.Metadata) ([]*Browser, error) {
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return nil, nil
+	}
+	b, ok := extMap["browsers"]
+	if !ok {
+		return nil, nil
+	}
+	bm, ok := b.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(name, fmt.Errorf("browsers %#v is not an object", b))
+	}
+
+	base := &metadata.Metadata{
+		Environment:  m.Environment,
+		Label:        m.Label,
+		TestLabel:    m.TestLabel,
+		ConfigLabel:  m.ConfigLabel,
+		WebTestFiles: m.WebTestFiles,
+	}
+
+	var browsers []*Browser
+	for n, v := range bm {
+		if n == DefaultBrowser {
+			return nil, errors.New(name, fmt.Errorf("browsers.%s: %q is reserved for the browser configured by the test's metadata", n, n))
+		}
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(name, fmt.Errorf("browsers.%s %#v is not an object", n, v))
+		}
+		// The browser's extension fields are overlaid on the test's.
+		ext := map[string]interface{}{}
+		for k, e := range extMap {
+			ext[k] = e
+		}
+		delete(ext, "browsers")
+		if be, ok := entry["extension"]; ok {
+			bem, ok := be.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(name, fmt.Errorf("browsers.%s.extension %#v is not an object", n, be))
+			}
+			for k, e := range bem {
+				ext[k] = e
+			}
+		}
+		withExt := map[string]interface{}{}
+		for k, e := range entry {
+			withExt[k] = e
+		}
+		withExt["extension"] = ext
+
+		bytes, err := json.Marshal(withExt)
+		if err != nil {
+			return nil, errors.New(name, fmt.Errorf("browsers.%s: %v", n, err))
+		}
+		bmd, err := metadata.FromBytes(bytes, nil)
+		if err != nil {
+			return nil, errors.New(name, fmt.Errorf("browsers.%s: %v", n, err))
+		}
+		merged, err := metadata.Merge(base, bmd)
+		if err != nil {
+			return nil, errors.New(name, fmt.Errorf("browsers.%s: %v", n, err))
+		}
+		browsers = append(browsers, &Browser{Name: n, Metadata: merged})
+	}
+	sort.Slice(browsers, func(i, j int) bool { return browsers[i].Name < browsers[j].Name })
+	return browsers, nil
+}
+
+// NewEnv creates an environment that manages the environments of several browsers. The first
+// browser is the default.
+func NewEnv(browsers []*Browser, d diagnostics.Diagnostics) (environment.Env, error) {
+	if len(browsers) == 0 {
+		return nil, errors.New(name, "at least one browser is required")
+	}
+	return &env{
+		Diagnostics: d,
+		browsers:    browsers,
+		sessions:    map[int]environment.Env{},
+	}, nil
+}
+
+func (*env) Name() string {
+	return name
+}
+
+// Select returns the environment of the browser that should be used for a session requested
+// with caps.
+func (e *env) Select(caps *capabilities.Capabilities) (environment.Env, error) {
+	if caps != nil {
+		if v, ok := caps.AlwaysMatch[Capability]; ok {
+			n, ok := v.(string)
+			if !ok {
+				return nil, errors.New(name, fmt.Errorf("%s %#v is not a string", Capability, v))
+			}
+			for _, b := range e.browsers {
+				if b.Name == n {
+					return b.Env, nil
+				}
+			}
+			return nil, errors.New(name, fmt.Errorf("%s %q is not one of the configured browsers: %s", Capability, n, strings.Join(e.names(), ", ")))
+		}
+
+		if bn, ok := caps.AlwaysMatch["browserName"].(string); ok && bn != "" {
+			for _, b := range e.browsers {
+				if configured, ok := b.Metadata.Capabilities["browserName"].(string); ok && strings.EqualFold(configured, bn) {
+					return b.Env, nil
+				}
+			}
+		}
+	}
+	return e.browsers[0].Env, nil
+}
+
+func (e *env) names() []string {
+	var names []string
+	for _, b := range e.browsers {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+// SetUp sets up the environments of all browsers concurrently.
+func (e *env) SetUp(ctx context.Context) error {
+	return e.each(func(env environment.Env) error {
+		return env.SetUp(ctx)
+	})
+}
+
+// TearDown tears down the environments of all browsers concurrently.
+func (e *env) TearDown(ctx context.Context) error {
+	return e.each(func(env environment.Env) error {
+		return env.TearDown(ctx)
+	})
+}
+
+// TestFinished passes the exit status of the test on to the environments of all browsers.
+func (e *env) TestFinished(ctx context.Context, exitStatus int) {
+	for _, b := range e.browsers {
+		environment.NotifyTestFinished(ctx, b.Env, exitStatus)
+	}
+}
+
+// Healthy returns nil iff the environments of all browsers are healthy.
+func (e *env) Healthy(ctx context.Context) error {
+	for _, b := range e.browsers {
+		if err := b.Env.Healthy(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartSession starts a session in the environment chosen by Select.
+func (e *env) StartSession(ctx context.Context, id int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	env, err := e.Select(caps)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.sessions[id] = env
+	e.mu.Unlock()
+	return env.StartSession(ctx, id, caps)
+}
+
+// StopSession stops a session in the environment it was started in.
+func (e *env) StopSession(ctx context.Context, id int) error {
+	e.mu.Lock()
+	env, ok := e.sessions[id]
+	delete(e.sessions, id)
+	e.mu.Unlock()
+	if !ok {
+		env = e.browsers[0].Env
+	}
+	return env.StopSession(ctx, id)
+}
+
+// WDAddress returns the address of the default browser's WebDriver server.
+func (e *env) WDAddress(ctx context.Context) string {
+	return e.browsers[0].Env.WDAddress(ctx)
+}
+
+// each calls f for the environment of every browser concurrently, returning the errors, if any.
+func (e *env) each(f func(environment.Env) error) error {
+	errs := make([]error, len(e.browsers))
+	var wg sync.WaitGroup
+	for i, b := range e.browsers {
+		wg.Add(1)
+		go func(i int, env environment.Env) {
+			defer wg.Done()
+			errs[i] = f(env)
+		}(i, b.Env)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return errors.New(name, fmt.Errorf("errors in browser environments: %v", failed))
+	}
+}
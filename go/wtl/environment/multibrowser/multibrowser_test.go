@@ -0,0 +1,203 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multibrowser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+func TestBrowsers(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{
+		"environment": "local",
+		"capabilities": {"browserName": "chrome"},
+		"extension": {
+			"faultInjection": {"rate": 0},
+			"browsers": {
+				"firefox": {"capabilities": {"browserName": "firefox"}},
+				"edge": {"environment": "external", "capabilities": {"browserName": "MicrosoftEdge"}}
+			}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	browsers, err := Browsers(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(browsers) != 2 {
+		t.Fatalf("Got %d browsers, expected 2", len(browsers))
+	}
+
+	for i, want := range []struct {
+		name, environment, browserName string
+	}{
+		{"edge", "external", "MicrosoftEdge"},
+		{"firefox", "local", "firefox"},
+	} {
+		b := browsers[i]
+		if b.Name != want.name {
+			t.Errorf("Got browser %q at index %d, expected %q", b.Name, i, want.name)
+		}
+		if b.Metadata.Environment != want.environment {
+			t.Errorf("Got environment %q for %s, expected %q", b.Metadata.Environment, b.Name, want.environment)
+		}
+		if len(b.Metadata.Capabilities) != 1 || b.Metadata.Capabilities["browserName"] != want.browserName {
+			t.Errorf("Got capabilities %v for %s, expected only browserName %q", b.Metadata.Capabilities, b.Name, want.browserName)
+		}
+		if ext, _ := b.Metadata.ExtensionMap(); ext["faultInjection"] == nil {
+			t.Errorf("Got extension %v for %s, expected the test's extension", ext, b.Name)
+		}
+	}
+}
+
+func TestBrowsersErrors(t *testing.T) {
+	for _, md := range []string{
+		`{"extension": {"browsers": []}}`,
+		`{"extension": {"browsers": {"default": {}}}}`,
+		`{"extension": {"browsers": {"firefox": {"capabilities": []}}}}`,
+	} {
+		m, err := metadata.FromBytes([]byte(md), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Browsers(m); err == nil {
+			t.Errorf("Got nil error for %s, expected error", md)
+		}
+	}
+}
+
+func TestBrowsersNone(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{"environment": "local"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	browsers, err := Browsers(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(browsers) != 0 {
+		t.Errorf("Got %d browsers, expected 0", len(browsers))
+	}
+}
+
+type fakeEnv struct {
+	environment.Env
+	name    string
+	started []int
+	stopped []int
+}
+
+func (e *fakeEnv) Name() string {
+	return e.name
+}
+
+func (e *fakeEnv) StartSession(_ context.Context, id int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	e.started = append(e.started, id)
+	return caps, nil
+}
+
+func (e *fakeEnv) StopSession(_ context.Context, id int) error {
+	e.stopped = append(e.stopped, id)
+	return nil
+}
+
+func newMultiEnv(t *testing.T) (*env, map[string]*fakeEnv) {
+	t.Helper()
+	fakes := map[string]*fakeEnv{}
+	var browsers []*Browser
+	for _, b := range []struct{ name, browserName string }{
+		{DefaultBrowser, "chrome"},
+		{"firefox", "firefox"},
+		{"firefox-beta", "firefox"},
+	} {
+		fakes[b.name] = &fakeEnv{name: b.name}
+		browsers = append(browsers, &Browser{
+			Name:     b.name,
+			Metadata: &metadata.Metadata{Capabilities: map[string]interface{}{"browserName": b.browserName}},
+			Env:      fakes[b.name],
+		})
+	}
+	e, err := NewEnv(browsers, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.(*env), fakes
+}
+
+func TestSelect(t *testing.T) {
+	e, _ := newMultiEnv(t)
+
+	for _, tc := range []struct {
+		name string
+		caps map[string]interface{}
+		want string
+	}{
+		{"no capabilities", nil, DefaultBrowser},
+		{"browserName", map[string]interface{}{"browserName": "Firefox"}, "firefox"},
+		{"unconfigured browserName", map[string]interface{}{"browserName": "safari"}, DefaultBrowser},
+		{"google:browser", map[string]interface{}{"browserName": "firefox", Capability: "firefox-beta"}, "firefox-beta"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := e.Select(&capabilities.Capabilities{AlwaysMatch: tc.caps})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name() != tc.want {
+				t.Errorf("Got %s, expected %s", got.Name(), tc.want)
+			}
+		})
+	}
+
+	for _, caps := range []map[string]interface{}{
+		{Capability: "safari"},
+		{Capability: 1.0},
+	} {
+		if _, err := e.Select(&capabilities.Capabilities{AlwaysMatch: caps}); err == nil {
+			t.Errorf("Got nil error for %v, expected error", caps)
+		}
+	}
+}
+
+func TestSessionsRoutedToEnv(t *testing.T) {
+	e, fakes := newMultiEnv(t)
+	ctx := context.Background()
+
+	if _, err := e.StartSession(ctx, 1, &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{Capability: "firefox"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.StartSession(ctx, 2, &capabilities.Capabilities{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{1, 2} {
+		if err := e.StopSession(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if f := fakes["firefox"]; len(f.started) != 1 || f.started[0] != 1 || len(f.stopped) != 1 || f.stopped[0] != 1 {
+		t.Errorf("Got firefox started %v, stopped %v, expected session 1", f.started, f.stopped)
+	}
+	if f := fakes[DefaultBrowser]; len(f.started) != 1 || f.started[0] != 2 || len(f.stopped) != 1 || f.stopped[0] != 2 {
+		t.Errorf("Got default started %v, stopped %v, expected session 2", f.started, f.stopped)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"fmt"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+)
+
+// replayOptions is the set of options that can be defined in the replayOptions section of
+// a Metadata.Extension field.
+type replayOptions struct {
+	// Whether to record the WebDriver traffic of each session. If true, the environment is wrapped
+	// so that all requests sent to the WebDriver server, and their responses, are written to one
+	// file per session. Defaults to false.
+	record bool
+	// The directory recordings are written to. If not defined, uses TEST_UNDECLARED_OUTPUTS_DIR.
+	recordDir string
+	// The recordings served by the replay environment, in the order sessions will be created. Each
+	// entry is a recording file or a directory of recording files, either an absolute path or a
+	// runfiles path.
+	recordings []string
+}
+
+func extractOptions(m *metadata.Metadata) (replayOptions, error) {
+	opts := replayOptions{}
+
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return opts, nil
+	}
+
+	roMap, ok := extMap["replayOptions"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+
+	if r, ok := roMap["record"]; ok {
+		rb, ok := r.(bool)
+		if !ok {
+			return opts, fmt.Errorf("replayOptions.record %#v is not a boolean", r)
+		}
+		opts.record = rb
+	}
+
+	if d, ok := roMap["recordDir"]; ok {
+		ds, ok := d.(string)
+		if !ok {
+			return opts, fmt.Errorf("replayOptions.recordDir %#v is not a string", d)
+		}
+		opts.recordDir = ds
+	}
+
+	if r, ok := roMap["recordings"]; ok {
+		ri, ok := r.([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("replayOptions.recordings %#v is not a list", r)
+		}
+		for _, e := range ri {
+			es, ok := e.(string)
+			if !ok {
+				return opts, fmt.Errorf("element %#v in replayOptions.recordings is not a string", e)
+			}
+			opts.recordings = append(opts.recordings, es)
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,310 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+const recorderName = "WebDriver Recorder"
+
+// recorder wraps an environment.Env, and records all traffic between WTL and the WebDriver server
+// provided by the wrapped environment.
+type recorder struct {
+	environment.Env
+	diagnostics diagnostics.Diagnostics
+	dir         string
+	client      *http.Client
+	listener    net.Listener
+	server      *http.Server
+	address     string
+
+	mu       sync.Mutex
+	count    int
+	sessions map[string]*recordingFile
+}
+
+type recordingFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// RecordIfEnabled wraps env so that every request sent to its WebDriver server, and the response
+// returned, are recorded to one file per session if replayOptions.record is set in m. Otherwise
+// env is returned unchanged. The recordings can be served by the replay environment.
+func RecordIfEnabled(env environment.Env, m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error) {
+	opts, err := extractOptions(m)
+	if err != nil {
+		return nil, errors.New(recorderName, err)
+	}
+	if !opts.record {
+		return env, nil
+	}
+
+	dir := opts.recordDir
+	if dir == "" {
+		dir = bazel.TestUndeclaredOutputsDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.New(recorderName, err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.New(recorderName, err)
+	}
+
+	r := &recorder{
+		Env:         env,
+		diagnostics: d,
+		dir:         dir,
+		client:      &http.Client{},
+		listener:    l,
+		address:     fmt.Sprintf("http://%s/", l.Addr().String()),
+		sessions:    map[string]*recordingFile{},
+	}
+	r.server = &http.Server{Handler: r}
+	return r, nil
+}
+
+// SetUp sets up the wrapped environment and starts recording.
+func (r *recorder) SetUp(ctx context.Context) error {
+	go func() {
+		if err := r.server.Serve(r.listener); err != nil && err != http.ErrServerClosed {
+			r.diagnostics.Severe(errors.New(recorderName, err))
+		}
+	}()
+	return r.Env.SetUp(ctx)
+}
+
+// TearDown stops recording and tears down the wrapped environment.
+func (r *recorder) TearDown(ctx context.Context) error {
+	if err := r.server.Close(); err != nil {
+		r.diagnostics.Warning(errors.New(recorderName, err))
+	}
+
+	r.mu.Lock()
+	for id, rf := range r.sessions {
+		rf.close()
+		delete(r.sessions, id)
+	}
+	r.mu.Unlock()
+
+	return r.Env.TearDown(ctx)
+}
+
+// WDAddress returns the address of the recording proxy in front of the wrapped environment's WebDriver server.
+func (r *recorder) WDAddress(context.Context) string {
+	return r.address
+}
+
+// SessionCreated passes the WebDriver session ID on to the wrapped environment.
+func (r *recorder) SessionCreated(ctx context.Context, id int, sessionID string) {
+	environment.NotifySessionCreated(ctx, r.Env, id, sessionID)
+}
+
+// TestFinished passes the exit status of the test on to the wrapped environment.
+func (r *recorder) TestFinished(ctx context.Context, exitStatus int) {
+	environment.NotifyTestFinished(ctx, r.Env, exitStatus)
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target := strings.TrimSuffix(r.Env.WDAddress(ctx), "/") + req.URL.Path
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+
+	fwd, err := http.NewRequest(req.Method, target, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fwd = fwd.WithContext(ctx)
+	for k, v := range req.Header {
+		fwd.Header[k] = v
+	}
+	fwd.Header.Del("Connection")
+
+	resp, err := r.client.Do(fwd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+
+	if err := r.record(req.Method, req.URL.Path, body, resp.StatusCode, respBody); err != nil {
+		r.diagnostics.Warning(errors.New(recorderName, err))
+	}
+}
+
+func (r *recorder) record(method, path string, body []byte, status int, respBody []byte) error {
+	tokens := strings.Split(strings.Trim(path, "/"), "/")
+	if len(tokens) == 0 || tokens[0] != "session" {
+		return nil
+	}
+
+	if len(tokens) == 1 {
+		if method != http.MethodPost || status != http.StatusOK {
+			return nil
+		}
+		id := sessionIDFromResponse(respBody)
+		if id == "" {
+			return fmt.Errorf("no session id in new session response %s", respBody)
+		}
+		rf, err := r.newRecordingFile(id)
+		if err != nil {
+			return err
+		}
+		return rf.write(&Exchange{
+			NewSession: true,
+			SessionID:  id,
+			Method:     method,
+			Request:    rawJSON(body),
+			Status:     status,
+			Response:   rawJSON(respBody),
+		})
+	}
+
+	id := tokens[1]
+	command := strings.Join(tokens[2:], "/")
+
+	r.mu.Lock()
+	rf := r.sessions[id]
+	if method == http.MethodDelete && command == "" {
+		delete(r.sessions, id)
+	}
+	r.mu.Unlock()
+
+	if rf == nil {
+		return fmt.Errorf("request %s %s is for an unknown session", method, path)
+	}
+
+	err := rf.write(&Exchange{
+		SessionID: id,
+		Method:    method,
+		Command:   command,
+		Request:   rawJSON(body),
+		Status:    status,
+		Response:  rawJSON(respBody),
+	})
+
+	if method == http.MethodDelete && command == "" {
+		rf.close()
+	}
+	return err
+}
+
+func (r *recorder) newRecordingFile(id string) (*recordingFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	f, err := os.Create(filepath.Join(r.dir, fmt.Sprintf("webdriver-session-%03d%s", r.count, recordingExt)))
+	if err != nil {
+		return nil, err
+	}
+	rf := &recordingFile{file: f}
+	r.sessions[id] = rf
+	return rf, nil
+}
+
+func (rf *recordingFile) write(e *Exchange) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return fmt.Errorf("recording for session %s is already closed", e.SessionID)
+	}
+	_, err = rf.file.Write(append(line, '\n'))
+	return err
+}
+
+func (rf *recordingFile) close() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file != nil {
+		rf.file.Close()
+		rf.file = nil
+	}
+}
+
+// sessionIDFromResponse extracts the session id from either a W3C or JWP new session response.
+func sessionIDFromResponse(body []byte) string {
+	resp := struct {
+		SessionID string `json:"sessionId"`
+		Value     struct {
+			SessionID string `json:"sessionId"`
+		} `json:"value"`
+	}{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ""
+	}
+	if resp.SessionID != "" {
+		return resp.SessionID
+	}
+	return resp.Value.SessionID
+}
+
+// rawJSON returns body as a json.RawMessage, encoding it as a JSON string if it is not valid JSON.
+func rawJSON(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return body
+	}
+	s, _ := json.Marshal(string(body))
+	return s
+}
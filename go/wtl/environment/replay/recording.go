@@ -0,0 +1,276 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+)
+
+// recordingExt is the extension of recording files.
+const recordingExt = ".jsonl"
+
+// referenceKeys are the JSON object keys whose values are ids generated by the remote end.
+var referenceKeys = map[string]bool{
+	"ELEMENT":                             true,
+	"element-6066-11e4-a52e-4f735466cecf": true,
+	"shadow-6066-11e4-a52e-4f735466cecf":  true,
+	"window-fcc6-11e5-b4f8-330a88ab9d7f":  true,
+	"frame-075b-4da1-b6ba-e579c2d3230a":   true,
+}
+
+// An Exchange is a single request sent to a WebDriver server and the response it returned.
+// A recording is a file with one JSON encoded Exchange per line. The first Exchange is always
+// the new session request.
+type Exchange struct {
+	// NewSession is true for the new session request.
+	NewSession bool `json:"newSession,omitempty"`
+	// SessionID is the id of the recorded session.
+	SessionID string `json:"sessionId"`
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+	// Command is the path of the request relative to the session, e.g. "element/abc/click". It is
+	// empty for the new session request and for delete session.
+	Command string `json:"command"`
+	// Request is the body of the request, if any.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Response is the body of the response.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+func (e *Exchange) String() string {
+	return describe(e.Method, e.Command, e.Request)
+}
+
+func describe(method, command string, body []byte) string {
+	s := fmt.Sprintf("%s /session/{id}", method)
+	if command != "" {
+		s += "/" + command
+	}
+	if b := normalize(body); b != "" {
+		s += " " + b
+	}
+	return s
+}
+
+// normalize returns a canonical form of a JSON body so that bodies that differ only in
+// whitespace or key order compare equal.
+func normalize(body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+		return ""
+	}
+	n, err := json.Marshal(v)
+	if err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	return string(n)
+}
+
+// readRecording reads the exchanges in a single recording file.
+func readRecording(path string) ([]*Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exchanges []*Exchange
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 256*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		e := &Exchange{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(exchanges) == 0 || !exchanges[0].NewSession {
+		return nil, fmt.Errorf("%s does not start with a new session request", path)
+	}
+	return exchanges, nil
+}
+
+// recordingFiles expands paths into a list of recording files. Directories are expanded to the
+// recording files they contain, sorted by name.
+func recordingFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			rp, err := bazel.Runfile(p)
+			if err != nil {
+				return nil, err
+			}
+			p = rp
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), recordingExt) {
+				names = append(names, e.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			files = append(files, filepath.Join(p, n))
+		}
+	}
+	return files, nil
+}
+
+// idMap remaps ids generated by the remote end in a recording to ids handed out during replay.
+type idMap struct {
+	prefix   string
+	next     int
+	toReplay map[string]string
+	toRecord map[string]string
+}
+
+func newIDMap(prefix string) *idMap {
+	return &idMap{
+		prefix:   prefix,
+		toReplay: map[string]string{},
+		toRecord: map[string]string{},
+	}
+}
+
+func (m *idMap) add(recorded, replayed string) {
+	m.toReplay[recorded] = replayed
+	m.toRecord[replayed] = recorded
+}
+
+// replayID returns the replay id for a recorded id, allocating a new one if necessary.
+func (m *idMap) replayID(recorded string) string {
+	if id, ok := m.toReplay[recorded]; ok {
+		return id
+	}
+	m.next++
+	id := fmt.Sprintf("%s-%d", m.prefix, m.next)
+	m.add(recorded, id)
+	return id
+}
+
+// toRecorded replaces all replay ids in v with the corresponding recorded ids.
+func (m *idMap) toRecorded(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if id, ok := m.toRecord[t]; ok {
+			return id
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = m.toRecorded(e)
+		}
+		return t
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = m.toRecorded(e)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// toReplayed replaces all recorded ids in v with replay ids. Values of element, shadow root,
+// window, and frame references are allocated new replay ids.
+func (m *idMap) toReplayed(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if id, ok := m.toReplay[t]; ok {
+			return id
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = m.toReplayed(e)
+		}
+		return t
+	case map[string]interface{}:
+		for k, e := range t {
+			if s, ok := e.(string); ok && referenceKeys[k] {
+				t[k] = m.replayID(s)
+				continue
+			}
+			t[k] = m.toReplayed(e)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// mapBody applies f to the decoded JSON body and re-encodes it. Bodies that are not JSON are returned unchanged.
+func mapBody(body []byte, f func(interface{}) interface{}) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	b, err := json.Marshal(f(v))
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// mapCommand applies f to each token of a command path.
+func mapCommand(command string, f func(interface{}) interface{}) string {
+	if command == "" {
+		return command
+	}
+	tokens := strings.Split(command, "/")
+	for i, t := range tokens {
+		tokens[i] = f(t).(string)
+	}
+	return strings.Join(tokens, "/")
+}
@@ -0,0 +1,319 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replay provides an environment that serves previously recorded WebDriver traffic
+// without starting a browser, and a wrapper for other environments that records that traffic.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/httphelper"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+const (
+	name = "Replay WebDriver Environment"
+	// healthProbe is the script the WebDriver client executes to check that a session is healthy.
+	healthProbe = "return navigator.userAgent"
+)
+
+type replay struct {
+	*environment.Base
+	recordings [][]*Exchange
+
+	mu       sync.Mutex
+	server   *http.Server
+	address  string
+	next     int
+	sessions map[string]*session
+	started  []*session
+}
+
+type session struct {
+	id        string
+	exchanges []*Exchange
+	// The index of the next recorded exchange that the client is expected to send.
+	next int
+	ids  *idMap
+
+	mu sync.Mutex
+}
+
+// NewEnv creates a new environment that serves the recordings listed in replayOptions.recordings.
+func NewEnv(m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error) {
+	opts, err := extractOptions(m)
+	if err != nil {
+		return nil, errors.New(name, err)
+	}
+	if len(opts.recordings) == 0 {
+		return nil, errors.New(name, "replayOptions.recordings must list at least one recording")
+	}
+
+	files, err := recordingFiles(opts.recordings)
+	if err != nil {
+		return nil, errors.New(name, err)
+	}
+
+	var recordings [][]*Exchange
+	for _, f := range files {
+		exchanges, err := readRecording(f)
+		if err != nil {
+			return nil, errors.New(name, err)
+		}
+		recordings = append(recordings, exchanges)
+	}
+
+	base, err := environment.NewBase(name, m, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replay{
+		Base:       base,
+		recordings: recordings,
+		sessions:   map[string]*session{},
+	}, nil
+}
+
+// SetUp starts the server that replays the recordings.
+func (r *replay) SetUp(ctx context.Context) error {
+	if err := r.Base.SetUp(ctx); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.New(r.Name(), err)
+	}
+
+	r.mu.Lock()
+	r.server = &http.Server{Handler: http.HandlerFunc(r.serveHTTP)}
+	r.address = fmt.Sprintf("http://%s/", l.Addr().String())
+	server := r.server
+	r.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			r.Severe(errors.New(r.Name(), err))
+		}
+	}()
+	return nil
+}
+
+// TearDown stops the server, and warns about recorded sessions and commands that were not replayed.
+func (r *replay) TearDown(ctx context.Context) error {
+	if err := r.Base.TearDown(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.server != nil {
+		if err := r.server.Close(); err != nil {
+			r.Warning(errors.New(r.Name(), err))
+		}
+	}
+
+	for _, s := range r.started {
+		if n := s.remaining(); n != 0 {
+			r.Warning(errors.New(r.Name(), fmt.Sprintf("%d recorded command(s) in session %s were not replayed", n, s.id)))
+		}
+	}
+	if n := len(r.recordings) - r.next; n > 0 {
+		r.Warning(errors.New(r.Name(), fmt.Sprintf("%d recorded session(s) were not replayed", n)))
+	}
+	return nil
+}
+
+// Healthy returns nil once the replay server has been started.
+func (r *replay) Healthy(ctx context.Context) error {
+	if err := r.Base.Healthy(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.server == nil {
+		return errors.New(r.Name(), "replay server has not been started")
+	}
+	return nil
+}
+
+// WDAddress returns the address of the replay server.
+func (r *replay) WDAddress(context.Context) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.address
+}
+
+func (r *replay) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, 13, "unknown error", err.Error())
+		return
+	}
+
+	tokens := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	switch {
+	case len(tokens) == 1 && tokens[0] == "status":
+		writeResponse(w, http.StatusOK, []byte(`{"status": 0, "value": {"ready": true, "message": "replaying recorded sessions"}}`))
+	case len(tokens) == 1 && tokens[0] == "session" && req.Method == http.MethodPost:
+		r.newSession(w)
+	case len(tokens) >= 2 && tokens[0] == "session":
+		r.mu.Lock()
+		s := r.sessions[tokens[1]]
+		r.mu.Unlock()
+		if s == nil {
+			errorResponse(w, http.StatusNotFound, 6, "invalid session id", fmt.Sprintf("%q is not an active replay session", tokens[1]))
+			return
+		}
+		command := strings.Join(tokens[2:], "/")
+		status, respBody, err := s.replay(req.Method, command, body)
+		if err != nil {
+			r.Warning(errors.New(r.Name(), err))
+			errorResponse(w, http.StatusInternalServerError, 13, "unknown error", err.Error())
+			return
+		}
+		if req.Method == http.MethodDelete && command == "" {
+			r.mu.Lock()
+			delete(r.sessions, s.id)
+			r.mu.Unlock()
+		}
+		writeResponse(w, status, respBody)
+	default:
+		errorResponse(w, http.StatusNotFound, 9, "unknown command", fmt.Sprintf("%s %s is not supported by the replay environment", req.Method, req.URL.Path))
+	}
+}
+
+func (r *replay) newSession(w http.ResponseWriter) {
+	r.mu.Lock()
+	if r.next >= len(r.recordings) {
+		n := len(r.recordings)
+		r.mu.Unlock()
+		err := errors.New(r.Name(), fmt.Sprintf("no more recorded sessions; all %d recorded session(s) have already been replayed", n))
+		r.Warning(err)
+		errorResponse(w, http.StatusInternalServerError, 33, "session not created", err.Error())
+		return
+	}
+	exchanges := r.recordings[r.next]
+	r.next++
+	s := &session{
+		id:        fmt.Sprintf("replay-session-%d", r.next),
+		exchanges: exchanges,
+		next:      1,
+		ids:       newIDMap("replay-element"),
+	}
+	s.ids.add(exchanges[0].SessionID, s.id)
+	r.sessions[s.id] = s
+	r.started = append(r.started, s)
+	r.mu.Unlock()
+
+	writeResponse(w, exchanges[0].Status, mapBody(exchanges[0].Response, s.ids.toReplayed))
+}
+
+// replay checks that method, command, and body match the next recorded command, in recorded
+// order, and returns its response with recorded ids replaced by replay ids.
+func (s *session) replay(method, command string, body []byte) (int, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recCommand := mapCommand(command, s.ids.toRecorded)
+	recBody := normalize(mapBody(body, s.ids.toRecorded))
+
+	for s.next < len(s.exchanges) {
+		e := s.exchanges[s.next]
+		if e.Method == method && e.Command == recCommand && normalize(e.Request) == recBody {
+			s.next++
+			return e.Status, mapBody(e.Response, s.ids.toReplayed), nil
+		}
+		// Health probes happen outside of what the test asked for, so recorded ones are skipped
+		// if the client did not send one at the same point.
+		if !isHealthProbe(e.Method, e.Command, e.Request) {
+			break
+		}
+		s.next++
+	}
+
+	// The WebDriver client checks the health of sessions and quits them outside of what the test
+	// asked for, so those are answered even if they were not recorded.
+	if method == http.MethodDelete && command == "" {
+		return http.StatusOK, []byte(`{"status": 0, "value": null}`), nil
+	}
+	if isHealthProbe(method, command, body) {
+		return http.StatusOK, []byte(`{"status": 0, "value": "replay"}`), nil
+	}
+
+	received := describe(method, recCommand, []byte(recBody))
+	if s.next >= len(s.exchanges) {
+		return 0, nil, fmt.Errorf("replay mismatch in session %s: received %s, but all %d recorded command(s) have already been replayed", s.id, received, len(s.exchanges)-1)
+	}
+	return 0, nil, fmt.Errorf("replay mismatch in session %s at recorded command %d of %d:\n  expected %s\n  received %s",
+		s.id, s.next, len(s.exchanges)-1, s.exchanges[s.next], received)
+}
+
+func (s *session) remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.exchanges[s.next:] {
+		if (e.Method == http.MethodDelete && e.Command == "") || isHealthProbe(e.Method, e.Command, e.Request) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func isHealthProbe(method, command string, body []byte) bool {
+	if method != http.MethodPost || (command != "execute" && command != "execute/sync") {
+		return false
+	}
+	args := struct {
+		Script string `json:"script"`
+	}{}
+	if err := json.Unmarshal(body, &args); err != nil {
+		return false
+	}
+	return args.Script == healthProbe
+}
+
+func writeResponse(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	httphelper.SetDefaultResponseHeaders(w.Header())
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func errorResponse(w http.ResponseWriter, httpStatus, status int, err, message string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"status": status,
+		"value": map[string]interface{}{
+			"error":   err,
+			"message": message,
+		},
+	})
+	writeResponse(w, httpStatus, body)
+}
@@ -0,0 +1,312 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+const elementKey = "element-6066-11e4-a52e-4f735466cecf"
+
+// fakeWebDriver is a minimal W3C WebDriver server with a single session and a single element.
+func fakeWebDriver(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var value interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /session":
+			value = map[string]interface{}{
+				"sessionId":    "real-session",
+				"capabilities": map[string]interface{}{"browserName": "fake"},
+			}
+		case "POST /session/real-session/execute/sync":
+			value = "fake user agent"
+		case "POST /session/real-session/url", "DELETE /session/real-session":
+		case "POST /session/real-session/element":
+			value = map[string]interface{}{elementKey: "real-element"}
+		case "POST /session/real-session/element/real-element/click":
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": value})
+	}))
+}
+
+type fakeEnv struct {
+	*environment.Base
+	address string
+}
+
+func (e *fakeEnv) WDAddress(context.Context) string {
+	return e.address
+}
+
+func newMetadata(t *testing.T, replayOptions map[string]interface{}) *metadata.Metadata {
+	b, err := json.Marshal(map[string]interface{}{
+		"extension": map[string]interface{}{
+			"replayOptions": replayOptions,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := metadata.FromBytes(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// runSession creates a session, navigates, finds an element and clicks it, then quits.
+func runSession(ctx context.Context, t *testing.T, env environment.Env) {
+	wd, err := webdriver.CreateSession(ctx, env.WDAddress(ctx), 1, &capabilities.Capabilities{
+		AlwaysMatch: map[string]interface{}{"browserName": "fake"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := wd.CommandURL("url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(t, url.String(), `{"url": "http://example.com/"}`)
+
+	el, err := wd.FindElement(ctx, webdriver.ByCSSSelector, "button")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(wd.SessionID(), "real") != strings.HasPrefix(el.ID(), "real") {
+		t.Errorf("Got session %q and element %q, want both to come from the same server", wd.SessionID(), el.ID())
+	}
+
+	click, err := wd.CommandURL("element", el.ID(), "click")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(t, click.String(), `{}`)
+
+	if err := wd.Quit(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func post(t *testing.T, url, body string) string {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST %s got status %d: %s", url, resp.StatusCode, b)
+	}
+	return string(b)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	dir, err := bazel.NewTmpDir("TestRecordAndReplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := fakeWebDriver(t)
+	defer server.Close()
+
+	m := newMetadata(t, map[string]interface{}{"record": true, "recordDir": dir})
+	base, err := environment.NewBase("fake", m, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := RecordIfEnabled(&fakeEnv{Base: base, address: server.URL + "/"}, m, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	runSession(ctx, t, env)
+	if err := env.TearDown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	recording := filepath.Join(dir, "webdriver-session-001.jsonl")
+	exchanges, err := readRecording(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// new session, health probe, url, find element, click, quit.
+	if len(exchanges) != 6 {
+		t.Fatalf("Got %d recorded exchanges, want 6", len(exchanges))
+	}
+
+	replayEnv, err := NewEnv(newMetadata(t, map[string]interface{}{"recordings": []string{dir}}), diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replayEnv.SetUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer replayEnv.TearDown(ctx)
+
+	runSession(ctx, t, replayEnv)
+
+	r := replayEnv.(*replay)
+	if n := r.started[0].remaining(); n != 0 {
+		t.Errorf("Got %d commands not replayed, want 0", n)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	ctx := context.Background()
+	dir, err := bazel.NewTmpDir("TestReplayMismatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recording := filepath.Join(dir, "session.jsonl")
+	lines := []string{
+		`{"newSession": true, "sessionId": "abc", "method": "POST", "status": 200, "response": {"value": {"sessionId": "abc", "capabilities": {}}}}`,
+		`{"sessionId": "abc", "method": "GET", "command": "title", "status": 200, "response": {"value": "title"}}`,
+	}
+	if err := ioutil.WriteFile(recording, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := NewEnv(newMetadata(t, map[string]interface{}{"recordings": []string{recording}}), diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer env.TearDown(ctx)
+
+	resp, err := http.Post(env.WDAddress(ctx)+"session", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Post(env.WDAddress(ctx)+"session/replay-session-1/url", "application/json", strings.NewReader(`{"url": "http://example.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Got status %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"replay mismatch",
+		"expected GET /session/{id}/title",
+		"received POST /session/{id}/url",
+		"http://example.com",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Got %s, want mismatch error containing %q", body, want)
+		}
+	}
+}
+
+func TestReplayOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	dir, err := bazel.NewTmpDir("TestReplayOutOfOrder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recording := filepath.Join(dir, "session.jsonl")
+	lines := []string{
+		`{"newSession": true, "sessionId": "abc", "method": "POST", "status": 200, "response": {"value": {"sessionId": "abc", "capabilities": {}}}}`,
+		`{"sessionId": "abc", "method": "POST", "command": "url", "request": {"url": "http://example.com"}, "status": 200, "response": {"value": null}}`,
+		`{"sessionId": "abc", "method": "GET", "command": "title", "status": 200, "response": {"value": "title"}}`,
+	}
+	if err := ioutil.WriteFile(recording, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := NewEnv(newMetadata(t, map[string]interface{}{"recordings": []string{recording}}), diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer env.TearDown(ctx)
+
+	resp, err := http.Post(env.WDAddress(ctx)+"session", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// Both commands were recorded, but the client sends them in the wrong order.
+	resp, err = http.Get(env.WDAddress(ctx) + "session/replay-session-1/title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Got status %d for out of order command, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "expected POST /session/{id}/url"; !strings.Contains(string(body), want) {
+		t.Errorf("Got %s, want mismatch error containing %q", body, want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if a, b := normalize([]byte(`{"b": 1, "a": [1, 2]}`)), normalize([]byte(`{"a":[1,2],"b":1}`)); a != b {
+		t.Errorf("Got %q != %q, want equal", a, b)
+	}
+	if n := normalize([]byte(` {} `)); n != "" {
+		t.Errorf("Got %q for empty object, want empty string", n)
+	}
+}
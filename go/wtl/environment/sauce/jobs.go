@@ -0,0 +1,156 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sauce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/cloud"
+)
+
+const (
+	// DefaultAPIURL is the base URL of the Sauce Labs REST API.
+	DefaultAPIURL = "https://saucelabs.com/rest/v1/"
+	// BuildEnvVar is the environment variable that provides the build ID reported with jobs if
+	// sauceOptions.build is not defined.
+	BuildEnvVar = "SAUCE_BUILD_NAME"
+)
+
+// JobReporter is a cloud.JobReporter that updates Sauce Labs jobs through the REST API. The job is
+// updated with whether the test passed, the test's name, the build ID from sauceOptions.build or
+// BuildEnvVar, and the tags in sauceOptions.tags. sauceOptions.apiUrl overrides APIURL.
+type JobReporter struct {
+	// Client is the HTTP client used to send requests to the REST API. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+	// APIURL is the base URL of the REST API.
+	APIURL string
+}
+
+// jobUpdate is the body of a job update request.
+type jobUpdate struct {
+	Name   string   `json:"name,omitempty"`
+	Passed *bool    `json:"passed,omitempty"`
+	Build  string   `json:"build,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// jobOptions are the options in sauceOptions that configure job reporting.
+type jobOptions struct {
+	apiURL string
+	build  string
+	tags   []string
+}
+
+// extractJobOptions reads sauceOptions.apiUrl, build and tags from options.
+func extractJobOptions(options map[string]interface{}) (jobOptions, error) {
+	var opts jobOptions
+	if a, ok := options["apiUrl"]; ok {
+		as, ok := a.(string)
+		if !ok {
+			return opts, fmt.Errorf("sauceOptions.apiUrl %#v is not a string", a)
+		}
+		opts.apiURL = as
+	}
+	if b, ok := options["build"]; ok {
+		bs, ok := b.(string)
+		if !ok {
+			return opts, fmt.Errorf("sauceOptions.build %#v is not a string", b)
+		}
+		opts.build = bs
+	}
+	if t, ok := options["tags"]; ok {
+		tl, ok := t.([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("sauceOptions.tags %#v is not a list", t)
+		}
+		for _, tag := range tl {
+			ts, ok := tag.(string)
+			if !ok {
+				return opts, fmt.Errorf("sauceOptions.tags element %#v is not a string", tag)
+			}
+			opts.tags = append(opts.tags, ts)
+		}
+	}
+	return opts, nil
+}
+
+// validateJobOptions checks the job reporting options when the environment is created, so that
+// mistakes are not only found at teardown.
+func validateJobOptions(options map[string]interface{}) error {
+	_, err := extractJobOptions(options)
+	return err
+}
+
+// ReportJob updates the Sauce Labs job for sessionID.
+func (r *JobReporter) ReportJob(ctx context.Context, p cloud.Params, sessionID string, job cloud.Job) error {
+	opts, err := extractJobOptions(p.Options)
+	if err != nil {
+		return err
+	}
+
+	update := jobUpdate{
+		Name:   job.Name,
+		Passed: job.Passed,
+		Build:  opts.build,
+		Tags:   opts.tags,
+	}
+	if update.Build == "" {
+		update.Build = os.Getenv(BuildEnvVar)
+	}
+
+	apiURL := r.APIURL
+	if opts.apiURL != "" {
+		apiURL = opts.apiURL
+	}
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(apiURL, "/") + "/" + url.PathEscape(p.Username) + "/jobs/" + url.PathEscape(sessionID)
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(p.Username, p.AccessKey)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("PUT %s returned %s: %s", req.URL.Path, resp.Status, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sauce
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/cloud"
+)
+
+// fakeAPI records job updates sent to it.
+type fakeAPI struct {
+	*httptest.Server
+	mu      sync.Mutex
+	status  int
+	updates map[string]jobUpdate
+	auth    string
+}
+
+func newFakeAPI(status int) *fakeAPI {
+	a := &fakeAPI{status: status, updates: map[string]jobUpdate{}}
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var update jobUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, key, _ := r.BasicAuth()
+		a.auth = user + ":" + key
+		a.updates[r.URL.Path] = update
+		w.WriteHeader(a.status)
+	}))
+	return a
+}
+
+func TestReportJob(t *testing.T) {
+	t.Setenv(BuildEnvVar, "build-42")
+	api := newFakeAPI(http.StatusOK)
+	defer api.Close()
+
+	r := &JobReporter{Client: api.Client(), APIURL: api.URL + "/rest/v1/"}
+	passed := true
+	p := cloud.Params{
+		Credentials: cloud.Credentials{Username: "user", AccessKey: "key"},
+		Options:     map[string]interface{}{"tags": []interface{}{"nightly", "chrome"}},
+	}
+	if err := r.ReportJob(context.Background(), p, "abc123", cloud.Job{Name: "//test:test_chrome", Passed: &passed}); err != nil {
+		t.Fatal(err)
+	}
+
+	update, ok := api.updates["/rest/v1/user/jobs/abc123"]
+	if !ok {
+		t.Fatalf("got updates %v, want update for /rest/v1/user/jobs/abc123", api.updates)
+	}
+	if update.Name != "//test:test_chrome" || update.Passed == nil || !*update.Passed || update.Build != "build-42" {
+		t.Errorf("got update %+v, want name //test:test_chrome, passed true, build build-42", update)
+	}
+	if len(update.Tags) != 2 || update.Tags[0] != "nightly" || update.Tags[1] != "chrome" {
+		t.Errorf("got tags %v, want [nightly chrome]", update.Tags)
+	}
+	if api.auth != "user:key" {
+		t.Errorf("got credentials %q, want %q", api.auth, "user:key")
+	}
+}
+
+func TestReportJobError(t *testing.T) {
+	api := newFakeAPI(http.StatusNotFound)
+	defer api.Close()
+
+	r := &JobReporter{Client: api.Client(), APIURL: api.URL}
+	if err := r.ReportJob(context.Background(), cloud.Params{}, "abc123", cloud.Job{}); err == nil {
+		t.Error("got nil error for 404 response, want error")
+	}
+}
+
+func TestTearDownReportsJobs(t *testing.T) {
+	api := newFakeAPI(http.StatusOK)
+	defer api.Close()
+
+	vendor := *Vendor
+	vendor.Jobs = &JobReporter{Client: api.Client(), APIURL: DefaultAPIURL}
+
+	testCases := []struct {
+		name       string
+		exitStatus int
+		apiURL     string
+		wantPassed bool
+		wantWarn   bool
+	}{
+		{name: "passed", exitStatus: 0, apiURL: api.URL, wantPassed: true},
+		{name: "failed", exitStatus: 3, apiURL: api.URL, wantPassed: false},
+		{name: "api unavailable", exitStatus: 0, apiURL: "http://localhost:0", wantWarn: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, err := metadata.FromBytes([]byte(`{
+				"label": "//test:`+tc.name+`",
+				"extension": {"sauceOptions": {"username": "user", "accessKey": "key", "build": "b1", "apiUrl": "`+tc.apiURL+`"}}
+			}`), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := diagnostics.NewRecorder()
+			env, err := cloud.NewEnv(&vendor, m, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := env.SetUp(ctx); err != nil {
+				t.Fatal(err)
+			}
+			environment.NotifySessionCreated(ctx, env, 1, "session-"+tc.name)
+			environment.NotifyTestFinished(ctx, env, tc.exitStatus)
+			if err := env.TearDown(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.wantWarn {
+				if len(d.Warnings()) != 1 {
+					t.Errorf("got warnings %v, want 1", d.Warnings())
+				}
+				return
+			}
+			if len(d.Warnings()) != 0 {
+				t.Errorf("got warnings %v, want none", d.Warnings())
+			}
+			api.mu.Lock()
+			update, ok := api.updates["/user/jobs/session-"+tc.name]
+			api.mu.Unlock()
+			if !ok {
+				t.Fatalf("job for session-%s was not updated", tc.name)
+			}
+			if update.Passed == nil || *update.Passed != tc.wantPassed {
+				t.Errorf("got passed %v, want %v", update.Passed, tc.wantPassed)
+			}
+			if update.Name != "//test:"+tc.name || update.Build != "b1" {
+				t.Errorf("got update %+v, want name //test:%s and build b1", update, tc.name)
+			}
+		})
+	}
+}
+
+func TestNewEnvRejectsInvalidJobOptions(t *testing.T) {
+	for _, opts := range []string{
+		`{"apiUrl": 1}`,
+		`{"build": 2}`,
+		`{"tags": "smoke"}`,
+		`{"tags": ["smoke", 3]}`,
+	} {
+		m, err := metadata.FromBytes([]byte(`{"extension": {"sauceOptions": `+opts+`}}`), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewEnv(m, diagnostics.NoOP()); err == nil {
+			t.Errorf("got nil error from NewEnv for sauceOptions %s, want error", opts)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+const (
+	// caFile is the name of the file the generated CA certificate is written to.
+	caFile = "network-proxy-ca.pem"
+	// localEnvironment is the only environment whose browsers run on this machine and can reach a
+	// Proxy listening on localhost.
+	localEnvironment = "local"
+)
+
+// env wraps an environment.Env and routes the traffic of each browser session through its own Proxy.
+type env struct {
+	environment.Env
+	diagnostics diagnostics.Diagnostics
+	ca          *CA
+	harDir      string
+
+	mu      sync.Mutex
+	proxies map[int]*Proxy
+}
+
+// A sessionProxies provides the Proxy used by a session.
+type sessionProxies interface {
+	ProxyForSession(id int) (*Proxy, bool)
+}
+
+// WrapIfEnabled wraps env so that each session's browser is configured to send its traffic through
+// an intercepting proxy if networkProxy.enabled is set in m. Otherwise env is returned unchanged.
+// All requests and responses are logged, and a HAR file per session is written to test outputs.
+// Proxies listen on localhost, so networkProxy.enabled is rejected for every environment other
+// than the local one, whose browsers would not be able to reach them.
+func WrapIfEnabled(e environment.Env, m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error) {
+	opts, err := extractOptions(m)
+	if err != nil {
+		return nil, errors.New(compName, err)
+	}
+	if !opts.enabled {
+		return e, nil
+	}
+	if m.Environment != localEnvironment {
+		return nil, errors.New(compName, fmt.Errorf("networkProxy.enabled is only supported in the %s environment; browsers in the %q environment cannot reach a proxy on localhost", localEnvironment, m.Environment))
+	}
+
+	dir := opts.harDir
+	if dir == "" {
+		dir = bazel.TestUndeclaredOutputsDir()
+	}
+
+	var ca *CA
+	if opts.mitm {
+		ca, err = NewCA()
+		if err != nil {
+			return nil, errors.New(compName, err)
+		}
+	}
+
+	return &env{
+		Env:         e,
+		diagnostics: d,
+		ca:          ca,
+		harDir:      dir,
+		proxies:     map[int]*Proxy{},
+	}, nil
+}
+
+// SessionCreated passes the WebDriver session ID on to the wrapped environment.
+func (e *env) SessionCreated(ctx context.Context, id int, sessionID string) {
+	environment.NotifySessionCreated(ctx, e.Env, id, sessionID)
+}
+
+// TestFinished passes the exit status of the test on to the wrapped environment.
+func (e *env) TestFinished(ctx context.Context, exitStatus int) {
+	environment.NotifyTestFinished(ctx, e.Env, exitStatus)
+}
+
+// ForSession returns the Proxy used by session id if e routes browser traffic through a Proxy.
+func ForSession(e environment.Env, id int) (*Proxy, bool) {
+	sp, ok := e.(sessionProxies)
+	if !ok {
+		return nil, false
+	}
+	return sp.ProxyForSession(id)
+}
+
+// SetUp writes the CA certificate to test outputs and sets up the wrapped environment.
+func (e *env) SetUp(ctx context.Context) error {
+	if err := os.MkdirAll(e.harDir, 0755); err != nil {
+		return errors.New(compName, err)
+	}
+	if e.ca != nil {
+		if err := ioutil.WriteFile(filepath.Join(e.harDir, caFile), e.ca.CertPEM(), 0644); err != nil {
+			return errors.New(compName, err)
+		}
+	}
+	return e.Env.SetUp(ctx)
+}
+
+// StartSession starts a Proxy for the session and adds it to the session's capabilities, then
+// starts the session in the wrapped environment. Sessions that can be reused are refused, as their
+// browsers would outlive the Proxy, which is stopped with the session.
+func (e *env) StartSession(ctx context.Context, id int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	if hasProxy(caps) {
+		e.diagnostics.Warning(errors.New(compName, fmt.Errorf("session %d already specifies a proxy; its traffic will not be intercepted", id)))
+		return e.Env.StartSession(ctx, id, caps)
+	}
+
+	p, err := New(e.ca)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := map[string]interface{}{
+		"proxy": map[string]interface{}{
+			"proxyType": "manual",
+			"httpProxy": p.Address,
+			"sslProxy":  p.Address,
+		},
+	}
+	if e.ca != nil {
+		extra["acceptInsecureCerts"] = true
+	}
+
+	newCaps, err := e.Env.StartSession(ctx, id, caps.MergeOver(extra))
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	if capabilities.CanReuseSession(newCaps) {
+		if err := e.Env.StopSession(ctx, id); err != nil {
+			e.diagnostics.Warning(errors.New(compName, err))
+		}
+		p.Close()
+		return nil, errors.New(compName, "networkProxy.enabled cannot be used with google:canReuseSession")
+	}
+
+	e.mu.Lock()
+	e.proxies[id] = p
+	e.mu.Unlock()
+
+	return newCaps, nil
+}
+
+// StopSession stops the session in the wrapped environment, then writes the session's HAR file
+// and stops its Proxy.
+func (e *env) StopSession(ctx context.Context, id int) error {
+	err := e.Env.StopSession(ctx, id)
+
+	e.mu.Lock()
+	p, ok := e.proxies[id]
+	delete(e.proxies, id)
+	e.mu.Unlock()
+
+	if ok {
+		e.closeProxy(id, p)
+	}
+
+	return err
+}
+
+// TearDown stops any remaining proxies and tears down the wrapped environment.
+func (e *env) TearDown(ctx context.Context) error {
+	e.mu.Lock()
+	proxies := e.proxies
+	e.proxies = map[int]*Proxy{}
+	e.mu.Unlock()
+
+	for id, p := range proxies {
+		e.closeProxy(id, p)
+	}
+
+	return e.Env.TearDown(ctx)
+}
+
+// ProxyForSession returns the Proxy used by session id.
+func (e *env) ProxyForSession(id int) (*Proxy, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.proxies[id]
+	return p, ok
+}
+
+func (e *env) closeProxy(id int, p *Proxy) {
+	if err := e.writeHAR(id, p); err != nil {
+		e.diagnostics.Warning(errors.New(compName, err))
+	}
+	if err := p.Close(); err != nil {
+		e.diagnostics.Warning(errors.New(compName, err))
+	}
+}
+
+func (e *env) writeHAR(id int, p *Proxy) error {
+	f, err := os.Create(filepath.Join(e.harDir, fmt.Sprintf("network-session-%03d.har", id)))
+	if err != nil {
+		return err
+	}
+	if err := p.WriteHAR(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func hasProxy(caps *capabilities.Capabilities) bool {
+	if caps == nil {
+		return false
+	}
+	if _, ok := caps.AlwaysMatch["proxy"]; ok {
+		return true
+	}
+	for _, fm := range caps.FirstMatch {
+		if _, ok := fm["proxy"]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBodyText is the number of bytes of a request or response body that are included in a HAR
+// entry. Longer bodies are truncated.
+const maxBodyText = 1 << 20
+
+// capturedBody is the start of a request or response body, and the size of the whole body.
+type capturedBody struct {
+	data []byte
+	size int
+}
+
+// HAR is the root of a HTTP Archive 1.2 document.
+// See http://www.softwareishard.com/blog/har-12-spec/.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log object of a HAR document.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application that created a HAR document.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request/response pair.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest describes a request in a HAR entry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse describes a response in a HAR entry.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a name/value pair used for headers, cookies and query parameters.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData describes the body of a request.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent describes the body of a response.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings describes the time spent in each phase of a request, in milliseconds.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHAR(entries []HAREntry) *HAR {
+	if entries == nil {
+		entries = []HAREntry{}
+	}
+	return &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "Web Test Launcher", Version: "1.0"},
+			Entries: entries,
+		},
+	}
+}
+
+func newHAREntry(req *http.Request, reqBody capturedBody, resp *http.Response, respBody capturedBody, start time.Time, d time.Duration) HAREntry {
+	ms := float64(d) / float64(time.Millisecond)
+
+	entry := HAREntry{
+		StartedDateTime: start,
+		Time:            ms,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     harCookies(req.Cookies()),
+			Headers:     harHeaders(req.Header),
+			QueryString: harQuery(req.URL.Query()),
+			HeadersSize: -1,
+			BodySize:    reqBody.size,
+		},
+		Timings: HARTimings{Wait: ms},
+	}
+
+	if reqBody.size != 0 {
+		text, _ := bodyText(reqBody.data)
+		entry.Request.PostData = &HARPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+			Comment:  truncation(reqBody),
+		}
+	}
+
+	if resp == nil {
+		entry.Response = HARResponse{
+			Cookies: []HARNameValue{},
+			Headers: []HARNameValue{},
+		}
+		return entry
+	}
+
+	text, encoding := bodyText(respBody.data)
+	entry.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		Content: HARContent{
+			Size:     respBody.size,
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+			Comment:  truncation(respBody),
+		},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    respBody.size,
+	}
+	return entry
+}
+
+// bodyText returns the text to include in a HAR entry for body, and the encoding used, if any.
+// A character split by truncating the body to maxBodyText bytes is dropped.
+func bodyText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	if len(body) == maxBodyText {
+		for i := len(body) - 1; i >= 0 && i >= len(body)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(body[i]) {
+				if utf8.Valid(body[:i]) {
+					return string(body[:i]), ""
+				}
+				break
+			}
+		}
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// truncation returns a comment noting that body was truncated, or the empty string if it was not.
+func truncation(body capturedBody) string {
+	if body.size <= len(body.data) {
+		return ""
+	}
+	return fmt.Sprintf("truncated to the first %d of %d bytes", len(body.data), body.size)
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	nvs := []HARNameValue{}
+	for k, vs := range h {
+		for _, v := range vs {
+			nvs = append(nvs, HARNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(nvs, func(i, j int) bool { return nvs[i].Name < nvs[j].Name })
+	return nvs
+}
+
+func harQuery(q url.Values) []HARNameValue {
+	nvs := []HARNameValue{}
+	for k, vs := range q {
+		for _, v := range vs {
+			nvs = append(nvs, HARNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(nvs, func(i, j int) bool { return nvs[i].Name < nvs[j].Name })
+	return nvs
+}
+
+func harCookies(cs []*http.Cookie) []HARNameValue {
+	nvs := []HARNameValue{}
+	for _, c := range cs {
+		nvs = append(nvs, HARNameValue{Name: c.Name, Value: c.Value})
+	}
+	return nvs
+}
@@ -0,0 +1,452 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+func newClient(t *testing.T, p *Proxy, ca *CA) *http.Client {
+	t.Helper()
+	u, err := url.Parse("http://" + p.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &http.Transport{Proxy: http.ProxyURL(u)}
+	if ca != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: ca.CertPool()}
+	}
+	return &http.Client{Transport: transport}
+}
+
+func TestProxyHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello " + r.URL.Query().Get("name")))
+	}))
+	defer backend.Close()
+
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	resp, err := newClient(t, p, nil).Get(backend.URL + "/greet?name=world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "hello world" {
+		t.Errorf("got body %q, want %q", body, "hello world")
+	}
+
+	har := p.HAR()
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("got %d HAR entries, want 1", len(har.Log.Entries))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.URL != backend.URL+"/greet?name=world" {
+		t.Errorf("got request URL %q, want %q", entry.Request.URL, backend.URL+"/greet?name=world")
+	}
+	if entry.Response.Status != http.StatusOK || entry.Response.Content.Text != "hello world" {
+		t.Errorf("got response %+v, want status 200 and text %q", entry.Response, "hello world")
+	}
+}
+
+func TestProxyHTTPS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer backend.Close()
+
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.transport.TLSClientConfig = backend.Client().Transport.(*http.Transport).TLSClientConfig
+
+	client := newClient(t, p, ca)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(backend.URL + "/data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "secret" {
+			t.Errorf("got body %q, want %q", body, "secret")
+		}
+	}
+
+	har := p.HAR()
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("got %d HAR entries, want 2", len(har.Log.Entries))
+	}
+	if got, want := har.Log.Entries[0].Request.URL, backend.URL+"/data"; got != want {
+		t.Errorf("got request URL %q, want %q", got, want)
+	}
+}
+
+func TestProxyInterceptor(t *testing.T) {
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetInterceptor(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTeapot,
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       ioutil.NopCloser(strings.NewReader("stubbed")),
+		}, nil
+	})
+
+	resp, err := newClient(t, p, nil).Get("http://backend.invalid/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTeapot || string(body) != "stubbed" {
+		t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, http.StatusTeapot, "stubbed")
+	}
+}
+
+func TestProxyUpstreamError(t *testing.T) {
+	// Find a port with nothing listening on it.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	resp, err := newClient(t, p, nil).Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+}
+
+func TestProxyInterceptorError(t *testing.T) {
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetInterceptor(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("failed by interceptor")
+	})
+
+	resp, err := newClient(t, p, nil).Get("http://backend.invalid/")
+	if err == nil {
+		resp.Body.Close()
+		t.Errorf("got status %d, want the connection dropped", resp.StatusCode)
+	}
+}
+
+func TestReusableSessionsRefused(t *testing.T) {
+	fake := &fakeEnv{}
+	e := &env{
+		Env:         fake,
+		diagnostics: diagnostics.NoOP(),
+		proxies:     map[int]*Proxy{},
+	}
+
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{"google:canReuseSession": true}}
+	if _, err := e.StartSession(context.Background(), 1, caps); err == nil {
+		t.Error("got nil error starting a reusable session, want error")
+	}
+	if _, ok := ForSession(e, 1); ok {
+		t.Error("got proxy for refused session 1")
+	}
+}
+
+type fakeEnv struct {
+	environment.Env
+	caps *capabilities.Capabilities
+}
+
+func (f *fakeEnv) SetUp(context.Context) error    { return nil }
+func (f *fakeEnv) TearDown(context.Context) error { return nil }
+
+func (f *fakeEnv) StartSession(_ context.Context, _ int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	f.caps = caps
+	return caps, nil
+}
+
+func (f *fakeEnv) StopSession(context.Context, int) error {
+	return nil
+}
+
+func TestWrapIfEnabled(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir(bazel.TestTmpDir(), "netproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := &fakeEnv{}
+
+	unwrapped, err := WrapIfEnabled(fake, &metadata.Metadata{}, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unwrapped != fake {
+		t.Error("got wrapped env when networkProxy is not enabled")
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"environment": "local",
+		"extension": map[string]interface{}{
+			"networkProxy": map[string]interface{}{
+				"enabled": true,
+				"harDir":  dir,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := metadata.FromBytes(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := WrapIfEnabled(fake, m, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.StartSession(ctx, 1, &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{"browserName": "chrome"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := ForSession(e, 1)
+	if !ok {
+		t.Fatal("got no proxy for session 1")
+	}
+	proxy, _ := fake.caps.AlwaysMatch["proxy"].(map[string]interface{})
+	if proxy["httpProxy"] != p.Address || proxy["sslProxy"] != p.Address {
+		t.Errorf("got proxy capability %v, want httpProxy and sslProxy %q", proxy, p.Address)
+	}
+	if fake.caps.AlwaysMatch["acceptInsecureCerts"] != true {
+		t.Error("got acceptInsecureCerts not true")
+	}
+
+	if err := e.StopSession(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.TearDown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "network-session-001.har"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	har := &HAR{}
+	if err := json.Unmarshal(data, har); err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" {
+		t.Errorf("got HAR version %q, want 1.2", har.Log.Version)
+	}
+	if _, err := os.Stat(filepath.Join(dir, caFile)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWrapIfEnabledRejectsRemoteEnvironments(t *testing.T) {
+	for _, name := range []string{"sauce", "grid", "external"} {
+		m, err := metadata.FromBytes([]byte(`{
+			"environment": "`+name+`",
+			"extension": {"networkProxy": {"enabled": true}}
+		}`), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := WrapIfEnabled(&fakeEnv{}, m, diagnostics.NoOP()); err == nil {
+			t.Errorf("got nil error enabling networkProxy in the %s environment, want error", name)
+		}
+	}
+}
+
+func TestProxyStreamsResponses(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "data: second\n\n")
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	resp, err := newClient(t, p, nil).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "data: first\n" {
+		t.Errorf("got %q, want the first event before the stream ends", line)
+	}
+}
+
+func TestProxyTruncatesLargeBodiesInHAR(t *testing.T) {
+	size := maxBodyText + 100
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", size)))
+	}))
+	defer backend.Close()
+
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	resp, err := newClient(t, p, nil).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != size {
+		t.Fatalf("got %d bytes, want %d", len(body), size)
+	}
+
+	har := p.HAR()
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("got %d HAR entries, want 1", len(har.Log.Entries))
+	}
+	content := har.Log.Entries[0].Response.Content
+	if content.Size != size || len(content.Text) != maxBodyText || content.Comment == "" {
+		t.Errorf("got content size %d with %d bytes of text and comment %q, want size %d truncated to %d bytes", content.Size, len(content.Text), content.Comment, size, maxBodyText)
+	}
+}
+
+func TestProxyTunnelsUpgrades(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		io.Copy(conn, brw)
+	}))
+	defer backend.Close()
+
+	p, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	conn, err := net.Dial("tcp", p.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET "+backend.URL+"/ HTTP/1.1\r\nHost: "+strings.TrimPrefix(backend.URL, "http://")+"\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	io.WriteString(conn, "ping\n")
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "ping\n" {
+		t.Errorf("got %q echoed through the upgraded connection, want %q", line, "ping\n")
+	}
+}
+
+func TestBodyTextDropsSplitCharacter(t *testing.T) {
+	body := []byte(strings.Repeat("x", maxBodyText-1) + "é")[:maxBodyText]
+	text, encoding := bodyText(body)
+	if encoding != "" || text != strings.Repeat("x", maxBodyText-1) {
+		t.Errorf("got %d bytes of text with encoding %q, want the body without the split character", len(text), encoding)
+	}
+}
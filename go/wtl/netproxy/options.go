@@ -0,0 +1,75 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"fmt"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+)
+
+// networkProxyOptions is the set of options that can be defined in the networkProxy section of
+// a Metadata.Extension field.
+type networkProxyOptions struct {
+	// Whether to route browser traffic through an intercepting proxy. Defaults to false. Only
+	// supported in the local environment, as the proxy listens on localhost. Sessions with
+	// google:canReuseSession cannot be started while this is enabled.
+	enabled bool
+	// Whether HTTPS traffic should be decrypted using a generated CA. If false, HTTPS traffic is
+	// tunneled and only the CONNECT requests are logged. Defaults to true.
+	mitm bool
+	// The directory HAR files are written to. If not defined, uses TEST_UNDECLARED_OUTPUTS_DIR.
+	harDir string
+}
+
+func extractOptions(m *metadata.Metadata) (networkProxyOptions, error) {
+	opts := networkProxyOptions{mitm: true}
+
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return opts, nil
+	}
+
+	npMap, ok := extMap["networkProxy"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+
+	if e, ok := npMap["enabled"]; ok {
+		eb, ok := e.(bool)
+		if !ok {
+			return opts, fmt.Errorf("networkProxy.enabled %#v is not a boolean", e)
+		}
+		opts.enabled = eb
+	}
+
+	if m, ok := npMap["mitm"]; ok {
+		mb, ok := m.(bool)
+		if !ok {
+			return opts, fmt.Errorf("networkProxy.mitm %#v is not a boolean", m)
+		}
+		opts.mitm = mb
+	}
+
+	if d, ok := npMap["harDir"]; ok {
+		ds, ok := d.(string)
+		if !ok {
+			return opts, fmt.Errorf("networkProxy.harDir %#v is not a string", d)
+		}
+		opts.harDir = ds
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,541 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netproxy provides an intercepting HTTP/HTTPS forward proxy for browser network traffic.
+package netproxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+)
+
+const compName = "Network Proxy"
+
+// hopHeaders are the headers that apply to a single connection and must not be forwarded. Connection
+// and Upgrade are restored for requests that upgrade the connection, e.g. to a WebSocket.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// An Interceptor is consulted for every request sent through a Proxy. If it returns a non-nil
+// response, that response is returned to the browser instead of forwarding the request. If it
+// returns an error, the browser's connection is dropped. If it returns nil, nil, the request is
+// forwarded unchanged. An Interceptor must not read the request body, which is streamed to the
+// upstream server.
+type Interceptor func(*http.Request) (*http.Response, error)
+
+// droppedError is returned by roundTrip when an Interceptor fails a request. Unlike errors
+// reaching the upstream server, which are returned to the browser as 502 Bad Gateway, these
+// drop the browser's connection.
+type droppedError struct {
+	error
+}
+
+// Proxy is an HTTP forward proxy that logs all traffic through it and records it as a HAR.
+type Proxy struct {
+	// Address is the host:port the browser should use to reach this proxy.
+	Address   string
+	ca        *CA
+	listener  net.Listener
+	server    *http.Server
+	transport *http.Transport
+
+	mu          sync.Mutex
+	entries     []HAREntry
+	interceptor Interceptor
+}
+
+// New creates and starts a new Proxy listening on an unused port of localhost. If ca is not nil,
+// HTTPS traffic is decrypted using certificates issued by ca, otherwise it is tunneled unexamined.
+func New(ca *CA) (*Proxy, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, errors.New(compName, err)
+	}
+
+	p := &Proxy{
+		Address:  net.JoinHostPort("localhost", strconv.Itoa(l.Addr().(*net.TCPAddr).Port)),
+		ca:       ca,
+		listener: l,
+		transport: &http.Transport{
+			Proxy:              nil,
+			DisableCompression: true,
+		},
+	}
+	p.server = &http.Server{Handler: p}
+
+	go func() {
+		if err := p.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Print(errors.New(compName, err))
+		}
+	}()
+
+	return p, nil
+}
+
+// SetInterceptor sets the Interceptor consulted for every request, replacing any previously set.
+// A nil Interceptor forwards all requests unchanged.
+func (p *Proxy) SetInterceptor(i Interceptor) {
+	p.mu.Lock()
+	p.interceptor = i
+	p.mu.Unlock()
+}
+
+// HAR returns a HAR of all traffic through this proxy so far.
+func (p *Proxy) HAR() *HAR {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := make([]HAREntry, len(p.entries))
+	copy(entries, p.entries)
+	return newHAR(entries)
+}
+
+// WriteHAR writes a HAR of all traffic through this proxy so far to w.
+func (p *Proxy) WriteHAR(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p.HAR())
+}
+
+// Close stops the proxy, closing any open connections.
+func (p *Proxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, fmt.Sprintf("%s only accepts proxy requests", compName), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := p.roundTrip(r)
+	if _, ok := err.(droppedError); ok {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		p.handleUpgrade(w, r, resp)
+		return
+	}
+
+	for k, vs := range resp.Header {
+		w.Header()[k] = vs
+	}
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+	copyFlushing(w, resp.Body)
+}
+
+// handleUpgrade passes the 101 Switching Protocols response resp on to the browser, then tunnels
+// the upgraded connection, e.g. a WebSocket, to the upstream server.
+func (p *Proxy) handleUpgrade(w http.ResponseWriter, r *http.Request, resp *http.Response) {
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(w, "upgraded response body is not writable", http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be hijacked", http.StatusInternalServerError)
+		return
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+
+	resp.Body = nil
+	if err := resp.Write(brw); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	log.Printf("[%s] %s %s upgraded to %s", compName, r.Method, r.URL, resp.Header.Get("Upgrade"))
+	tunnel(bufferedConn{Conn: conn, r: brw.Reader}, upstream)
+}
+
+func (p *Proxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be hijacked", http.StatusInternalServerError)
+		return
+	}
+
+	if p.ca == nil {
+		upstream, err := net.DialTimeout("tcp", r.Host, 30*time.Second)
+		if err != nil {
+			log.Printf("[%s] CONNECT %s failed: %v", compName, r.Host, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		log.Printf("[%s] CONNECT %s", compName, r.Host)
+		io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		go tunnel(conn, upstream)
+		return
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return p.ca.CertFor(name)
+		},
+	})
+	defer tlsConn.Close()
+
+	if err := tlsConn.Handshake(); err != nil {
+		log.Printf("[%s] TLS handshake for %s failed: %v", compName, r.Host, err)
+		return
+	}
+
+	reader := bufio.NewReader(tlsConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[%s] error reading request from %s: %v", compName, r.Host, err)
+			}
+			return
+		}
+		req.URL.Scheme = "https"
+		req.URL.Host = r.Host
+
+		resp, err := p.roundTrip(req)
+		if _, ok := err.(droppedError); ok {
+			return
+		}
+		if err != nil {
+			resp = badGateway(req, err)
+		}
+
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			upstream, ok := resp.Body.(io.ReadWriteCloser)
+			if !ok {
+				resp.Body.Close()
+				return
+			}
+			resp.Body = nil
+			if err := resp.Write(tlsConn); err != nil {
+				upstream.Close()
+				return
+			}
+			log.Printf("[%s] %s %s upgraded to %s", compName, req.Method, req.URL, resp.Header.Get("Upgrade"))
+			tunnel(bufferedConn{Conn: tlsConn, r: reader}, upstream)
+			return
+		}
+
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+		if resp.ContentLength < 0 && len(resp.TransferEncoding) == 0 {
+			resp.TransferEncoding = []string{"chunked"}
+		}
+		err = resp.Write(tlsConn)
+		resp.Body.Close()
+		// Closing the request body discards any of it that was not sent upstream, so that the next
+		// request can be read.
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+		if req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+// roundTrip sends req upstream, or to the interceptor. The request and response bodies are
+// streamed through; the exchange is logged and recorded once the response body has been read or
+// closed, with at most maxBodyText bytes of each body. If the upstream server switches protocols,
+// the returned response's Body is the upgraded connection, which is not recorded.
+func (p *Proxy) roundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	upgrade := upgradeType(req.Header)
+	reqBody := &capture{}
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	if req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0 {
+		reqBody.ReadCloser = req.Body
+		out.Body = reqBody
+	} else {
+		out.Body = nil
+	}
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	if upgrade != "" {
+		out.Header.Set("Connection", "Upgrade")
+		out.Header.Set("Upgrade", upgrade)
+	}
+
+	p.mu.Lock()
+	interceptor := p.interceptor
+	p.mu.Unlock()
+
+	var resp *http.Response
+	var err error
+	comment := ""
+	if interceptor != nil {
+		resp, err = interceptor(out)
+		if resp != nil || err != nil {
+			comment = "intercepted"
+		}
+		if err != nil {
+			err = droppedError{err}
+		}
+	}
+	if resp == nil && err == nil {
+		resp, err = p.transport.RoundTrip(out)
+	}
+
+	if err != nil {
+		d := time.Since(start)
+		log.Printf("[%s] %s %s failed after %v: %v", compName, req.Method, req.URL, d, err)
+		entry := newHAREntry(out, reqBody.captured(), nil, capturedBody{}, start, d)
+		entry.Comment = err.Error()
+		p.record(entry)
+		return nil, err
+	}
+
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	} else if resp.ContentLength == 0 && resp.Body != http.NoBody {
+		// As for Response.Write, a zero ContentLength with a body means its length is unknown.
+		resp.ContentLength = -1
+	}
+	if resp.ProtoMajor == 0 {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	respUpgrade := upgradeType(resp.Header)
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	resp.Header.Del("Content-Length")
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		resp.Header.Set("Connection", "Upgrade")
+		resp.Header.Set("Upgrade", respUpgrade)
+		d := time.Since(start)
+		log.Printf("[%s] %s %s -> %d (%v)", compName, req.Method, req.URL, resp.StatusCode, d)
+		entry := newHAREntry(out, reqBody.captured(), resp, capturedBody{}, start, d)
+		entry.Comment = fmt.Sprintf("upgraded to %s; traffic after the upgrade is not recorded", respUpgrade)
+		p.record(entry)
+		return resp, nil
+	}
+
+	respBody := &capture{ReadCloser: resp.Body}
+	respBody.done = func() {
+		d := time.Since(start)
+		body := respBody.captured()
+		log.Printf("[%s] %s %s -> %d (%d bytes, %v)", compName, req.Method, req.URL, resp.StatusCode, body.size, d)
+		entry := newHAREntry(out, reqBody.captured(), resp, body, start, d)
+		entry.Comment = comment
+		p.record(entry)
+	}
+	resp.Body = respBody
+	return resp, nil
+}
+
+// badGateway returns a 502 Bad Gateway response to req explaining that it failed with err.
+func badGateway(req *http.Request, err error) *http.Response {
+	body := err.Error() + "\n"
+	return &http.Response{
+		Status:        "502 Bad Gateway",
+		StatusCode:    http.StatusBadGateway,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func (p *Proxy) record(entry HAREntry) {
+	p.mu.Lock()
+	p.entries = append(p.entries, entry)
+	p.mu.Unlock()
+}
+
+// upgradeType returns the protocol that h asks to upgrade the connection to, or the empty string.
+func upgradeType(h http.Header) string {
+	for _, v := range h["Connection"] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), "upgrade") {
+				return h.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+// capture passes a body through, keeping a copy of its first maxBodyText bytes for the HAR. done,
+// if set, is called once the body has been read to the end or closed.
+type capture struct {
+	io.ReadCloser
+	done func()
+
+	mu   sync.Mutex
+	data []byte
+	size int
+	once sync.Once
+}
+
+func (c *capture) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.mu.Lock()
+	c.size += n
+	if room := maxBodyText - len(c.data); room > 0 {
+		if room > n {
+			room = n
+		}
+		c.data = append(c.data, b[:room]...)
+	}
+	c.mu.Unlock()
+	if err == io.EOF {
+		c.finish()
+	}
+	return n, err
+}
+
+func (c *capture) Close() error {
+	err := c.ReadCloser.Close()
+	c.finish()
+	return err
+}
+
+func (c *capture) finish() {
+	if c.done != nil {
+		c.once.Do(c.done)
+	}
+}
+
+// captured returns the part of the body captured so far.
+func (c *capture) captured() capturedBody {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return capturedBody{data: c.data, size: c.size}
+}
+
+// copyFlushing copies src to w, flushing after each write so that streamed responses, e.g.
+// server-sent events, reach the browser as they arrive.
+func copyFlushing(w http.ResponseWriter, src io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// bufferedConn is a connection whose reads go through a bufio.Reader that may already hold data
+// read from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// tunnel copies data between a and b until either side is closed, then closes both.
+func tunnel(a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	copyConn := func(dst, src io.ReadWriteCloser) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go copyConn(a, b)
+	go copyConn(b, a)
+	<-done
+	a.Close()
+	b.Close()
+}
@@ -0,0 +1,291 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accesslog writes a JSON Lines log of every request handled by the WTL proxy. Each line
+// records when the request arrived, the WebDriver session it belongs to, the method, path,
+// status, latency and sizes, and the start of the request and response bodies. Screenshots are
+// removed and secrets such as Sauce credentials and cookie values are redacted before bodies are
+// written. The log is configured by the accessLog section of a Metadata.Extension field, e.g.:
+//
+//	"accessLog": {
+//	  "enabled": true,
+//	  "dir": "/tmp/logs",
+//	  "maxBodyBytes": 4096,
+//	  "redactKeys": ["apiKey"],
+//	  "redactPatterns": ["Bearer [A-Za-z0-9._-]+"]
+//	}
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/websocket"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+const (
+	compName = "Access Log"
+	// FileName is the name of the access log file.
+	FileName = "wtl-access-log.jsonl"
+
+	// maxCaptureBytes bounds how much of each body is held in memory for redaction.
+	maxCaptureBytes = 1 << 20
+)
+
+// Entry is a single line of the access log.
+type Entry struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Session       string    `json:"session,omitempty"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	LatencyMillis float64   `json:"latencyMillis"`
+	RequestBytes  int64     `json:"requestBytes"`
+	ResponseBytes int64     `json:"responseBytes"`
+	RequestBody   string    `json:"requestBody,omitempty"`
+	ResponseBody  string    `json:"responseBody,omitempty"`
+}
+
+// Log writes access log entries to a file.
+type Log struct {
+	diagnostics  diagnostics.Diagnostics
+	redactor     *redactor
+	maxBodyBytes int
+
+	mu     sync.Mutex
+	file   *os.File
+	failed bool
+}
+
+// New creates the access log configured by m. It returns nil if the access log is disabled.
+func New(m *metadata.Metadata, d diagnostics.Diagnostics) (*Log, error) {
+	opts, err := extractOptions(m)
+	if err != nil {
+		return nil, errors.New(compName, err)
+	}
+	if !opts.enabled {
+		return nil, nil
+	}
+
+	dir := opts.dir
+	if dir == "" {
+		dir = bazel.TestUndeclaredOutputsDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.New(compName, err)
+	}
+	f, err := os.Create(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, errors.New(compName, err)
+	}
+
+	return &Log{
+		diagnostics:  d,
+		redactor:     newRedactor(opts),
+		maxBodyBytes: opts.maxBodyBytes,
+		file:         f,
+	}, nil
+}
+
+// Wrap returns a handler that logs each request handled by h.
+func (l *Log) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		reqBody := &capturingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = reqBody
+		}
+		rw := &capturingWriter{ResponseWriter: w, status: http.StatusOK, upgrade: websocket.IsUpgrade(r)}
+
+		h.ServeHTTP(rw, r)
+
+		path := r.URL.Path
+		entry := Entry{
+			Timestamp:     start,
+			Session:       sessionID(path, rw.body.Bytes()),
+			Method:        r.Method,
+			Path:          l.redactor.text(path),
+			Status:        rw.status,
+			LatencyMillis: float64(time.Since(start)) / float64(time.Millisecond),
+			RequestBytes:  reqBody.n,
+			ResponseBytes: rw.n,
+		}
+		if reqBody.n <= maxCaptureBytes {
+			entry.RequestBody = truncate(l.redactor.body(path, reqBody.body.Bytes()), l.maxBodyBytes)
+		}
+		if rw.n <= maxCaptureBytes {
+			entry.ResponseBody = truncate(l.redactor.body(path, rw.body.Bytes()), l.maxBodyBytes)
+		}
+		l.write(entry)
+	})
+}
+
+func (l *Log) write(entry Entry) {
+	b, err := marshal(entry)
+	if err != nil {
+		l.diagnostics.Warning(errors.New(compName, err))
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil || l.failed {
+		return
+	}
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		// Only report the first failure rather than one per request.
+		l.failed = true
+		l.diagnostics.Warning(errors.New(compName, err))
+	}
+}
+
+// Close closes the access log file. Requests handled after Close are not logged.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return errors.New(compName, err)
+	}
+	return nil
+}
+
+// sessionID returns the WebDriver session ID in path, or for new session commands, in the
+// response body.
+func sessionID(path string, respBody []byte) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range parts {
+		if p == "session" && i+1 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	if len(parts) == 0 || parts[len(parts)-1] != "session" {
+		return ""
+	}
+
+	body := struct {
+		SessionID string `json:"sessionId"`
+		Value     struct {
+			SessionID string `json:"sessionId"`
+		} `json:"value"`
+	}{}
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		return ""
+	}
+	if body.SessionID != "" {
+		return body.SessionID
+	}
+	return body.Value.SessionID
+}
+
+// capturingReader counts the bytes read through it and keeps up to maxCaptureBytes of them.
+type capturingReader struct {
+	io.ReadCloser
+	body limitedBuffer
+	n    int64
+}
+
+func (c *capturingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	c.body.Write(p[:n])
+	return n, err
+}
+
+// capturingWriter records the status and counts the bytes written through it, keeping up to
+// maxCaptureBytes of them. It passes through Flush and Hijack so that streaming responses and
+// WebSocket upgrades continue to work. Hijacked connections are logged with status 101 if the
+// request was a WebSocket upgrade, otherwise with status 0, as the connection was closed without
+// a response.
+type capturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        limitedBuffer
+	n           int64
+	upgrade     bool
+}
+
+func (c *capturingWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status = status
+		c.wroteHeader = true
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capturingWriter) Write(p []byte) (int, error) {
+	c.wroteHeader = true
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	c.body.Write(p[:n])
+	return n, err
+}
+
+func (c *capturingWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *capturingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New(compName, "response writer does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err == nil {
+		c.status = 0
+		if c.upgrade {
+			c.status = http.StatusSwitchingProtocols
+		}
+		c.wroteHeader = true
+	}
+	return conn, brw, err
+}
+
+// limitedBuffer keeps the first maxCaptureBytes bytes written to it.
+type limitedBuffer struct {
+	buf []byte
+}
+
+func (b *limitedBuffer) Write(p []byte) {
+	if room := maxCaptureBytes - len(b.buf); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		b.buf = append(b.buf, p...)
+	}
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf
+}
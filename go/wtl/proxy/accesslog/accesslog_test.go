@@ -0,0 +1,171 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+func newLog(t *testing.T, config string) (*Log, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	dirJSON, _ := json.Marshal(dir)
+	m, err := metadata.FromBytes([]byte(`{"extension": {"accessLog": {"dir": `+string(dirJSON)+config+`}}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(m, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, dir
+}
+
+func entries(t *testing.T, l *Log, dir string) []Entry {
+	t.Helper()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var es []Entry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("Got error %v parsing line %q", err, s.Text())
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+func serve(h http.Handler, method, path, body string) {
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, strings.NewReader(body)))
+}
+
+func TestEntries(t *testing.T) {
+	l, dir := newLog(t, ``)
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/wd/hub/session":
+			w.Write([]byte(`{"value": {"sessionId": "new-id", "capabilities": {}}}`))
+		case "/wd/hub/session/abc/screenshot":
+			w.Write([]byte(`{"value": "` + strings.Repeat("A", 5000) + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"value": {"error": "no such element"}}`))
+		}
+	}))
+
+	serve(h, http.MethodPost, "/wd/hub/session", `{"capabilities": {"alwaysMatch": {"sauce:options": {"username": "me", "accessKey": "key123"}}}}`)
+	serve(h, http.MethodGet, "/wd/hub/session/abc/screenshot", "")
+	serve(h, http.MethodPost, "/wd/hub/session/abc/element", `{"using": "css selector", "value": "#id"}`)
+
+	es := entries(t, l, dir)
+	if len(es) != 3 {
+		t.Fatalf("Got %d entries, want 3", len(es))
+	}
+
+	if es[0].Session != "new-id" || es[0].Method != http.MethodPost || es[0].Status != http.StatusOK {
+		t.Errorf("Got new session entry %+v, want session new-id, POST, 200", es[0])
+	}
+	if strings.Contains(es[0].RequestBody, "key123") || !strings.Contains(es[0].RequestBody, redacted) {
+		t.Errorf("Got request body %q, want access key redacted", es[0].RequestBody)
+	}
+
+	if es[1].Session != "abc" || es[1].ResponseBytes < 5000 || !strings.HasPrefix(es[1].ResponseBody, "<screenshot removed") {
+		t.Errorf("Got screenshot entry %+v, want screenshot removed", es[1])
+	}
+
+	if es[2].Status != http.StatusNotFound || es[2].RequestBytes == 0 || !strings.Contains(es[2].RequestBody, "#id") {
+		t.Errorf("Got find element entry %+v, want status 404 and request body", es[2])
+	}
+}
+
+func TestRedactionAndTruncation(t *testing.T) {
+	l, dir := newLog(t, `, "maxBodyBytes": 64, "redactKeys": ["apiKey"], "redactPatterns": ["Bearer \\w+"]`)
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	serve(h, http.MethodPost, "/wd/hub/session/abc/cookie", `{"cookie": {"name": "sid", "value": "s3cret"}}`)
+	serve(h, http.MethodPost, "/wd/hub/session/abc/execute/sync", `{"script": "Bearer abc123", "args": [{"apiKey": "k"}]}`)
+	serve(h, http.MethodPost, "/wd/hub/session/abc/url", `{"url": "`+strings.Repeat("x", 100)+`"}`)
+
+	es := entries(t, l, dir)
+	if len(es) != 3 {
+		t.Fatalf("Got %d entries, want 3", len(es))
+	}
+	for _, body := range []string{es[0].RequestBody, es[0].ResponseBody} {
+		if strings.Contains(body, "s3cret") || !strings.Contains(body, "sid") {
+			t.Errorf("Got cookie body %q, want value redacted and name kept", body)
+		}
+	}
+	if body := es[1].RequestBody; strings.Contains(body, "abc123") || strings.Contains(body, `"k"`) {
+		t.Errorf("Got body %q, want pattern and key redacted", body)
+	}
+	if body := es[2].RequestBody; len(body) > 100 || !strings.Contains(body, "<truncated") {
+		t.Errorf("Got body %q, want truncated", body)
+	}
+}
+
+func TestTruncateKeepsCharactersWhole(t *testing.T) {
+	// "é" is two bytes, so cutting at 4 bytes would split the second one.
+	got := truncate("aéé", 4)
+	if want := "aé...<truncated 2 bytes>"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("Got invalid UTF-8 %q", got)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{"extension": {"accessLog": {"enabled": false}}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(m, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != nil {
+		t.Error("Got log, want nil when disabled")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+)
+
+const defaultMaxBodyBytes = 2048
+
+// accessLogOptions is the set of options that can be defined in the accessLog section of a
+// Metadata.Extension field.
+type accessLogOptions struct {
+	// Whether to write an access log. Defaults to true.
+	enabled bool
+	// The directory the access log is written to. If not defined, uses TEST_UNDECLARED_OUTPUTS_DIR.
+	dir string
+	// The number of bytes of each request and response body to keep. Defaults to 2048.
+	maxBodyBytes int
+	// JSON object keys whose values are redacted, in addition to the default keys.
+	redactKeys []string
+	// Regular expressions whose matches in bodies and paths are redacted.
+	redactPatterns []*regexp.Regexp
+}
+
+func extractOptions(m *metadata.Metadata) (accessLogOptions, error) {
+	opts := accessLogOptions{enabled: true, maxBodyBytes: defaultMaxBodyBytes}
+
+	if m == nil {
+		return opts, nil
+	}
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return opts, nil
+	}
+
+	alMap, ok := extMap["accessLog"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+
+	if e, ok := alMap["enabled"]; ok {
+		eb, ok := e.(bool)
+		if !ok {
+			return opts, fmt.Errorf("accessLog.enabled %#v is not a boolean", e)
+		}
+		opts.enabled = eb
+	}
+
+	if d, ok := alMap["dir"]; ok {
+		ds, ok := d.(string)
+		if !ok {
+			return opts, fmt.Errorf("accessLog.dir %#v is not a string", d)
+		}
+		opts.dir = ds
+	}
+
+	if b, ok := alMap["maxBodyBytes"]; ok {
+		bf, ok := b.(float64)
+		if !ok || bf < 0 {
+			return opts, fmt.Errorf("accessLog.maxBodyBytes %#v is not a non-negative number", b)
+		}
+		opts.maxBodyBytes = int(bf)
+	}
+
+	if k, ok := alMap["redactKeys"]; ok {
+		keys, err := stringList(k)
+		if err != nil {
+			return opts, fmt.Errorf("accessLog.redactKeys %v", err)
+		}
+		opts.redactKeys = keys
+	}
+
+	if p, ok := alMap["redactPatterns"]; ok {
+		patterns, err := stringList(p)
+		if err != nil {
+			return opts, fmt.Errorf("accessLog.redactPatterns %v", err)
+		}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return opts, fmt.Errorf("accessLog.redactPatterns: %v", err)
+			}
+			opts.redactPatterns = append(opts.redactPatterns, re)
+		}
+	}
+
+	return opts, nil
+}
+
+func stringList(v interface{}) ([]string, error) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%#v is not a list", v)
+	}
+	var strs []string
+	for _, e := range l {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("entry %#v is not a string", e)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const redacted = "<redacted>"
+
+// defaultRedactKeys are JSON object keys whose values are always redacted. They cover Sauce
+// credentials passed in capabilities as well as common names for other secrets.
+var defaultRedactKeys = []string{"accessKey", "access_key", "password", "secret", "token", "tunnelIdentifier"}
+
+// secretEnvVars are environment variables whose values are redacted wherever they appear.
+var secretEnvVars = []string{"SAUCE_USERNAME", "SAUCE_ACCESS_KEY"}
+
+// redactor removes secrets from paths and bodies.
+type redactor struct {
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+	literals []string
+}
+
+func newRedactor(opts accessLogOptions) *redactor {
+	r := &redactor{keys: map[string]bool{}, patterns: opts.redactPatterns}
+	for _, k := range append(defaultRedactKeys, opts.redactKeys...) {
+		r.keys[strings.ToLower(k)] = true
+	}
+	for _, v := range secretEnvVars {
+		if s := os.Getenv(v); s != "" {
+			r.literals = append(r.literals, s)
+		}
+	}
+	return r
+}
+
+// text redacts literal secrets and pattern matches in s.
+func (r *redactor) text(s string) string {
+	for _, l := range r.literals {
+		s = strings.ReplaceAll(s, l, redacted)
+	}
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// body returns body with secrets redacted. If path is a cookie command, cookie values are
+// redacted. If path is a screenshot command, body is replaced by a placeholder.
+func (r *redactor) body(path string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if isScreenshot(path) {
+		return fmt.Sprintf("<screenshot removed: %d bytes>", len(body))
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return r.text(string(body))
+	}
+	b, err := marshal(r.value(v, isCookie(path)))
+	if err != nil {
+		return r.text(string(body))
+	}
+	return r.text(string(b))
+}
+
+func (r *redactor) value(v interface{}, cookies bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		_, hasName := t["name"]
+		for k, e := range t {
+			if r.keys[strings.ToLower(k)] || (cookies && hasName && k == "value") {
+				t[k] = redacted
+				continue
+			}
+			t[k] = r.value(e, cookies)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = r.value(e, cookies)
+		}
+	}
+	return v
+}
+
+func isScreenshot(path string) bool {
+	return strings.HasSuffix(path, "/screenshot")
+}
+
+func isCookie(path string) bool {
+	return strings.HasSuffix(path, "/cookie") || strings.Contains(path, "/cookie/")
+}
+
+// marshal encodes v as JSON without escaping HTML characters, which would obscure placeholders.
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// truncate shortens s to at most max bytes without splitting a UTF-8 encoded character, noting
+// how much was removed.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s...<truncated %d bytes>", s[:n], len(s)-n)
+}
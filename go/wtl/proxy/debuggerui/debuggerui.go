@@ -0,0 +1,221 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package debuggerui provides an HTTPHandler that serves a browser-based front end for the
+// WTL debugger. The page talks to the WebDriver hub's debugger.Debugger over a WebSocket using
+// the same JSON messages as front ends connected to the debugger port.
+package debuggerui
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/httphelper"
+	"github.com/bazelbuild/rules_webtesting/go/websocket"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+const compName = "debugger UI http handler"
+
+type debuggerUI struct {
+	proxy *proxy.Proxy
+}
+
+// HTTPHandlerProvider returns a HTTPHandlerProvider for the debugger UI.
+func HTTPHandlerProvider(p *proxy.Proxy) (proxy.HTTPHandler, error) {
+	if p.Metadata.DebuggerPort != 0 {
+		log.Printf("WTL debugger UI is available at http://%s/debugger/", p.HTTPAddress)
+	}
+	return &debuggerUI{proxy: p}, nil
+}
+
+func (u *debuggerUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/debugger")
+
+	switch {
+	case path == "" || path == "/":
+		u.page(w, r)
+	case path == "/ws":
+		u.connect(w, r)
+	case strings.HasPrefix(path, "/screenshot/"):
+		u.screenshot(w, r, strings.TrimPrefix(path, "/screenshot/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (u *debuggerUI) page(w http.ResponseWriter, r *http.Request) {
+	enabled := false
+	if hub := driverhub.FromProxy(u.proxy); hub != nil && hub.Debugger != nil {
+		enabled = true
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	httphelper.SetDefaultResponseHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+	page.Execute(w, struct{ Enabled bool }{enabled})
+}
+
+func (u *debuggerUI) connect(w http.ResponseWriter, r *http.Request) {
+	if refuseCrossOrigin(w, r) {
+		return
+	}
+
+	hub := driverhub.FromProxy(u.proxy)
+	if hub == nil || hub.Debugger == nil {
+		http.Error(w, "the WTL debugger is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Print(errors.New(compName, err))
+		return
+	}
+	log.Printf("[%s] debugger front end connected from %s", compName, conn.RemoteAddr())
+	hub.Debugger.Connect(&frontEnd{conn: conn})
+}
+
+// refuseCrossOrigin responds with 403 Forbidden and returns true if r was not sent by the debugger
+// UI page itself. Browsers let any page open a WebSocket to, or fetch from, any host, and pages
+// under test must not be able to control the debugger or see screenshots of their session.
+func refuseCrossOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if sameOrigin(r) {
+		return false
+	}
+	log.Printf("[%s] refused %s from origin %q", compName, r.URL.Path, r.Header.Get("Origin"))
+	http.Error(w, "cross-origin requests to the WTL debugger are not allowed", http.StatusForbidden)
+	return true
+}
+
+// sameOrigin returns whether r has no Origin header, as sent by clients other than browsers, or an
+// Origin header whose host matches the host r was sent to. Requests that browsers mark as sent from
+// another site with Sec-Fetch-Site, e.g. for images, which carry no Origin header, are not.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func (u *debuggerUI) screenshot(w http.ResponseWriter, r *http.Request, sid string) {
+	if refuseCrossOrigin(w, r) {
+		return
+	}
+	hub := driverhub.FromProxy(u.proxy)
+	if hub == nil {
+		http.NotFound(w, r)
+		return
+	}
+	session := hub.GetSession(sid)
+	if session == nil {
+		http.Error(w, "session "+sid+" does not exist", http.StatusNotFound)
+		return
+	}
+
+	img, err := session.WebDriver.Screenshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (*debuggerUI) Healthy(context.Context) error {
+	return nil
+}
+
+func (*debuggerUI) Shutdown(context.Context) error {
+	return nil
+}
+
+func (*debuggerUI) Name() string {
+	return compName
+}
+
+// frontEnd adapts a WebSocket connection to the newline-delimited JSON stream the debugger
+// expects: each line written is sent as one text message, and each message read is followed
+// by a newline.
+type frontEnd struct {
+	conn *websocket.Conn
+
+	wmu  sync.Mutex
+	wbuf []byte
+
+	rbuf []byte
+}
+
+func (f *frontEnd) Write(p []byte) (int, error) {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+
+	f.wbuf = append(f.wbuf, p...)
+	for {
+		i := bytes.IndexByte(f.wbuf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := f.wbuf[:i]
+		f.wbuf = f.wbuf[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+		if err := f.conn.WriteMessage(websocket.TextMessage, line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (f *frontEnd) Close() error {
+	return f.conn.Close()
+}
+
+func (f *frontEnd) Read(p []byte) (int, error) {
+	for len(f.rbuf) == 0 {
+		_, msg, err := f.conn.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		f.rbuf = append(msg, '\n')
+	}
+	n := copy(p, f.rbuf)
+	f.rbuf = f.rbuf[n:]
+	return n, nil
+}
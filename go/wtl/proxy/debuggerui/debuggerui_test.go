@@ -0,0 +1,170 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debuggerui
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/websocket"
+)
+
+func TestPage(t *testing.T) {
+	for _, tc := range []struct {
+		enabled bool
+		want    string
+	}{
+		{true, "new WebSocket("},
+		{false, "--debugger_port"},
+	} {
+		buf := &bytes.Buffer{}
+		if err := page.Execute(buf, struct{ Enabled bool }{tc.enabled}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), tc.want) {
+			t.Errorf("Got page without %q when enabled is %v", tc.want, tc.enabled)
+		}
+	}
+}
+
+func TestFrontEnd(t *testing.T) {
+	fes := make(chan *frontEnd, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		fes <- &frontEnd{conn: conn}
+	}))
+	defer server.Close()
+
+	client := dial(t, server.Listener.Addr().String())
+	defer client.Close()
+	fe := <-fes
+
+	// Lines written by the debugger, possibly split across writes, arrive as one message each.
+	fmt.Fprint(fe, `{"id":1,`)
+	fmt.Fprint(fe, "\"status\":\"running\"}\n{\"id\":2}\n")
+
+	for _, want := range []string{`{"id":1,"status":"running"}`, `{"id":2}`} {
+		msgType, msg, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType != websocket.TextMessage || string(msg) != want {
+			t.Errorf("Got message (%d, %q), want (%d, %q)", msgType, msg, websocket.TextMessage, want)
+		}
+	}
+
+	// Messages sent by the page decode as a JSON stream.
+	for _, m := range []string{`{"id":3,"command":"step"}`, `{"id":4,"command":"continue"}`} {
+		if err := client.WriteMessage(websocket.TextMessage, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decoder := json.NewDecoder(fe)
+	for _, want := range []string{"step", "continue"} {
+		cmd := struct{ Command string }{}
+		if err := decoder.Decode(&cmd); err != nil {
+			t.Fatal(err)
+		}
+		if cmd.Command != want {
+			t.Errorf("Got command %q, want %q", cmd.Command, want)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		origin    string
+		fetchSite string
+		want      bool
+	}{
+		{"", "", true},
+		{"http://localhost:8080", "", true},
+		{"http://LOCALHOST:8080", "", true},
+		{"http://localhost:9090", "", false},
+		{"https://evil.example.com", "", false},
+		{"null", "", false},
+		{"", "same-origin", true},
+		{"", "none", true},
+		{"", "same-site", false},
+		{"", "cross-site", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/debugger/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if tc.fetchSite != "" {
+			r.Header.Set("Sec-Fetch-Site", tc.fetchSite)
+		}
+		if got := sameOrigin(r); got != tc.want {
+			t.Errorf("sameOrigin with Origin %q and Sec-Fetch-Site %q got %v, want %v", tc.origin, tc.fetchSite, got, tc.want)
+		}
+	}
+}
+
+func TestConnectRefusesCrossOrigin(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/debugger/ws", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+
+	(&debuggerUI{}).ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestScreenshotRefusesCrossOrigin(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/debugger/screenshot/abc", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+
+	(&debuggerUI{}).ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func dial(t *testing.T, addr string) *websocket.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET /debugger/ws HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", addr)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	return websocket.NewClientConn(conn, br)
+}
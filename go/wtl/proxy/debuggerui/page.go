@@ -0,0 +1,317 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debuggerui
+
+import "html/template"
+
+var page = template.Must(template.New("debugger").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>WTL Debugger</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#main { flex: 3; display: flex; flex-direction: column; padding: 8px; overflow: hidden; }
+#side { flex: 2; padding: 8px; border-left: 1px solid #ccc; overflow: auto; }
+#log { flex: 1; overflow: auto; font-family: monospace; font-size: 12px; border: 1px solid #ccc; }
+.entry { padding: 2px 4px; border-bottom: 1px solid #eee; white-space: pre-wrap; cursor: pointer; }
+.entry.response { color: #555; }
+.entry.waiting { background: #fff3c4; }
+.entry.error { color: #b00; }
+.entry.log { color: #06c; }
+#controls button { margin-right: 4px; }
+#status { font-weight: bold; margin-left: 8px; }
+#paused { display: none; border: 1px solid #e0b000; padding: 4px; margin: 8px 0; }
+#paused textarea { width: 100%; height: 120px; font-family: monospace; }
+#inspect-result { max-height: 200px; overflow: auto; background: #f6f6f6; }
+#screenshot { max-width: 100%; border: 1px solid #ccc; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border: 1px solid #ccc; padding: 2px 4px; font-size: 12px; text-align: left; }
+label { display: block; font-size: 12px; margin-top: 4px; }
+input { width: 95%; }
+</style>
+</head>
+<body>
+{{if .Enabled}}
+<div id="main">
+  <div id="controls">
+    <button id="continue">Continue</button>
+    <button id="step">Step</button>
+    <button id="clear">Clear log</button>
+    <button id="take-control">Take control</button>
+    <button id="detach">Detach</button>
+    <span id="status">connecting...</span>
+    <span id="role"></span>
+  </div>
+  <div id="paused">
+    <div id="paused-title"></div>
+    <textarea id="paused-body"></textarea>
+    <div>Edit the body above, then Continue or Step to forward it.</div>
+    <div id="inspect">
+      <button id="page-source">Page source</button>
+      <button id="current-url">Current URL</button>
+      <input id="script" placeholder="return document.title;" style="width: 50%">
+      <button id="run-script">Run script</button>
+      <pre id="inspect-result"></pre>
+    </div>
+  </div>
+  <div id="log"></div>
+</div>
+<div id="side">
+  <h3>Breakpoints</h3>
+  <table id="breakpoints"><tr><th>ID</th><th>Target</th><th>Methods</th><th>Path</th><th>Body</th><th>Statuses</th><th>Session</th><th>Condition</th><th>Log</th><th>Hits</th><th></th></tr></table>
+  <form id="add-breakpoint">
+    <label>Target <select id="bp-target"><option value="request">request</option><option value="response">response</option></select></label>
+    <label>Methods (comma separated) <input id="bp-methods"></label>
+    <label>Path regex <input id="bp-path"></label>
+    <label>Body regex <input id="bp-body"></label>
+    <label>Statuses (response only, comma separated) <input id="bp-statuses"></label>
+    <label>Session ID <input id="bp-session"></label>
+    <label>Trigger from hit number <input id="bp-hit-count" type="number" min="1"></label>
+    <label><input id="bp-once" type="checkbox" style="width: auto"> Delete after first trigger</label>
+    <label>Log message instead of pausing ({method}, {path}, {session}, {body}, {status}, {hits}) <input id="bp-log"></label>
+    <button type="submit">Add breakpoint</button>
+  </form>
+  <h3>Screenshot</h3>
+  <div id="screenshot-info">Shown when a session is paused.</div>
+  <img id="screenshot" alt="">
+</div>
+<script>
+(function() {
+  var nextID = 1;
+  var nextBreakpoint = 1;
+  var breakpoints = {};
+  // Paused commands, oldest first. The oldest is shown and is released by continue and step.
+  var pauses = [];
+  var socket = null;
+  var role = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function send(cmd) {
+    cmd.id = nextID++;
+    socket.send(JSON.stringify(cmd));
+  }
+
+  function sessionOf(path) {
+    var m = /\/session\/([^\/]+)/.exec(path || "");
+    return m ? m[1] : null;
+  }
+
+  function pretty(body) {
+    if (!body) return "";
+    try { return JSON.stringify(JSON.parse(body), null, 2); } catch (e) { return body; }
+  }
+
+  function addEntry(msg) {
+    var e = document.createElement("div");
+    var req = msg.request || {};
+    var text;
+    if (msg.response) {
+      e.className = "entry response";
+      text = "← " + msg.response.status + " " + req.method + " " + req.path;
+    } else {
+      e.className = "entry";
+      text = "→ " + req.method + " " + req.path;
+    }
+    if (msg.status === "waiting") e.className += " waiting";
+    e.textContent = text;
+    var body = msg.response ? msg.response.body : req.body;
+    e.onclick = function() {
+      e.textContent = e.textContent === text ? text + "\n" + pretty(body) : text;
+    };
+    var log = $("log");
+    var atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+    log.appendChild(e);
+    if (atBottom) log.scrollTop = log.scrollHeight;
+  }
+
+  function showPausedTitle() {
+    var msg = pauses[0];
+    var req = msg.request || {};
+    var what = msg.response ? "response (" + msg.response.status + ") to " : "request ";
+    var others = pauses.length > 1 ? " (" + (pauses.length - 1) + " more paused)" : "";
+    $("paused-title").textContent = "Paused on " + what + req.method + " " + req.path + others;
+  }
+
+  function showPaused() {
+    if (!pauses.length) {
+      $("paused").style.display = "none";
+      return;
+    }
+    showPausedTitle();
+    var msg = pauses[0];
+    var req = msg.request || {};
+    var body = msg.response ? msg.response.body : req.body;
+    $("paused-body").value = body || "";
+    $("paused-body").dataset.original = body || "";
+    $("paused").style.display = "block";
+    $("inspect-result").textContent = "";
+    $("status").textContent = "paused";
+    var sid = sessionOf(req.path);
+    if (sid) {
+      $("screenshot-info").textContent = "Session " + sid;
+      $("screenshot").src = "screenshot/" + encodeURIComponent(sid) + "?t=" + Date.now();
+    }
+  }
+
+  function resume(command) {
+    var cmd = {command: command};
+    if (pauses.length) {
+      cmd.pause = pauses.shift().pause;
+      var body = $("paused-body").value;
+      if (body !== $("paused-body").dataset.original) cmd.body = body;
+    }
+    $("status").textContent = command === "step" ? "stepping" : "running";
+    send(cmd);
+    showPaused();
+  }
+
+  function setRole(r) {
+    role = r;
+    $("role").textContent = "(" + r + ")";
+    var controlling = r === "controller";
+    ["continue", "step", "detach"].forEach(function(id) { $(id).disabled = !controlling; });
+    $("take-control").disabled = controlling;
+    $("add-breakpoint").querySelector("button").disabled = !controlling;
+  }
+
+  function renderBreakpoints() {
+    var table = $("breakpoints");
+    while (table.rows.length > 1) table.deleteRow(1);
+    Object.keys(breakpoints).forEach(function(id) {
+      var bp = breakpoints[id];
+      var row = table.insertRow();
+      var condition = [];
+      if (bp.hitCount > 1) condition.push("hit >= " + bp.hitCount);
+      if (bp.once) condition.push("once");
+      [bp.id, bp.target || "request", (bp.methods || []).join(","), bp.path || "", bp.body || "", (bp.statuses || []).join(","),
+       bp.session || "", condition.join(", "), bp.log || "", bp.hits || 0].forEach(function(v) {
+        row.insertCell().textContent = v;
+      });
+      var del = document.createElement("button");
+      del.textContent = "Delete";
+      del.onclick = function() {
+        send({command: "delete breakpoint", breakpoint: {id: bp.id}});
+        syncBreakpoints();
+      };
+      row.insertCell().appendChild(del);
+    });
+  }
+
+  // syncBreakpoints asks the debugger for its breakpoints, which may have been set by another
+  // front end or have changed hit counts.
+  function syncBreakpoints() {
+    send({command: "list breakpoints"});
+  }
+
+  function list(v) {
+    return v.split(",").map(function(s) { return s.trim(); }).filter(function(s) { return s; });
+  }
+
+  $("add-breakpoint").onsubmit = function(ev) {
+    ev.preventDefault();
+    var bp = {id: nextBreakpoint++, target: $("bp-target").value};
+    var methods = list($("bp-methods").value).map(function(m) { return m.toUpperCase(); });
+    if (methods.length) bp.methods = methods;
+    if ($("bp-path").value) bp.path = $("bp-path").value;
+    if ($("bp-body").value) bp.body = $("bp-body").value;
+    var statuses = list($("bp-statuses").value).map(Number);
+    if (statuses.length) bp.statuses = statuses;
+    if ($("bp-session").value) bp.session = $("bp-session").value.trim();
+    if (Number($("bp-hit-count").value) > 1) bp.hitCount = Number($("bp-hit-count").value);
+    if ($("bp-once").checked) bp.once = true;
+    if ($("bp-log").value) bp.log = $("bp-log").value;
+    send({command: "set breakpoint", breakpoint: bp});
+    syncBreakpoints();
+  };
+  $("continue").onclick = function() { resume("continue"); };
+  $("step").onclick = function() { resume("step"); };
+  $("clear").onclick = function() { $("log").innerHTML = ""; };
+  $("page-source").onclick = function() { send({command: "page source"}); };
+  $("current-url").onclick = function() { send({command: "current url"}); };
+  $("run-script").onclick = function() { send({command: "execute script", script: $("script").value}); };
+  $("take-control").onclick = function() { send({command: "take control"}); };
+  $("detach").onclick = function() {
+    pauses = [];
+    showPaused();
+    send({command: "detach"});
+  };
+
+  function connect() {
+    var scheme = location.protocol === "https:" ? "wss:" : "ws:";
+    socket = new WebSocket(scheme + "//" + location.host + location.pathname.replace(/\/?$/, "/") + "ws");
+    socket.onopen = function() {
+      $("status").textContent = "connected";
+    };
+    socket.onmessage = function(ev) {
+      var msg = JSON.parse(ev.data);
+      if (msg.role) setRole(msg.role);
+      if (msg.status === "connected") {
+        // Commands that are still paused are sent again after the connected message.
+        pauses = [];
+        showPaused();
+        syncBreakpoints();
+      }
+      if (msg.status === "breakpoints") {
+        breakpoints = {};
+        (msg.breakpoints || []).forEach(function(bp) {
+          breakpoints[bp.id] = bp;
+          nextBreakpoint = Math.max(nextBreakpoint, bp.id + 1);
+        });
+        renderBreakpoints();
+        return;
+      }
+      if (msg.status === "result") {
+        var result = msg.result;
+        $("inspect-result").textContent = typeof result === "string" ? result : JSON.stringify(result, null, 2);
+        return;
+      }
+      if (msg.status === "log") {
+        var e = document.createElement("div");
+        e.className = "entry log";
+        e.textContent = "logpoint " + msg.breakpoint + ": " + msg.message;
+        $("log").appendChild(e);
+        return;
+      }
+      if (!msg.request) {
+        if (msg.status === "error") addEntry({request: {method: "error", path: msg.error || "command " + msg.id + " failed"}});
+        return;
+      }
+      addEntry(msg);
+      if (msg.status === "waiting") {
+        pauses.push(msg);
+        if (pauses.length === 1) {
+          showPaused();
+        } else {
+          showPausedTitle();
+        }
+        syncBreakpoints();
+      }
+    };
+    socket.onclose = function() {
+      $("status").textContent = "disconnected, reconnecting...";
+      setTimeout(connect, 1000);
+    };
+  }
+  connect();
+})();
+</script>
+{{else}}
+<p style="padding: 8px">The WTL debugger is not enabled. Run WTL with <code>--debugger_port</code> to enable it.</p>
+{{end}}
+</body>
+</html>
+`))
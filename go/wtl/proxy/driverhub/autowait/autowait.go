@@ -0,0 +1,242 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package autowait provides a handler that retries element lookups that find nothing until an
+// element appears or a timeout expires. It acts as an implicit wait implemented by the proxy, so
+// it behaves the same for every browser and for both W3C and JWP clients. It is configured by the
+// autoWait section of a Metadata.Extension field, or by the google:autoWait capability, which
+// takes precedence. Either may be a timeout, as a number of seconds or a duration string, or an
+// object, e.g.:
+//
+//	"autoWait": {
+//	  "timeout": "5s",
+//	  "interval": "100ms",
+//	  "emptyLists": true
+//	}
+//
+// Lookups of single elements are retried while they fail with no such element. If emptyLists is
+// true, lookups of multiple elements are also retried while they return no elements. Lookups are
+// retried every interval (default 100ms) until timeout has passed since the first attempt. Any
+// implicit wait set on the remote end applies to each attempt.
+package autowait
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+const (
+	compName = "Auto-wait Handler"
+	// Capability is the capability used to configure auto-wait for a single session.
+	Capability = "google:autoWait"
+
+	defaultInterval = 100 * time.Millisecond
+	// noSuchElementStatus is the JWP status code for no such element.
+	noSuchElementStatus = 7
+)
+
+type config struct {
+	timeout    time.Duration
+	interval   time.Duration
+	emptyLists bool
+}
+
+// Validate returns an error if the auto-wait configured by m and caps is invalid.
+func Validate(m *metadata.Metadata, caps *capabilities.Capabilities) error {
+	if _, err := findConfig(m, caps); err != nil {
+		return errors.New(compName, fmt.Errorf("invalid autoWait: %v", err))
+	}
+	return nil
+}
+
+// ProviderFunc provides a handler that retries element lookups as configured for the session.
+// The configuration must have been checked with Validate.
+func ProviderFunc(session *driverhub.WebDriverSession, caps *capabilities.Capabilities, base driverhub.HandlerFunc) (driverhub.HandlerFunc, bool) {
+	c, err := findConfig(session.Metadata, caps)
+	if err != nil {
+		session.Warning(errors.New(compName, fmt.Errorf("ignoring invalid autoWait: %v", err)))
+		return base, false
+	}
+	if c == nil || c.timeout <= 0 {
+		return base, false
+	}
+
+	return func(ctx context.Context, rq driverhub.Request) (driverhub.Response, error) {
+		multiple, ok := isLookup(rq.Method, rq.Path)
+		if !ok || (multiple && !c.emptyLists) {
+			return base(ctx, rq)
+		}
+
+		start := time.Now()
+		deadline := start.Add(c.timeout)
+		path := "/" + strings.Join(rq.Path, "/")
+
+		for attempts := 1; ; attempts++ {
+			resp, err := base(ctx, rq)
+			if err != nil {
+				return resp, err
+			}
+
+			found := !notFound(resp, multiple)
+			if found || !time.Now().Add(c.interval).Before(deadline) {
+				outcome := "found"
+				if !found {
+					outcome = "not found"
+				}
+				if err := session.Timing(compName, "element lookup", fmt.Sprintf("%s %s: %s after %d attempt(s)", path, rq.Body, outcome, attempts), start, time.Now()); err != nil {
+					session.Warning(err)
+				}
+				return resp, nil
+			}
+
+			select {
+			case <-time.After(c.interval):
+			case <-ctx.Done():
+				return driverhub.Response{}, ctx.Err()
+			}
+		}
+	}, true
+}
+
+// NeedsBody returns true for element lookups, which the handler retries based on their responses.
+func NeedsBody(method string, path []string) bool {
+	_, ok := isLookup(method, path)
+	return ok
+}
+
+// isLookup returns whether a command finds elements, and if so whether it finds multiple elements.
+func isLookup(method string, p []string) (bool, bool) {
+	if method != http.MethodPost {
+		return false, false
+	}
+	switch {
+	case len(p) == 1:
+	case len(p) == 3 && (p[0] == "element" || p[0] == "shadow"):
+	default:
+		return false, false
+	}
+	switch p[len(p)-1] {
+	case "element":
+		return false, true
+	case "elements":
+		return true, true
+	}
+	return false, false
+}
+
+// notFound returns whether resp is a no such element error or, if multiple is true, an empty
+// list of elements. Both W3C and JWP responses are understood.
+func notFound(resp driverhub.Response, multiple bool) bool {
+	body := struct {
+		Status *int
+		Error  string
+		Value  json.RawMessage
+	}{}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return false
+	}
+
+	if body.Status != nil && *body.Status != 0 {
+		return *body.Status == noSuchElementStatus
+	}
+
+	if body.Error != "" {
+		return body.Error == "no such element"
+	}
+
+	if resp.Status >= http.StatusBadRequest {
+		e := struct {
+			Error string
+		}{}
+		return json.Unmarshal(body.Value, &e) == nil && e.Error == "no such element"
+	}
+
+	if multiple {
+		var elements []interface{}
+		return json.Unmarshal(body.Value, &elements) == nil && len(elements) == 0
+	}
+	return false
+}
+
+func findConfig(m *metadata.Metadata, caps *capabilities.Capabilities) (*config, error) {
+	if caps != nil {
+		if v, ok := caps.AlwaysMatch[Capability]; ok {
+			return parseConfig(v)
+		}
+	}
+
+	if m == nil {
+		return nil, nil
+	}
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return nil, nil
+	}
+	v, ok := extMap["autoWait"]
+	if !ok {
+		return nil, nil
+	}
+	return parseConfig(v)
+}
+
+func parseConfig(v interface{}) (*config, error) {
+	c := &config{interval: defaultInterval}
+
+	cm, ok := v.(map[string]interface{})
+	if !ok {
+		timeout, err := metadata.Duration(v)
+		if err != nil {
+			return nil, err
+		}
+		c.timeout = timeout
+		return c, nil
+	}
+
+	if t, ok := cm["timeout"]; ok {
+		timeout, err := metadata.Duration(t)
+		if err != nil {
+			return nil, fmt.Errorf("timeout: %v", err)
+		}
+		c.timeout = timeout
+	}
+
+	if i, ok := cm["interval"]; ok {
+		interval, err := metadata.Duration(i)
+		if err != nil {
+			return nil, fmt.Errorf("interval: %v", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval %v must be positive", interval)
+		}
+		c.interval = interval
+	}
+
+	if e, ok := cm["emptyLists"]; ok {
+		b, ok := e.(bool)
+		if !ok {
+			return nil, fmt.Errorf("emptyLists %#v is not a boolean", e)
+		}
+		c.emptyLists = b
+	}
+	return c, nil
+}
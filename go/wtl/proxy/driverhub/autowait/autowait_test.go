@@ -0,0 +1,186 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autowait
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/driverhubtest"
+)
+
+const (
+	w3cNotFound = `{"value": {"error": "no such element", "message": "not found"}}`
+	jwpNotFound = `{"status": 7, "value": {"message": "not found"}}`
+	element     = `{"value": {"element-6066-11e4-a52e-4f735466cecf": "abc"}}`
+)
+
+// responder returns a handler that answers with each of bodies in turn, repeating the last, and
+// a pointer to the number of calls made.
+func responder(status int, bodies ...string) (driverhub.HandlerFunc, *int) {
+	calls := 0
+	return func(context.Context, driverhub.Request) (driverhub.Response, error) {
+		body := bodies[len(bodies)-1]
+		if calls < len(bodies) {
+			body = bodies[calls]
+		}
+		calls++
+		s := http.StatusOK
+		if body != element && body != `{"value": []}` {
+			s = status
+		}
+		return driverhub.Response{Status: s, Body: []byte(body)}, nil
+	}, &calls
+}
+
+func TestNoConfig(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := responder(http.StatusNotFound, w3cNotFound)
+	if _, ok := ProviderFunc(&driverhub.WebDriverSession{Metadata: m}, nil, base); ok {
+		t.Error("Got true, want false when autoWait is not configured")
+	}
+}
+
+func TestRetriesUntilFound(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		notFound string
+	}{
+		{"W3C", http.StatusNotFound, w3cNotFound},
+		{"JWP", http.StatusInternalServerError, jwpNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base, calls := responder(tc.status, tc.notFound, tc.notFound, element)
+			handler, ok := ProviderFunc(driverhubtest.NewSession(t, "autoWait", `{"timeout": 5, "interval": "1ms"}`), nil, base)
+			if !ok {
+				t.Fatal("Got false, want handler")
+			}
+
+			resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodPost, Path: []string{"element", "abc", "element"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != http.StatusOK || string(resp.Body) != element {
+				t.Errorf("Got %d %s, want %d %s", resp.Status, resp.Body, http.StatusOK, element)
+			}
+			if *calls != 3 {
+				t.Errorf("Got %d calls, want 3", *calls)
+			}
+		})
+	}
+}
+
+func TestGivesUpAtTimeout(t *testing.T) {
+	base, calls := responder(http.StatusNotFound, w3cNotFound)
+	handler, _ := ProviderFunc(driverhubtest.NewSession(t, "autoWait", `{"timeout": "50ms", "interval": "10ms"}`), nil, base)
+
+	start := time.Now()
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodPost, Path: []string{"element"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusNotFound {
+		t.Errorf("Got status %d, want %d", resp.Status, http.StatusNotFound)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Got elapsed %v, want about 50ms", elapsed)
+	}
+	if *calls < 2 {
+		t.Errorf("Got %d calls, want several", *calls)
+	}
+}
+
+func TestEmptyLists(t *testing.T) {
+	for _, tc := range []struct {
+		config    string
+		wantCalls int
+	}{
+		{`"1s"`, 1},
+		{`{"timeout": 1, "interval": "1ms", "emptyLists": true}`, 2},
+	} {
+		base, calls := responder(http.StatusOK, `{"value": []}`, `{"value": [{"ELEMENT": "abc"}]}`)
+		handler, _ := ProviderFunc(driverhubtest.NewSession(t, "autoWait", tc.config), nil, base)
+		if _, err := handler(context.Background(), driverhub.Request{Method: http.MethodPost, Path: []string{"elements"}}); err != nil {
+			t.Fatal(err)
+		}
+		if *calls != tc.wantCalls {
+			t.Errorf("config %s: got %d calls, want %d", tc.config, *calls, tc.wantCalls)
+		}
+	}
+}
+
+func TestIgnoresOtherCommands(t *testing.T) {
+	base, calls := responder(http.StatusNotFound, w3cNotFound)
+	handler, _ := ProviderFunc(driverhubtest.NewSession(t, "autoWait", `5`), nil, base)
+
+	for _, rq := range []driverhub.Request{
+		{Method: http.MethodPost, Path: []string{"element", "abc", "click"}},
+		{Method: http.MethodGet, Path: []string{"element", "active"}},
+		{Method: http.MethodPost, Path: []string{"url"}},
+	} {
+		*calls = 0
+		if _, err := handler(context.Background(), rq); err != nil {
+			t.Fatal(err)
+		}
+		if *calls != 1 {
+			t.Errorf("Got %d calls for %s %v, want 1", *calls, rq.Method, rq.Path)
+		}
+	}
+}
+
+func TestCapabilityOverridesMetadata(t *testing.T) {
+	base, calls := responder(http.StatusNotFound, w3cNotFound, element)
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{Capability: 0.0}}
+	if _, ok := ProviderFunc(driverhubtest.NewSession(t, "autoWait", `5`), caps, base); ok {
+		t.Error("Got true, want false when capability disables autoWait")
+	}
+
+	caps.AlwaysMatch[Capability] = map[string]interface{}{"timeout": 1.0, "interval": "1ms"}
+	handler, ok := ProviderFunc(driverhubtest.NewSession(t, "autoWait", `{}`), caps, base)
+	if !ok {
+		t.Fatal("Got false, want handler")
+	}
+	if _, err := handler(context.Background(), driverhub.Request{Method: http.MethodPost, Path: []string{"element"}}); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("Got %d calls, want 2", *calls)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	session := driverhubtest.NewSession(t, "autoWait", `{"timeout": "soon"}`)
+	if err := Validate(session.Metadata, nil); err == nil {
+		t.Error("Got nil error from Validate with invalid config, want error")
+	}
+	base, _ := responder(http.StatusOK, element)
+	if _, ok := ProviderFunc(session, nil, base); ok {
+		t.Error("Got true with invalid config, want false")
+	}
+
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{Capability: "soon"}}
+	if err := Validate(nil, caps); err == nil {
+		t.Errorf("Got nil error from Validate with %s %q, want error", Capability, "soon")
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package commandpolicy provides a handler that blocks, rewrites, delays, or logs WebDriver
+// commands according to rules defined in the commandPolicies section of a Metadata.Extension field.
+//
+// commandPolicies is a list of rules, e.g.:
+//
+//	"commandPolicies": [
+//	  {"method": "POST", "path": "^/window/fullscreen$", "action": "block",
+//	   "error": "unsupported operation", "message": "fullscreen is not supported on this browser"},
+//	  {"path": "^/url$", "action": "delay", "delay": "500ms"},
+//	  {"path": "^/url$", "action": "rewrite", "patch": [{"op": "add", "path": "/extra", "value": true}]}
+//	]
+//
+// Every rule that matches a command is applied, in order.
+package commandpolicy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+const compName = "Command Policy Handler"
+
+// rule is a single compiled entry in commandPolicies.
+type rule struct {
+	// The HTTP method to match. If empty, matches all methods.
+	method string
+	// Matched against the command path relative to the session, with a leading / (e.g. "/element/abc/click").
+	// If nil, matches all commands.
+	path *regexp.Regexp
+	// One of block, rewrite, header, delay, or log.
+	action string
+	// Whether rewrite and header apply to the request sent to the driver or the response returned
+	// to the client. Defaults to "request".
+	target string
+	// For block, the W3C error and message returned to the client.
+	err     string
+	message string
+	// For rewrite, the JSON Patch applied to the body.
+	patch []patchOp
+	// For header, the headers to set.
+	headers map[string]string
+	// For delay, how long to wait before forwarding the command.
+	delay time.Duration
+}
+
+// Validate returns an error if the commandPolicies rules in m are invalid.
+func Validate(m *metadata.Metadata, _ *capabilities.Capabilities) error {
+	if _, err := compileRules(m); err != nil {
+		return errors.New(compName, fmt.Errorf("invalid commandPolicies: %v", err))
+	}
+	return nil
+}
+
+// ProviderFunc provides a handler that applies the commandPolicies rules in the session metadata.
+// The rules must have been checked with Validate.
+func ProviderFunc(session *driverhub.WebDriverSession, _ *capabilities.Capabilities, base driverhub.HandlerFunc) (driverhub.HandlerFunc, bool) {
+	rules, err := compileRules(session.Metadata)
+	if err != nil {
+		session.Warning(errors.New(compName, fmt.Errorf("ignoring invalid commandPolicies: %v", err)))
+		return base, false
+	}
+	if len(rules) == 0 {
+		return base, false
+	}
+
+	return func(ctx context.Context, rq driverhub.Request) (driverhub.Response, error) {
+		path := "/" + strings.Join(rq.Path, "/")
+
+		var matched []*rule
+		for _, r := range rules {
+			if r.matches(rq.Method, path) {
+				matched = append(matched, r)
+			}
+		}
+		if len(matched) == 0 {
+			return base(ctx, rq)
+		}
+
+		for _, r := range matched {
+			switch {
+			case r.action == "log":
+				log.Printf("[%s] %s %s %s", compName, rq.Method, path, rq.Body)
+			case r.action == "delay":
+				select {
+				case <-time.After(r.delay):
+				case <-ctx.Done():
+					return driverhub.Response{}, ctx.Err()
+				}
+			case r.action == "block":
+				return driverhub.ResponseFromError(webdriver.ErrorFromError(r.err, r.message))
+			case r.action == "header" && r.target == "request":
+				rq.Header = cloneHeader(rq.Header)
+				for k, v := range r.headers {
+					rq.Header.Set(k, v)
+				}
+			case r.action == "rewrite" && r.target == "request":
+				body, err := applyPatch(rq.Body, r.patch)
+				if err != nil {
+					return driverhub.ResponseFromError(webdriver.ErrorFromError("invalid argument",
+						fmt.Sprintf("[%s] unable to rewrite request for %s %s: %v", compName, rq.Method, path, err)))
+				}
+				rq.Body = body
+			}
+		}
+
+		resp, err := base(ctx, rq)
+		if err != nil {
+			return resp, err
+		}
+
+		for _, r := range matched {
+			switch {
+			case r.action == "log":
+				log.Printf("[%s] %s %s returned %d %s", compName, rq.Method, path, resp.Status, resp.Body)
+			case r.action == "header" && r.target == "response":
+				resp.Header = cloneHeader(resp.Header)
+				for k, v := range r.headers {
+					resp.Header.Set(k, v)
+				}
+			case r.action == "rewrite" && r.target == "response":
+				body, err := applyPatch(resp.Body, r.patch)
+				if err != nil {
+					session.Warning(errors.New(compName, fmt.Errorf("unable to rewrite response for %s %s: %v", rq.Method, path, err)))
+					continue
+				}
+				resp.Body = body
+			}
+		}
+		return resp, nil
+	}, true
+}
+
+func (r *rule) matches(method, path string) bool {
+	if r.method != "" && !strings.EqualFold(r.method, method) {
+		return false
+	}
+	return r.path == nil || r.path.MatchString(path)
+}
+
+func compileRules(m *metadata.Metadata) ([]*rule, error) {
+	if m == nil {
+		return nil, nil
+	}
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return nil, nil
+	}
+	cp, ok := extMap["commandPolicies"]
+	if !ok {
+		return nil, nil
+	}
+	entries, ok := cp.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%#v is not a list", cp)
+	}
+
+	var rules []*rule
+	for i, e := range entries {
+		em, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule %d %#v is not an object", i, e)
+		}
+		r, err := compileRule(em)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func compileRule(em map[string]interface{}) (*rule, error) {
+	r := &rule{target: "request"}
+
+	for _, field := range []struct {
+		name string
+		dst  *string
+	}{
+		{"method", &r.method},
+		{"action", &r.action},
+		{"target", &r.target},
+		{"error", &r.err},
+		{"message", &r.message},
+	} {
+		if v, ok := em[field.name]; ok {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s %#v is not a string", field.name, v)
+			}
+			*field.dst = s
+		}
+	}
+
+	if p, ok := em["path"]; ok {
+		ps, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("path %#v is not a string", p)
+		}
+		re, err := regexp.Compile(ps)
+		if err != nil {
+			return nil, err
+		}
+		r.path = re
+	}
+
+	if r.target != "request" && r.target != "response" {
+		return nil, fmt.Errorf("target %q must be request or response", r.target)
+	}
+
+	switch r.action {
+	case "block":
+		if r.err == "" {
+			r.err = "unsupported operation"
+		}
+		if r.message == "" {
+			r.message = "command blocked by commandPolicies"
+		}
+	case "rewrite":
+		patch, err := parsePatch(em["patch"])
+		if err != nil {
+			return nil, err
+		}
+		r.patch = patch
+	case "header":
+		hm, ok := em["headers"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("headers %#v is not an object", em["headers"])
+		}
+		r.headers = map[string]string{}
+		for k, v := range hm {
+			vs, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("value %#v for header %q is not a string", v, k)
+			}
+			r.headers[k] = vs
+		}
+	case "delay":
+		d, err := metadata.Duration(em["delay"])
+		if err != nil {
+			return nil, fmt.Errorf("delay: %v", err)
+		}
+		r.delay = d
+	case "log":
+	default:
+		return nil, fmt.Errorf("action %q must be one of block, rewrite, header, delay, or log", r.action)
+	}
+
+	return r, nil
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := http.Header{}
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/driverhubtest"
+)
+
+// echo is a base handler that returns the request body and headers it received.
+func echo(_ context.Context, rq driverhub.Request) (driverhub.Response, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"value": map[string]interface{}{
+			"body":   string(rq.Body),
+			"header": rq.Header.Get("X-Policy"),
+		},
+	})
+	return driverhub.Response{Status: http.StatusOK, Body: body}, nil
+}
+
+func TestBlock(t *testing.T) {
+	session := driverhubtest.NewSession(t, "commandPolicies", `[{"method": "POST", "path": "^/window/fullscreen$", "action": "block", "message": "no fullscreen"}]`)
+	handler, ok := ProviderFunc(session, nil, echo)
+	if !ok {
+		t.Fatal("Got false, want handler")
+	}
+
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodPost, Path: []string{"window", "fullscreen"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status == http.StatusOK {
+		t.Errorf("Got status %d, want error status", resp.Status)
+	}
+	respJSON := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Body, &respJSON); err != nil {
+		t.Fatal(err)
+	}
+	if respJSON["error"] != "unsupported operation" || respJSON["message"] != "no fullscreen" {
+		t.Errorf("Got %s, want unsupported operation error with message no fullscreen", resp.Body)
+	}
+
+	resp, err = handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"window", "fullscreen"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Errorf("Got status %d for non-matching method, want %d", resp.Status, http.StatusOK)
+	}
+}
+
+func TestRewriteAndHeader(t *testing.T) {
+	session := driverhubtest.NewSession(t, "commandPolicies", `[
+  {"path": "^/url$", "action": "rewrite", "patch": [{"op": "replace", "path": "/url", "value": "http://rewritten/"}]},
+  {"path": "^/url$", "action": "header", "headers": {"X-Policy": "set"}},
+  {"path": "^/url$", "action": "rewrite", "target": "response", "patch": [{"op": "add", "path": "/rewritten", "value": true}]}
+]`)
+	handler, _ := ProviderFunc(session, nil, echo)
+
+	resp, err := handler(context.Background(), driverhub.Request{
+		Method: http.MethodPost,
+		Path:   []string{"url"},
+		Header: http.Header{},
+		Body:   []byte(`{"url": "http://original/"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	respJSON := struct {
+		Value struct {
+			Body   string
+			Header string
+		}
+		Rewritten bool
+	}{}
+	if err := json.Unmarshal(resp.Body, &respJSON); err != nil {
+		t.Fatal(err)
+	}
+	if respJSON.Value.Body != `{"url":"http://rewritten/"}` {
+		t.Errorf("Got request body %q, want rewritten url", respJSON.Value.Body)
+	}
+	if respJSON.Value.Header != "set" {
+		t.Errorf("Got X-Policy header %q, want set", respJSON.Value.Header)
+	}
+	if !respJSON.Rewritten {
+		t.Errorf("Got response %s, want rewritten: true", resp.Body)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	session := driverhubtest.NewSession(t, "commandPolicies", `[{"action": "delay", "delay": "50ms"}]`)
+	handler, _ := ProviderFunc(session, nil, echo)
+
+	start := time.Now()
+	if _, err := handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"title"}}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("Got command duration %v, want at least 50ms", d)
+	}
+}
+
+func TestNoPolicies(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ProviderFunc(&driverhub.WebDriverSession{Metadata: m}, nil, echo); ok {
+		t.Error("Got true with no commandPolicies, want false")
+	}
+}
+
+func TestInvalidPolicies(t *testing.T) {
+	session := driverhubtest.NewSession(t, "commandPolicies", `[{"action": "explode"}]`)
+	if err := Validate(session.Metadata, nil); err == nil {
+		t.Error("Got nil error from Validate with invalid policies, want error")
+	}
+
+	// Quit and every other command must still reach the driver if an invalid configuration
+	// slipped past validation.
+	if _, ok := ProviderFunc(session, nil, echo); ok {
+		t.Error("Got true with invalid policies, want false")
+	}
+}
+
+func TestValidPolicies(t *testing.T) {
+	session := driverhubtest.NewSession(t, "commandPolicies", `[{"path": "^/url$", "action": "delay", "delay": "500ms"}]`)
+	if err := Validate(session.Metadata, nil); err != nil {
+		t.Errorf("Got error %v from Validate, want nil", err)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	testCases := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}]`, `{"a":1,"b":2}`},
+		{`{"a": [1, 3]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a":[1,2,3]}`},
+		{`{"a": [1]}`, `[{"op": "add", "path": "/a/-", "value": 2}]`, `{"a":[1,2]}`},
+		{`{"a": 1, "b": 2}`, `[{"op": "remove", "path": "/a"}]`, `{"b":2}`},
+		{`{"a": {"b~c": 1}}`, `[{"op": "replace", "path": "/a/b~0c", "value": 2}]`, `{"a":{"b~c":2}}`},
+		{`{"a": 1}`, `[{"op": "move", "from": "/a", "path": "/b"}]`, `{"b":1}`},
+		{`{"a": {"x": 1}}`, `[{"op": "copy", "from": "/a", "path": "/b"}]`, `{"a":{"x":1},"b":{"x":1}}`},
+		{`{"a": 1}`, `[{"op": "test", "path": "/a", "value": 1}, {"op": "add", "path": "/ok", "value": true}]`, `{"a":1,"ok":true}`},
+	}
+
+	for _, tc := range testCases {
+		var p interface{}
+		if err := json.Unmarshal([]byte(tc.patch), &p); err != nil {
+			t.Fatal(err)
+		}
+		patch, err := parsePatch(p)
+		if err != nil {
+			t.Errorf("parsePatch(%s) got error %v", tc.patch, err)
+			continue
+		}
+		got, err := applyPatch([]byte(tc.doc), patch)
+		if err != nil {
+			t.Errorf("applyPatch(%s, %s) got error %v", tc.doc, tc.patch, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("applyPatch(%s, %s) got %s, want %s", tc.doc, tc.patch, got, tc.want)
+		}
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	testCases := []struct {
+		doc   string
+		patch string
+	}{
+		{`{"a": 1}`, `[{"op": "remove", "path": "/b"}]`},
+		{`{"a": [1]}`, `[{"op": "replace", "path": "/a/5", "value": 2}]`},
+		{`{"a": 1}`, `[{"op": "test", "path": "/a", "value": 2}]`},
+	}
+
+	for _, tc := range testCases {
+		var p interface{}
+		if err := json.Unmarshal([]byte(tc.patch), &p); err != nil {
+			t.Fatal(err)
+		}
+		patch, err := parsePatch(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := applyPatch([]byte(tc.doc), patch); err == nil {
+			t.Errorf("applyPatch(%s, %s) got %s, want error", tc.doc, tc.patch, got)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchOp is a single JSON Patch (RFC 6902) operation.
+type patchOp struct {
+	op    string
+	path  []string
+	from  []string
+	value interface{}
+}
+
+func parsePatch(p interface{}) ([]patchOp, error) {
+	ops, ok := p.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patch %#v is not a list", p)
+	}
+
+	var patch []patchOp
+	for _, o := range ops {
+		om, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("patch operation %#v is not an object", o)
+		}
+
+		op, _ := om["op"].(string)
+		switch op {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			return nil, fmt.Errorf("patch operation %#v has unknown op %q", o, op)
+		}
+
+		ps, ok := om["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("patch operation %#v is missing path", o)
+		}
+		path, err := parsePointer(ps)
+		if err != nil {
+			return nil, err
+		}
+
+		var from []string
+		if op == "move" || op == "copy" {
+			fs, ok := om["from"].(string)
+			if !ok {
+				return nil, fmt.Errorf("patch operation %#v is missing from", o)
+			}
+			from, err = parsePointer(fs)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		value, hasValue := om["value"]
+		if !hasValue && (op == "add" || op == "replace" || op == "test") {
+			return nil, fmt.Errorf("patch operation %#v is missing value", o)
+		}
+
+		patch = append(patch, patchOp{op: op, path: path, from: from, value: value})
+	}
+	return patch, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must be empty or start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// applyPatch applies patch to the JSON document body, and returns the resulting document.
+func applyPatch(body []byte, patch []patchOp) ([]byte, error) {
+	var doc interface{}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		doc = map[string]interface{}{}
+	} else if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, op := range patch {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func (op patchOp) apply(doc interface{}) (interface{}, error) {
+	switch op.op {
+	case "add":
+		return add(doc, op.path, deepCopy(op.value))
+	case "remove":
+		return remove(doc, op.path)
+	case "replace":
+		doc, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, deepCopy(op.value))
+	case "move":
+		v, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, v)
+	case "copy":
+		v, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, deepCopy(v))
+	case "test":
+		v, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, op.value) {
+			return nil, fmt.Errorf("test failed: value at /%s is %#v, not %#v", strings.Join(op.path, "/"), v, op.value)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.op)
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch t := doc.(type) {
+		case map[string]interface{}:
+			v, ok := t[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := index(token, len(t)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = t[i]
+		default:
+			return nil, fmt.Errorf("cannot get %q of %#v", token, doc)
+		}
+	}
+	return doc, nil
+}
+
+// update replaces the container at path[:len(path)-1] with the result of calling f with that
+// container and the last token of path.
+func update(doc interface{}, path []string, f func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return f(doc, path[0])
+	}
+	child, err := get(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, path[1:], f)
+	if err != nil {
+		return nil, err
+	}
+	switch t := doc.(type) {
+	case map[string]interface{}:
+		t[path[0]] = child
+	case []interface{}:
+		i, _ := index(path[0], len(t)-1)
+		t[i] = child
+	}
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch t := container.(type) {
+		case map[string]interface{}:
+			t[token] = value
+			return t, nil
+		case []interface{}:
+			if token == "-" {
+				return append(t, value), nil
+			}
+			i, err := index(token, len(t))
+			if err != nil {
+				return nil, err
+			}
+			t = append(t, nil)
+			copy(t[i+1:], t[i:])
+			t[i] = value
+			return t, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to %#v", token, container)
+		}
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return update(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch t := container.(type) {
+		case map[string]interface{}:
+			if _, ok := t[token]; !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			delete(t, token)
+			return t, nil
+		case []interface{}:
+			i, err := index(token, len(t)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(t[:i], t[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from %#v", token, container)
+		}
+	})
+}
+
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not a valid array index", token)
+	}
+	return i, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		c := map[string]interface{}{}
+		for k, e := range t {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, e := range t {
+			c[i] = deepCopy(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
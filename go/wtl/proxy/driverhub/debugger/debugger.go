@@ -16,6 +16,7 @@
 package debugger
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -27,6 +28,9 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/bazelbuild/rules_webtesting/go/errors"
@@ -36,7 +40,25 @@ type breakpoint struct {
 	ID      int      `json:"id"`
 	Path    string   `json:"path,omitempty"`
 	Methods []string `json:"methods,omitempty"`
-	Body    string   `josn:"body,omitempty"`
+	Body    string   `json:"body,omitempty"`
+	// Either "request" (the default) to pause before a matching request is handled, or "response"
+	// to pause before the response to a matching request is returned. Path and Methods always
+	// match the request; for response breakpoints Body matches the response body.
+	Target string `json:"target,omitempty"`
+	// For response breakpoints, the status codes to match. If empty, matches all status codes.
+	Statuses []int `json:"statuses,omitempty"`
+	// If set, only matches commands for the session with this ID.
+	Session string `json:"session,omitempty"`
+	// If greater than 1, the breakpoint only triggers once it has matched at least this many times.
+	HitCount int `json:"hitCount,omitempty"`
+	// If true, the breakpoint is deleted the first time it triggers.
+	Once bool `json:"once,omitempty"`
+	// If set, the breakpoint is a logpoint: rather than pausing, it sends this message to the front
+	// ends and the WTL log. {method}, {path}, {session}, {body}, {status}, and {hits} are replaced
+	// with the values for the matching command.
+	Log string `json:"log,omitempty"`
+	// The number of times the breakpoint has matched. Ignored in set breakpoint commands.
+	Hits int `json:"hits"`
 
 	pathRegex *regexp.Regexp
 	bodyRegex *regexp.Regexp
@@ -46,6 +68,20 @@ type command struct {
 	ID         int         `json:"id"`
 	Command    string      `json:"command"`
 	Breakpoint *breakpoint `json:"breakpoint,omitempty"`
+	// For continue and step, if set replaces the body of the paused request or response.
+	Body *string `json:"body,omitempty"`
+	// For continue and step, the ID of the paused command to release. Defaults to the command that
+	// has been paused longest.
+	Pause int `json:"pause,omitempty"`
+	// For inspection commands, the session to inspect. Defaults to the session of the command that
+	// has been paused longest.
+	Session string `json:"session,omitempty"`
+	// For execute script, the script and its arguments.
+	Script string        `json:"script,omitempty"`
+	Args   []interface{} `json:"args,omitempty"`
+	// For find elements, the locator strategy and selector.
+	Using string `json:"using,omitempty"`
+	Value string `json:"value,omitempty"`
 }
 
 type request struct {
@@ -54,31 +90,109 @@ type request struct {
 	Body   string `json:"body,omitempty"`
 }
 
+type responseInfo struct {
+	Status int    `json:"status"`
+	Body   string `json:"body,omitempty"`
+}
+
 type response struct {
-	ID      int      `json:"id"`
-	Status  string   `json:"status"`
-	Request *request `json:"request,omitempty"`
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	// For waiting messages, the ID of the paused command, used to release it.
+	Pause    int           `json:"pause,omitempty"`
+	Request  *request      `json:"request,omitempty"`
+	Response *responseInfo `json:"response,omitempty"`
+	// For connected and role messages, either "controller" or "observer".
+	Role string `json:"role,omitempty"`
+	// For log messages, the ID of the logpoint and the formatted message.
+	Breakpoint int    `json:"breakpoint,omitempty"`
+	Message    string `json:"message,omitempty"`
+	// For list breakpoints, all breakpoints ordered by ID.
+	Breakpoints []breakpoint `json:"breakpoints,omitempty"`
+	// For inspection commands, the session that was inspected and the result: a base64-encoded PNG
+	// for screenshot, a list of element references for find elements, and otherwise the value
+	// returned by the browser.
+	Session string      `json:"session,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	// For error responses, a description of the problem.
+	Error string `json:"error,omitempty"`
+}
+
+// controllerCommands are the commands that only the controlling front end may send.
+var controllerCommands = map[string]bool{
+	"continue":          true,
+	"step":              true,
+	"stop":              true,
+	"set breakpoint":    true,
+	"delete breakpoint": true,
+	"detach":            true,
+}
+
+// client is a connected debugger front end.
+type client struct {
+	conn io.ReadWriter
+
+	// mu serializes writes to conn.
+	mu sync.Mutex
+}
+
+func (c *client) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(append(b, '\n'))
+	return err
+}
+
+func (c *client) send(resp *response) error {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return c.write(b)
 }
 
 // Debugger is an implementation of the WTL Debugger server.
+//
+// Any number of front ends may be connected at once. All of them observe the commands passing
+// through the proxy, but only one, the controller, may step, continue, and manage breakpoints.
+// The first front end to connect becomes the controller; when it disconnects, control passes to
+// the longest-connected observer. An observer may take control at any time with a "take control"
+// command, and the controller may send "detach" to let the test run freely until another front
+// end takes control. While there is no controller, breakpoints and step mode do not pause the
+// test.
 type Debugger struct {
-	conn net.Conn
-
 	mu          sync.RWMutex
 	connError   error
 	healthy     bool
 	step        bool
 	breakpoints map[int]*breakpoint
-	waiting     chan<- interface{}
+	// The commands that are currently paused, oldest first.
+	pauses     []*pause
+	nextPause  int
+	clients    []*client
+	controller *client
+	detached   bool
+	webDrivers WebDriverLookup
 }
 
-// New returns a Debugger waiting for a connection on TCP port.
-func New(port int) *Debugger {
+// pause is a request or response paused until the controller steps or continues.
+type pause struct {
+	id      int
+	waiting chan *command
+	// The message sent when the pause began, replayed to front ends that connect while it lasts.
+	message []byte
+	session string
+}
+
+// New returns a Debugger waiting for connections on TCP port. webDrivers is used to inspect
+// sessions while paused.
+func New(port int, webDrivers WebDriverLookup) *Debugger {
 	d := &Debugger{
 		breakpoints: map[int]*breakpoint{},
+		webDrivers:  webDrivers,
 	}
 
-	go d.waitForConnection(port)
+	go d.waitForConnections(port)
 	return d
 }
 
@@ -87,7 +201,7 @@ func (*Debugger) Name() string {
 	return "WTL Debugger Server"
 }
 
-// Healthy returns nil iff a frontend is connected and has sent a step or continue command.
+// Healthy returns nil iff a frontend has connected and sent a step, continue, or detach command.
 func (d *Debugger) Healthy(context.Context) error {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
@@ -102,13 +216,15 @@ func (d *Debugger) Healthy(context.Context) error {
 	return nil
 }
 
-// Request logs r to the debugger frontend. If r matches a breakpoint or the debugger is in step mode,
-// Request will not return until a continue message from the front-end is received.
+// Request logs r to the debugger frontends. If r matches a breakpoint or the debugger is in step
+// mode, and a front end is in control, Request will not return until a continue message from the
+// controller is received. If the continue message includes a body, it replaces the body of r.
 func (d *Debugger) Request(r *http.Request) {
 	// Capture request body
 	body, err := capture(r.Body)
 	if err != nil {
-		log.Fatalf("Error reading request body: %v", err)
+		log.Print(errors.New(d.Name(), fmt.Errorf("error reading request body: %v", err)))
+		return
 	}
 	r.Body = body
 
@@ -121,61 +237,183 @@ func (d *Debugger) Request(r *http.Request) {
 	}
 
 	// Identify if we should be continuing or waiting
-	d.mu.RLock()
-	step := d.step
+	d.mu.Lock()
+	pause, logs := d.evaluate(resp.Request, nil)
+	step := d.step || pause
+	d.mu.Unlock()
 
-	if !step {
-		for _, bp := range d.breakpoints {
-			if bp.matches(resp.Request) {
-				step = true
-				break
-			}
+	d.log(logs)
+	cmd := d.report(resp, step)
+	if cmd == nil || cmd.Body == nil {
+		return
+	}
+	r.Body = ioutil.NopCloser(strings.NewReader(*cmd.Body))
+	r.ContentLength = int64(len(*cmd.Body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(*cmd.Body)))
+}
+
+// Response logs the response to r to the debugger frontends. If it matches a response breakpoint,
+// and a front end is in control, Response will not return until a continue message from the
+// controller is received. It returns the body that should be returned to the client, which is
+// body unless the continue message included a replacement.
+func (d *Debugger) Response(r *http.Request, status int, body []byte) []byte {
+	resp := &response{
+		Request: &request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+		},
+		Response: &responseInfo{
+			Status: status,
+			Body:   string(body),
+		},
+	}
+
+	d.mu.Lock()
+	step, logs := d.evaluate(resp.Request, resp.Response)
+	d.mu.Unlock()
+
+	d.log(logs)
+	cmd := d.report(resp, step)
+	if cmd == nil || cmd.Body == nil {
+		return body
+	}
+	return []byte(*cmd.Body)
+}
+
+// evaluate counts a hit for each breakpoint that matches r, or its response resp if resp is
+// non-nil. It returns whether any of them should pause, and the messages for any logpoints that
+// triggered. d.mu must be held.
+func (d *Debugger) evaluate(r *request, resp *responseInfo) (bool, []*response) {
+	pause := false
+	var logs []*response
+
+	for _, bp := range d.sortedBreakpoints() {
+		if !bp.matches(r, resp) {
+			continue
 		}
+
+		bp.Hits++
+		if bp.Hits < bp.HitCount {
+			continue
+		}
+		if bp.Once {
+			delete(d.breakpoints, bp.ID)
+		}
+		if bp.Log != "" {
+			logs = append(logs, &response{Status: "log", Breakpoint: bp.ID, Message: bp.format(r, resp)})
+			continue
+		}
+		pause = true
 	}
+	return pause, logs
+}
 
-	d.mu.RUnlock()
+// sortedBreakpoints returns the breakpoints ordered by ID. d.mu must be held.
+func (d *Debugger) sortedBreakpoints() []*breakpoint {
+	var bps []*breakpoint
+	for _, bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Slice(bps, func(i, j int) bool { return bps[i].ID < bps[j].ID })
+	return bps
+}
+
+// log sends logpoint messages to the WTL log and all front ends.
+func (d *Debugger) log(logs []*response) {
+	for _, l := range logs {
+		log.Printf("[%s] logpoint %d: %s", d.Name(), l.Breakpoint, l.Message)
+		b, err := json.Marshal(l)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		d.broadcast(b)
+	}
+}
 
-	if step {
+// report sends resp to all front ends. If wait is true and a front end is in control, it waits
+// for a step or continue command from the controller and returns it.
+func (d *Debugger) report(resp *response, wait bool) *command {
+	d.mu.Lock()
+	if d.controller == nil {
+		wait = false
+	}
+	var p *pause
+	if wait {
+		d.nextPause++
+		p = &pause{
+			id:      d.nextPause,
+			waiting: make(chan *command, 1),
+			session: sessionID(resp.Request.Path),
+		}
 		resp.Status = "waiting"
+		resp.Pause = p.id
 	} else {
 		resp.Status = "running"
 	}
 
-	// Send request info to client client
 	bytes, err := json.Marshal(resp)
 	if err != nil {
+		d.mu.Unlock()
 		log.Print(err)
-		return
+		return nil
 	}
-
-	if _, err := d.conn.Write(bytes); err != nil {
-		log.Print(err)
+	if wait {
+		// Register for the step/continue command before telling the front ends we are waiting,
+		// so that a fast reply is not missed.
+		p.message = bytes
+		d.pauses = append(d.pauses, p)
 	}
+	d.mu.Unlock()
 
-	if _, err := d.conn.Write([]byte("\n")); err != nil {
-		log.Print(err)
-	}
+	d.broadcast(bytes)
 
 	// Not stepping, so return.
-	if !step {
-		return
+	if !wait {
+		return nil
 	}
 
-	// Wait for step/continue command from front end.
+	// Wait for step/continue command from the controller, or for the controller to go away.
+	return <-p.waiting
+}
 
-	// TODO(DrMarcII): Race condition here, but it is racing a human, so not too worried about it.
-	waiting := make(chan interface{})
-	d.mu.Lock()
-	d.waiting = waiting
-	d.mu.Unlock()
+// broadcast sends b to every connected front end, disconnecting any that cannot be written to.
+func (d *Debugger) broadcast(b []byte) {
+	d.mu.RLock()
+	clients := append([]*client(nil), d.clients...)
+	d.mu.RUnlock()
 
-	<-waiting
-	d.mu.Lock()
-	d.waiting = nil
-	d.mu.Unlock()
+	for _, c := range clients {
+		if err := c.write(b); err != nil {
+			log.Print(errors.New(d.Name(), fmt.Errorf("error writing to front end: %v", err)))
+			d.disconnect(c)
+		}
+	}
+}
+
+// resume releases the paused request or response identified by cmd.Pause, or the one paused
+// longest if cmd.Pause is 0, with cmd. It returns false if there is no such paused command. d.mu
+// must be held.
+func (d *Debugger) resume(cmd *command) bool {
+	for i, p := range d.pauses {
+		if cmd.Pause == 0 || p.id == cmd.Pause {
+			d.pauses = append(d.pauses[:i], d.pauses[i+1:]...)
+			p.waiting <- cmd
+			return true
+		}
+	}
+	return false
+}
+
+// resumeAll releases every paused request and response with cmd. d.mu must be held.
+func (d *Debugger) resumeAll(cmd *command) {
+	for _, p := range d.pauses {
+		p.waiting <- cmd
+	}
+	d.pauses = nil
 }
 
-func (d *Debugger) waitForConnection(port int) {
+func (d *Debugger) waitForConnections(port int) {
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		d.mu.Lock()
@@ -192,88 +430,241 @@ Waiting for debugger connection on port %d.
 ***********************************************
 `, port)
 
-	conn, err := l.Accept()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if !d.healthy {
+				d.connError = errors.NewPermanent(d.Name(), err)
+			}
+			log.Print(errors.New(d.Name(), err))
+			return
+		}
+		d.Connect(conn)
+	}
+}
+
+// Connect adds conn as a debugger front end. Messages are exchanged over conn as
+// newline-delimited JSON, as with front ends connected over TCP. The front end becomes the
+// controller if there is none and the debugger has not been detached; otherwise it is an
+// observer. When reading from conn fails, the front end is disconnected.
+func (d *Debugger) Connect(conn io.ReadWriter) {
+	c := &client{conn: conn}
+
 	d.mu.Lock()
-	defer d.mu.Unlock()
-	if err != nil {
-		d.connError = errors.NewPermanent(d.Name(), err)
+	d.clients = append(d.clients, c)
+	role := "observer"
+	if d.controller == nil && !d.detached {
+		d.controller = c
+		role = "controller"
+	}
+	var paused [][]byte
+	for _, p := range d.pauses {
+		paused = append(paused, p.message)
+	}
+	d.mu.Unlock()
+
+	if err := c.send(&response{Status: "connected", Role: role}); err != nil {
+		d.disconnect(c)
 		return
 	}
-	d.conn = conn
+	for _, m := range paused {
+		if err := c.write(m); err != nil {
+			d.disconnect(c)
+			return
+		}
+	}
 
-	go d.readLoop()
+	go d.readLoop(c)
 }
 
-func (d *Debugger) readLoop() {
-	decoder := json.NewDecoder(d.conn)
+// disconnect removes c from the connected front ends. If c was the controller, control passes to
+// the longest-connected observer; if there is none, any paused requests are released and the
+// test runs freely until a front end connects.
+func (d *Debugger) disconnect(c *client) {
+	d.mu.Lock()
+	found := false
+	for i, o := range d.clients {
+		if o == c {
+			d.clients = append(d.clients[:i], d.clients[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		d.mu.Unlock()
+		return
+	}
+
+	var promoted *client
+	if d.controller == c {
+		d.controller = nil
+		if len(d.clients) != 0 {
+			promoted = d.clients[0]
+			d.controller = promoted
+		} else {
+			d.step = false
+			d.resumeAll(&command{Command: "continue"})
+		}
+	}
+	d.mu.Unlock()
+
+	if closer, ok := c.conn.(io.Closer); ok {
+		closer.Close()
+	}
+	if promoted != nil {
+		if err := promoted.send(roleChange("controller")); err != nil {
+			d.disconnect(promoted)
+		}
+	}
+}
+
+// roleChange returns the message telling a front end that its role has changed to role.
+func roleChange(role string) *response {
+	return &response{Status: "role", Role: role}
+}
+
+func (d *Debugger) readLoop(c *client) {
+	r := bufio.NewReader(c.conn)
+	decoder := json.NewDecoder(r)
 
 	for {
 		cmd := &command{}
-		if err := decoder.Decode(cmd); err != nil {
-			// do something here...
-			log.Fatalf("Error reading from debugger: %v", err)
+		err := decoder.Decode(cmd)
+		if err == nil {
+			d.processCommand(c, cmd)
+			continue
 		}
 
-		d.processCommand(cmd)
+		switch err.(type) {
+		case *json.UnmarshalTypeError:
+			// The decoder has consumed the malformed command and can carry on.
+		case *json.SyntaxError:
+			// The decoder cannot recover from a syntax error, so drop the rest of the line and
+			// start again with a new one.
+			r = bufio.NewReader(io.MultiReader(decoder.Buffered(), r))
+			if _, err := r.ReadString('\n'); err != nil {
+				d.disconnect(c)
+				return
+			}
+			decoder = json.NewDecoder(r)
+		default:
+			if err != io.EOF {
+				log.Print(errors.New(d.Name(), fmt.Errorf("error reading from front end: %v", err)))
+			}
+			d.disconnect(c)
+			return
+		}
+
+		if err := c.send(&response{Status: "error", Error: fmt.Sprintf("invalid command: %v", err)}); err != nil {
+			d.disconnect(c)
+			return
+		}
 	}
 }
 
-func (d *Debugger) processCommand(cmd *command) {
+func (d *Debugger) processCommand(c *client, cmd *command) {
+	if _, ok := inspectCommands[cmd.Command]; ok {
+		d.inspect(c, cmd)
+		return
+	}
+
 	d.mu.Lock()
-	defer d.mu.Unlock()
 
 	response := &response{ID: cmd.ID, Status: "error"}
+	var demoted *client
 
-	switch cmd.Command {
-	case "continue":
-		d.healthy = true
-		d.step = false
-		if d.waiting != nil {
-			close(d.waiting)
-		}
-		response.Status = "running"
+	switch {
+	case controllerCommands[cmd.Command] && d.controller != c:
+		response.Error = fmt.Sprintf(`%q may only be sent by the controlling front end; send "take control" first`, cmd.Command)
 
-	case "step":
-		d.healthy = true
-		d.step = true
-		if d.waiting != nil {
-			close(d.waiting)
+	case cmd.Command == "continue" || cmd.Command == "step":
+		if !d.resume(cmd) && cmd.Pause != 0 {
+			response.Error = fmt.Sprintf("there is no paused command %d", cmd.Pause)
+			break
 		}
+		d.healthy = true
+		d.step = cmd.Command == "step"
 		response.Status = "running"
 
-	case "stop":
+	case cmd.Command == "stop":
 		os.Exit(-1)
-	case "set breakpoint":
+
+	case cmd.Command == "set breakpoint":
 		if cmd.Breakpoint == nil {
+			response.Error = "set breakpoint requires a breakpoint"
 			break
 		}
 		bp := cmd.Breakpoint
 		if err := bp.initialize(); err != nil {
+			response.Error = fmt.Sprintf("invalid breakpoint: %v", err)
 			break
 		}
+		bp.Hits = 0
 		d.breakpoints[bp.ID] = bp
 		response.Status = "waiting"
 
-	case "delete breakpoint":
+	case cmd.Command == "delete breakpoint":
 		if cmd.Breakpoint == nil {
+			response.Error = "delete breakpoint requires a breakpoint"
 			break
 		}
 		delete(d.breakpoints, cmd.Breakpoint.ID)
 		response.Status = "waiting"
-	}
 
-	bytes, err := json.Marshal(response)
-	if err != nil {
-		log.Print(err)
-		return
+	case cmd.Command == "list breakpoints":
+		response.Breakpoints = []breakpoint{}
+		for _, bp := range d.sortedBreakpoints() {
+			response.Breakpoints = append(response.Breakpoints, *bp)
+		}
+		response.Status = "breakpoints"
+
+	case cmd.Command == "detach":
+		d.healthy = true
+		d.step = false
+		d.detached = true
+		d.controller = nil
+		d.resumeAll(&command{Command: "continue"})
+		response.Status = "running"
+		response.Role = "observer"
+
+	case cmd.Command == "take control":
+		if d.controller != c {
+			demoted = d.controller
+		}
+		d.controller = c
+		d.detached = false
+		response.Status = "running"
+		if len(d.pauses) != 0 {
+			response.Status = "waiting"
+		}
+		response.Role = "controller"
+
+	default:
+		response.Error = fmt.Sprintf("unknown command %q", cmd.Command)
 	}
 
-	if _, err := d.conn.Write(bytes); err != nil {
-		log.Print(err)
+	d.mu.Unlock()
+
+	if err := c.send(response); err != nil {
+		log.Print(errors.New(d.Name(), fmt.Errorf("error writing to front end: %v", err)))
+		d.disconnect(c)
+	}
+	if demoted != nil {
+		if err := demoted.send(roleChange("observer")); err != nil {
+			d.disconnect(demoted)
+		}
 	}
 }
 
 func (bp *breakpoint) initialize() error {
+	switch bp.Target {
+	case "", "request", "response":
+	default:
+		return fmt.Errorf("breakpoint target %q must be request or response", bp.Target)
+	}
+
 	if bp.Path != "" {
 		r, err := regexp.Compile(bp.Path)
 		if err != nil {
@@ -292,12 +683,26 @@ func (bp *breakpoint) initialize() error {
 	return nil
 }
 
-func (bp *breakpoint) matches(r *request) bool {
+// matches returns whether bp matches r, or its response resp if resp is non-nil. Request
+// breakpoints only match requests, and response breakpoints only match responses.
+func (bp *breakpoint) matches(r *request, resp *responseInfo) bool {
+	if (resp != nil) != (bp.Target == "response") {
+		return false
+	}
+
+	if bp.Session != "" && sessionID(r.Path) != bp.Session {
+		return false
+	}
+
 	if bp.pathRegex != nil && bp.pathRegex.FindString(r.Path) == "" {
 		return false
 	}
 
-	if bp.bodyRegex != nil && bp.bodyRegex.FindString(r.Body) == "" {
+	body := r.Body
+	if resp != nil {
+		body = resp.Body
+	}
+	if bp.bodyRegex != nil && bp.bodyRegex.FindString(body) == "" {
 		return false
 	}
 
@@ -314,9 +719,52 @@ func (bp *breakpoint) matches(r *request) bool {
 		}
 	}
 
+	if resp != nil && len(bp.Statuses) != 0 {
+		found := false
+		for _, status := range bp.Statuses {
+			if resp.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
 	return true
 }
 
+// format returns bp's log message for r, or its response resp if resp is non-nil.
+func (bp *breakpoint) format(r *request, resp *responseInfo) string {
+	body := r.Body
+	status := ""
+	if resp != nil {
+		body = resp.Body
+		status = strconv.Itoa(resp.Status)
+	}
+	return strings.NewReplacer(
+		"{method}", r.Method,
+		"{path}", r.Path,
+		"{session}", sessionID(r.Path),
+		"{body}", body,
+		"{status}", status,
+		"{hits}", strconv.Itoa(bp.Hits),
+	).Replace(bp.Log)
+}
+
+// sessionID returns the session ID from a path of the form .../session/{id}/..., or "" if path
+// does not include one.
+func sessionID(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if s == "session" && i+1 < len(segments) {
+			return segments[i+1]
+		}
+	}
+	return ""
+}
+
 type capturedReader struct {
 	io.Reader
 	io.Closer
@@ -15,11 +15,26 @@
 package debugger
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
 )
 
 func TestBreakpointMatches(t *testing.T) {
@@ -143,6 +158,36 @@ func TestBreakpointMatches(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"matching session",
+			&breakpoint{
+				Session: "abc",
+			},
+			&request{
+				Path: "/wd/hub/session/abc/url",
+			},
+			true,
+		},
+		{
+			"non-matching session",
+			&breakpoint{
+				Session: "abc",
+			},
+			&request{
+				Path: "/wd/hub/session/abcd/url",
+			},
+			false,
+		},
+		{
+			"session breakpoint does not match new session",
+			&breakpoint{
+				Session: "abc",
+			},
+			&request{
+				Path: "/wd/hub/session",
+			},
+			false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -150,8 +195,8 @@ func TestBreakpointMatches(t *testing.T) {
 			if err := tc.breakpoint.initialize(); err != nil {
 				t.Fatal(err)
 			}
-			if m := tc.breakpoint.matches(tc.request); m != tc.matches {
-				t.Fatalf("got %+v.matches(%+v) == %v, expected %v", tc.breakpoint, tc.request, m, tc.matches)
+			if m := tc.breakpoint.matches(tc.request, nil); m != tc.matches {
+				t.Fatalf("got %+v.matches(%+v, nil) == %v, expected %v", tc.breakpoint, tc.request, m, tc.matches)
 			}
 		})
 	}
@@ -200,3 +245,581 @@ func TestCapture(t *testing.T) {
 		t.Errorf("Got f.closed == false, expected true")
 	}
 }
+
+func TestBreakpointMatchesResponse(t *testing.T) {
+	testCases := []struct {
+		name       string
+		breakpoint *breakpoint
+		request    *request
+		response   *responseInfo
+		matches    bool
+	}{
+		{
+			"empty breakpoint matches everything",
+			&breakpoint{Target: "response"},
+			&request{},
+			&responseInfo{},
+			true,
+		},
+		{
+			"matching status",
+			&breakpoint{Target: "response", Statuses: []int{404, 500}},
+			&request{},
+			&responseInfo{Status: 500},
+			true,
+		},
+		{
+			"non-matching status",
+			&breakpoint{Target: "response", Statuses: []int{404, 500}},
+			&request{},
+			&responseInfo{Status: 200},
+			false,
+		},
+		{
+			"matching response body",
+			&breakpoint{Target: "response", Body: "stale element"},
+			&request{Body: "no match"},
+			&responseInfo{Body: `{"error": "stale element reference"}`},
+			true,
+		},
+		{
+			"non-matching response body",
+			&breakpoint{Target: "response", Body: "stale element"},
+			&request{Body: "stale element"},
+			&responseInfo{Body: `{"value": null}`},
+			false,
+		},
+		{
+			"matching status and non-matching path",
+			&breakpoint{Target: "response", Path: "url", Statuses: []int{200}},
+			&request{Path: "/wd/hub/session/abc/elements"},
+			&responseInfo{Status: 200},
+			false,
+		},
+		{
+			"request breakpoint never matches responses",
+			&breakpoint{},
+			&request{},
+			&responseInfo{},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.breakpoint.initialize(); err != nil {
+				t.Fatal(err)
+			}
+			if m := tc.breakpoint.matches(tc.request, tc.response); m != tc.matches {
+				t.Fatalf("got %+v.matches(%+v, %+v) == %v, expected %v", tc.breakpoint, tc.request, tc.response, m, tc.matches)
+			}
+		})
+	}
+}
+
+func TestInvalidBreakpointTarget(t *testing.T) {
+	bp := &breakpoint{Target: "both"}
+	if err := bp.initialize(); err == nil {
+		t.Error("Got nil error for invalid target, expected error")
+	}
+}
+
+// fakeFrontEnd is a front end connected to a Debugger over an in-memory pipe.
+type fakeFrontEnd struct {
+	conn     net.Conn
+	messages chan map[string]interface{}
+}
+
+// connect connects a fake front end to d, returning it once it has received the connected
+// message, whose role must be role.
+func connect(t *testing.T, d *Debugger, role string) *fakeFrontEnd {
+	t.Helper()
+	server, client := net.Pipe()
+	f := &fakeFrontEnd{
+		conn:     client,
+		messages: make(chan map[string]interface{}, 10),
+	}
+	go func() {
+		decoder := json.NewDecoder(client)
+		for {
+			m := map[string]interface{}{}
+			if err := decoder.Decode(&m); err != nil {
+				close(f.messages)
+				return
+			}
+			f.messages <- m
+		}
+	}()
+	d.Connect(server)
+
+	if m := f.next(t); m["status"] != "connected" || m["role"] != role {
+		t.Fatalf("Got %v, expected connected message with role %s", m, role)
+	}
+	return f
+}
+
+func (f *fakeFrontEnd) send(t *testing.T, cmd string) {
+	t.Helper()
+	if _, err := io.WriteString(f.conn, cmd+"\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeFrontEnd) next(t *testing.T) map[string]interface{} {
+	t.Helper()
+	select {
+	case m, ok := <-f.messages:
+		if !ok {
+			t.Fatal("front end connection closed")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+func newDebugger() *Debugger {
+	return &Debugger{breakpoints: map[int]*breakpoint{}}
+}
+
+func TestEditPausedResponse(t *testing.T) {
+	d := newDebugger()
+	fe := connect(t, d, "controller")
+
+	fe.send(t, `{"id": 1, "command": "set breakpoint", "breakpoint": {"id": 1, "target": "response", "statuses": [404]}}`)
+	fe.next(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/abc/url", nil)
+	result := make(chan []byte)
+	go func() {
+		result <- d.Response(r, 404, []byte(`{"error": "no such window"}`))
+	}()
+
+	m := fe.next(t)
+	if m["status"] != "waiting" {
+		t.Fatalf("Got %v, expected waiting status", m)
+	}
+	if got := m["response"].(map[string]interface{})["body"]; got != `{"error": "no such window"}` {
+		t.Errorf("Got paused response body %v, expected the original body", got)
+	}
+
+	fe.send(t, `{"id": 2, "command": "continue", "body": "{\"value\": \"edited\"}"}`)
+	if got := string(<-result); got != `{"value": "edited"}` {
+		t.Errorf(`Got body %q, expected {"value": "edited"}`, got)
+	}
+}
+
+func TestEditPausedRequest(t *testing.T) {
+	d := newDebugger()
+	fe := connect(t, d, "controller")
+
+	fe.send(t, `{"id": 1, "command": "set breakpoint", "breakpoint": {"id": 1, "path": "url"}}`)
+	fe.next(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/wd/hub/session/abc/url", strings.NewReader(`{"url": "http://a"}`))
+	done := make(chan struct{})
+	go func() {
+		d.Request(r)
+		close(done)
+	}()
+
+	if m := fe.next(t); m["status"] != "waiting" {
+		t.Fatalf("Got %v, expected waiting status", m)
+	}
+
+	fe.send(t, `{"id": 2, "command": "continue", "body": "{\"url\": \"http://b\"}"}`)
+	<-done
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"url": "http://b"}` {
+		t.Errorf(`Got request body %q, expected {"url": "http://b"}`, b)
+	}
+}
+
+func TestConcurrentPauses(t *testing.T) {
+	d := newDebugger()
+	fe := connect(t, d, "controller")
+
+	fe.send(t, `{"id": 1, "command": "set breakpoint", "breakpoint": {"id": 1, "path": "url"}}`)
+	fe.next(t)
+
+	done := map[string]chan struct{}{}
+	pauses := map[string]float64{}
+	for _, sid := range []string{"first", "second"} {
+		r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/"+sid+"/url", nil)
+		done[sid] = make(chan struct{})
+		go func(c chan struct{}) {
+			d.Request(r)
+			close(c)
+		}(done[sid])
+
+		m := fe.next(t)
+		if m["status"] != "waiting" {
+			t.Fatalf("Got %v, expected waiting status", m)
+		}
+		pauses[sid] = m["pause"].(float64)
+	}
+
+	// Releasing the second pause must not strand the first.
+	fe.send(t, fmt.Sprintf(`{"id": 2, "command": "continue", "pause": %v}`, pauses["second"]))
+	<-done["second"]
+	fe.next(t)
+
+	select {
+	case <-done["first"]:
+		t.Fatal("Got first request released by continuing the second, expected it still paused")
+	default:
+	}
+
+	fe.send(t, `{"id": 3, "command": "continue"}`)
+	<-done["first"]
+	fe.next(t)
+
+	fe.send(t, fmt.Sprintf(`{"id": 4, "command": "continue", "pause": %v}`, pauses["first"]))
+	if m := fe.next(t); m["status"] != "error" {
+		t.Errorf("Got %v continuing a released pause, expected error", m)
+	}
+}
+
+func TestNoFrontEnd(t *testing.T) {
+	d := newDebugger()
+	d.step = true
+
+	// With no front end connected, requests are neither written anywhere nor paused.
+	r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/abc/url", nil)
+	d.Request(r)
+	if got := d.Response(r, 200, []byte("body")); string(got) != "body" {
+		t.Errorf("Got body %q, expected body", got)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	d := newDebugger()
+	fe := connect(t, d, "controller")
+
+	for _, tc := range []struct {
+		cmd  string
+		want string
+	}{
+		{`not json`, "invalid command"},
+		{`{"id": 1, "command": "dance"}`, "unknown command"},
+		{`{"id": 2, "command": "set breakpoint"}`, "requires a breakpoint"},
+		{`{"id": 3, "command": "set breakpoint", "breakpoint": {"id": 1, "path": "("}}`, "invalid breakpoint"},
+	} {
+		fe.send(t, tc.cmd)
+		m := fe.next(t)
+		if m["status"] != "error" || !strings.Contains(m["error"].(string), tc.want) {
+			t.Errorf("Got %v for %s, expected error containing %q", m, tc.cmd, tc.want)
+		}
+	}
+
+	// The connection is still usable, including for commands not separated by newlines.
+	if _, err := io.WriteString(fe.conn, `{"id": 4, "command": "step"}{"id": 5, "command": "continue"}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []float64{4, 5} {
+		if m := fe.next(t); m["id"] != id || m["status"] != "running" {
+			t.Errorf("Got %v, expected running status for command %v", m, id)
+		}
+	}
+}
+
+func TestObserversAndControl(t *testing.T) {
+	d := newDebugger()
+	controller := connect(t, d, "controller")
+	observer := connect(t, d, "observer")
+
+	controller.send(t, `{"id": 1, "command": "set breakpoint", "breakpoint": {"id": 1, "path": "url"}}`)
+	controller.next(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/abc/url", nil)
+	done := make(chan struct{})
+	go func() {
+		d.Request(r)
+		close(done)
+	}()
+
+	for _, fe := range []*fakeFrontEnd{controller, observer} {
+		if m := fe.next(t); m["status"] != "waiting" {
+			t.Fatalf("Got %v, expected waiting status", m)
+		}
+	}
+
+	observer.send(t, `{"id": 1, "command": "continue"}`)
+	if m := observer.next(t); m["status"] != "error" {
+		t.Errorf("Got %v for continue from observer, expected error", m)
+	}
+
+	observer.send(t, `{"id": 2, "command": "take control"}`)
+	if m := observer.next(t); m["role"] != "controller" || m["status"] != "waiting" {
+		t.Errorf("Got %v for take control, expected controller role while waiting", m)
+	}
+	if m := controller.next(t); m["status"] != "role" || m["role"] != "observer" {
+		t.Errorf("Got %v, expected role change to observer", m)
+	}
+
+	// A front end connecting while paused is told about the pause.
+	late := connect(t, d, "observer")
+	if m := late.next(t); m["status"] != "waiting" {
+		t.Errorf("Got %v, expected replayed waiting message", m)
+	}
+
+	observer.send(t, `{"id": 3, "command": "continue"}`)
+	<-done
+}
+
+func TestControllerDisconnect(t *testing.T) {
+	d := newDebugger()
+	controller := connect(t, d, "controller")
+	observer := connect(t, d, "observer")
+
+	controller.send(t, `{"id": 1, "command": "step"}`)
+	controller.next(t)
+
+	controller.conn.Close()
+	if m := observer.next(t); m["status"] != "role" || m["role"] != "controller" {
+		t.Fatalf("Got %v, expected role change to controller", m)
+	}
+
+	// When the last front end disconnects while paused, the test keeps running.
+	r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/abc/url", nil)
+	done := make(chan struct{})
+	go func() {
+		d.Request(r)
+		close(done)
+	}()
+	if m := observer.next(t); m["status"] != "waiting" {
+		t.Fatalf("Got %v, expected waiting status", m)
+	}
+	observer.conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request still paused after the last front end disconnected")
+	}
+
+	// A front end reconnecting afterwards becomes the controller.
+	connect(t, d, "controller")
+}
+
+func TestDetach(t *testing.T) {
+	d := newDebugger()
+	fe := connect(t, d, "controller")
+
+	fe.send(t, `{"id": 1, "command": "set breakpoint", "breakpoint": {"id": 1}}`)
+	fe.next(t)
+	fe.send(t, `{"id": 2, "command": "detach"}`)
+	if m := fe.next(t); m["role"] != "observer" {
+		t.Fatalf("Got %v, expected observer role", m)
+	}
+	if err := d.Healthy(context.Background()); err != nil {
+		t.Errorf("Got %v from Healthy after detach, expected nil", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/abc/url", nil)
+	d.Request(r)
+	if m := fe.next(t); m["status"] != "running" {
+		t.Errorf("Got %v, expected running status while detached", m)
+	}
+
+	// New front ends observe until one takes control.
+	connect(t, d, "observer")
+	fe.send(t, `{"id": 3, "command": "take control"}`)
+	if m := fe.next(t); m["role"] != "controller" {
+		t.Errorf("Got %v, expected controller role", m)
+	}
+}
+
+func TestBreakpointJSON(t *testing.T) {
+	bp := &breakpoint{}
+	if err := json.Unmarshal([]byte(`{"id": 1, "body": "google", "session": "abc", "hitCount": 2, "once": true, "log": "{path}"}`), bp); err != nil {
+		t.Fatal(err)
+	}
+	want := breakpoint{ID: 1, Body: "google", Session: "abc", HitCount: 2, Once: true, Log: "{path}"}
+	if !reflect.DeepEqual(*bp, want) {
+		t.Errorf("Got %+v, expected %+v", *bp, want)
+	}
+
+	b, err := json.Marshal(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"body":"google"`) {
+		t.Errorf(`Got %s, expected "body":"google"`, b)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	d := newDebugger()
+	for _, bp := range []*breakpoint{
+		{ID: 1, Path: "url", HitCount: 3},
+		{ID: 2, Path: "url", Once: true},
+		{ID: 3, Path: "url", Log: "{method} {session} {body} hit {hits}"},
+		{ID: 4, Target: "response", Statuses: []int{500}, Log: "{path} returned {status}: {body}"},
+	} {
+		if err := bp.initialize(); err != nil {
+			t.Fatal(err)
+		}
+		d.breakpoints[bp.ID] = bp
+	}
+
+	r := &request{Method: "POST", Path: "/wd/hub/session/abc/url", Body: "{}"}
+	for i, want := range []bool{true, false, true, true} {
+		pause, logs := d.evaluate(r, nil)
+		if pause != want {
+			t.Errorf("Got pause %v for hit %d, expected %v", pause, i+1, want)
+		}
+		if len(logs) != 1 || logs[0].Breakpoint != 3 || logs[0].Message != fmt.Sprintf("POST abc {} hit %d", i+1) {
+			t.Errorf("Got logs %+v for hit %d, expected a message from logpoint 3", logs, i+1)
+		}
+	}
+	if _, ok := d.breakpoints[2]; ok {
+		t.Error("One-shot breakpoint 2 still exists after triggering")
+	}
+	if d.breakpoints[1].Hits != 4 {
+		t.Errorf("Got %d hits for breakpoint 1, expected 4", d.breakpoints[1].Hits)
+	}
+
+	pause, logs := d.evaluate(r, &responseInfo{Status: 500, Body: "oops"})
+	if pause {
+		t.Error("Got pause for response matching only a logpoint")
+	}
+	if len(logs) != 1 || logs[0].Message != "/wd/hub/session/abc/url returned 500: oops" {
+		t.Errorf("Got logs %+v, expected a message from logpoint 4", logs)
+	}
+}
+
+func TestListBreakpoints(t *testing.T) {
+	d := newDebugger()
+	controller := connect(t, d, "controller")
+	observer := connect(t, d, "observer")
+
+	controller.send(t, `{"id": 1, "command": "set breakpoint", "breakpoint": {"id": 2, "path": "url", "hits": 10}}`)
+	controller.next(t)
+	controller.send(t, `{"id": 2, "command": "set breakpoint", "breakpoint": {"id": 1, "log": "{path}"}}`)
+	controller.next(t)
+
+	observer.send(t, `{"id": 1, "command": "list breakpoints"}`)
+	m := observer.next(t)
+	if m["status"] != "breakpoints" {
+		t.Fatalf("Got %v, expected breakpoints status", m)
+	}
+	bps := m["breakpoints"].([]interface{})
+	if len(bps) != 2 {
+		t.Fatalf("Got %d breakpoints, expected 2", len(bps))
+	}
+	for i, want := range []float64{1, 2} {
+		bp := bps[i].(map[string]interface{})
+		if bp["id"] != want || bp["hits"] != float64(0) {
+			t.Errorf("Got breakpoint %v at index %d, expected id %v with no hits", bp, i, want)
+		}
+	}
+}
+
+type fakeWebDriver struct {
+	webdriver.WebDriver
+}
+
+func (*fakeWebDriver) PageSource(context.Context) (string, error) {
+	return "<html></html>", nil
+}
+
+func (*fakeWebDriver) CurrentURL(context.Context) (*url.URL, error) {
+	return url.Parse("http://example.com/page")
+}
+
+func (*fakeWebDriver) Screenshot(context.Context) (image.Image, error) {
+	return image.NewRGBA(image.Rect(0, 0, 2, 2)), nil
+}
+
+func (*fakeWebDriver) ExecuteScript(_ context.Context, script string, args []interface{}, value interface{}) error {
+	*(value.(*interface{})) = fmt.Sprintf("%s%v", script, args)
+	return nil
+}
+
+func TestInspect(t *testing.T) {
+	d := newDebugger()
+	d.webDrivers = func(id string) (webdriver.WebDriver, error) {
+		if id != "abc" {
+			return nil, fmt.Errorf("session %s does not exist", id)
+		}
+		return &fakeWebDriver{}, nil
+	}
+	controller := connect(t, d, "controller")
+	observer := connect(t, d, "observer")
+
+	controller.send(t, `{"id": 1, "command": "page source"}`)
+	if m := controller.next(t); m["status"] != "error" || !strings.Contains(m["error"].(string), "paused") {
+		t.Errorf("Got %v while running, expected error", m)
+	}
+
+	controller.send(t, `{"id": 2, "command": "set breakpoint", "breakpoint": {"id": 1, "path": "url"}}`)
+	controller.next(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/wd/hub/session/abc/url", nil)
+	done := make(chan struct{})
+	go func() {
+		d.Request(r)
+		close(done)
+	}()
+	for _, fe := range []*fakeFrontEnd{controller, observer} {
+		if m := fe.next(t); m["status"] != "waiting" {
+			t.Fatalf("Got %v, expected waiting status", m)
+		}
+	}
+
+	for _, tc := range []struct {
+		fe   *fakeFrontEnd
+		cmd  string
+		want interface{}
+	}{
+		{observer, `{"id": 3, "command": "page source"}`, "<html></html>"},
+		{observer, `{"id": 4, "command": "current url"}`, "http://example.com/page"},
+		{controller, `{"id": 5, "command": "execute script", "script": "return 1;", "args": [2]}`, "return 1;[2]"},
+	} {
+		tc.fe.send(t, tc.cmd)
+		m := tc.fe.next(t)
+		if m["status"] != "result" || m["session"] != "abc" || m["result"] != tc.want {
+			t.Errorf("Got %v for %s, expected result %v", m, tc.cmd, tc.want)
+		}
+	}
+
+	controller.send(t, `{"id": 6, "command": "screenshot"}`)
+	m := controller.next(t)
+	b, err := base64.StdEncoding.DecodeString(m["result"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(b)); err != nil {
+		t.Errorf("Got invalid screenshot: %v", err)
+	}
+
+	for _, tc := range []struct {
+		fe   *fakeFrontEnd
+		cmd  string
+		want string
+	}{
+		{observer, `{"id": 7, "command": "execute script", "script": "return 1;"}`, "controlling"},
+		{controller, `{"id": 8, "command": "page source", "session": "def"}`, "does not exist"},
+		{controller, `{"id": 9, "command": "find elements"}`, "required"},
+	} {
+		tc.fe.send(t, tc.cmd)
+		if m := tc.fe.next(t); m["status"] != "error" || !strings.Contains(m["error"].(string), tc.want) {
+			t.Errorf("Got %v for %s, expected error containing %q", m, tc.cmd, tc.want)
+		}
+	}
+
+	select {
+	case <-done:
+		t.Fatal("Request returned while paused")
+	default:
+	}
+
+	controller.send(t, `{"id": 10, "command": "continue"}`)
+	<-done
+}
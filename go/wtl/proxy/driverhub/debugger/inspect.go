@@ -0,0 +1,145 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debugger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"log"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+)
+
+// inspectTimeout bounds how long an inspection command may take.
+const inspectTimeout = time.Minute
+
+// WebDriverLookup returns the WebDriver client for the session with the given ID.
+type WebDriverLookup func(sessionID string) (webdriver.WebDriver, error)
+
+// inspectCommands run WebDriver operations on a session while the debugger is paused. The
+// values are whether the command may only be sent by the controller.
+var inspectCommands = map[string]bool{
+	"screenshot":     false,
+	"page source":    false,
+	"current url":    false,
+	"find elements":  false,
+	"execute script": true,
+}
+
+// inspect runs an inspection command and sends its result to c. It runs without holding d.mu,
+// so the paused request or response stays blocked while the browser is inspected.
+func (d *Debugger) inspect(c *client, cmd *command) {
+	resp := &response{ID: cmd.ID, Status: "error"}
+
+	d.mu.RLock()
+	paused := len(d.pauses) != 0
+	controlling := d.controller == c
+	sid := cmd.Session
+	if sid == "" && paused {
+		sid = d.pauses[0].session
+	}
+	d.mu.RUnlock()
+
+	switch {
+	case !paused:
+		resp.Error = fmt.Sprintf("%q may only be sent while the debugger is paused", cmd.Command)
+	case inspectCommands[cmd.Command] && !controlling:
+		resp.Error = fmt.Sprintf(`%q may only be sent by the controlling front end; send "take control" first`, cmd.Command)
+	case sid == "":
+		resp.Error = fmt.Sprintf("%q requires a session; the paused command does not belong to one", cmd.Command)
+	case d.webDrivers == nil:
+		resp.Error = fmt.Sprintf("%q is not supported by this debugger", cmd.Command)
+	default:
+		wd, err := d.webDrivers(sid)
+		if err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), inspectTimeout)
+		result, err := runInspection(ctx, wd, cmd)
+		cancel()
+		if err != nil {
+			resp.Error = fmt.Sprintf("%s failed for session %s: %v", cmd.Command, sid, err)
+			break
+		}
+		resp.Status = "result"
+		resp.Session = sid
+		resp.Result = result
+	}
+
+	if err := c.send(resp); err != nil {
+		log.Print(errors.New(d.Name(), fmt.Errorf("error writing to front end: %v", err)))
+		d.disconnect(c)
+	}
+}
+
+func runInspection(ctx context.Context, wd webdriver.WebDriver, cmd *command) (interface{}, error) {
+	switch cmd.Command {
+	case "screenshot":
+		img, err := wd.Screenshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		buf := &bytes.Buffer{}
+		if err := png.Encode(buf, img); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+
+	case "page source":
+		return wd.PageSource(ctx)
+
+	case "current url":
+		u, err := wd.CurrentURL(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return u.String(), nil
+
+	case "find elements":
+		if cmd.Using == "" || cmd.Value == "" {
+			return nil, fmt.Errorf("using and value are required")
+		}
+		elements, err := wd.FindElements(ctx, cmd.Using, cmd.Value)
+		if err != nil {
+			return nil, err
+		}
+		result := []map[string]string{}
+		for _, e := range elements {
+			result = append(result, e.ToMap())
+		}
+		return result, nil
+
+	case "execute script":
+		if cmd.Script == "" {
+			return nil, fmt.Errorf("script is required")
+		}
+		args := cmd.Args
+		if args == nil {
+			args = []interface{}{}
+		}
+		var value interface{}
+		if err := wd.ExecuteScript(ctx, cmd.Script, args, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", cmd.Command)
+}
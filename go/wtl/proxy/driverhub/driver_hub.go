@@ -16,14 +16,19 @@
 package driverhub
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"reflect"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/errors"
@@ -31,7 +36,9 @@ import (
 	"github.com/bazelbuild/rules_webtesting/go/httphelper"
 	"github.com/bazelbuild/rules_webtesting/go/metadata"
 	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/websocket"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy"
@@ -41,6 +48,17 @@ import (
 
 const envTimeout = 5 * time.Minute // some environments such as Android take a long time to start up.
 
+var (
+	envHealthTransitions = metrics.NewCounter("webtesting_environment_health_transitions_total",
+		"Number of times the environment health changed, by environment and new state.", "environment", "state")
+)
+
+const (
+	envHealthUnknown int32 = iota
+	envHealthHealthy
+	envHealthUnhealthy
+)
+
 // WebDriverHub routes message to the various WebDriver sessions.
 type WebDriverHub struct {
 	*mux.Router
@@ -52,18 +70,32 @@ type WebDriverHub struct {
 	Debugger *debugger.Debugger
 
 	healthyOnce sync.Once
+	envHealth   int32
+
+	sessionOpts sessionOptions
+
+	reaperStop chan struct{}
+	reaperOnce sync.Once
 
 	mu               sync.RWMutex
 	sessions         map[string]*WebDriverSession
 	reusableSessions []*WebDriverSession
 	nextID           int
+	reaped           map[string]string
+	reapedOrder      []string
+	reapedCount      int
+	// Session queues, keyed by the environment whose sessions they limit.
+	queues map[environment.Env]*sessionQueue
 }
 
 // NewHandler creates a handler for /wd/hub paths that delegates to a WebDriver server instance provided by env.
 func HTTPHandlerProvider(p *proxy.Proxy) (proxy.HTTPHandler, error) {
-	var d *debugger.Debugger
-	if p.Metadata.DebuggerPort != 0 {
-		d = debugger.New(p.Metadata.DebuggerPort)
+	opts, err := extractSessionOptions(p.Metadata)
+	if err != nil {
+		return nil, errors.New("WebDriver Hub", err)
+	}
+	if err := validate(p.Metadata, nil); err != nil {
+		return nil, errors.New("WebDriver Hub", err)
 	}
 	h := &WebDriverHub{
 		Router:      mux.NewRouter(),
@@ -73,25 +105,106 @@ func HTTPHandlerProvider(p *proxy.Proxy) (proxy.HTTPHandler, error) {
 		Diagnostics: p.Diagnostics,
 		Metadata:    p.Metadata,
 		Proxy:       p,
-		Debugger:    d,
+		sessionOpts: opts,
+	}
+	if p.Metadata.DebuggerPort != 0 {
+		h.Debugger = debugger.New(p.Metadata.DebuggerPort, h.webDriver)
 	}
 
 	h.Path("/wd/hub/session").Methods("POST").HandlerFunc(h.createSession)
 	h.Path("/wd/hub/session").HandlerFunc(unknownMethod)
+	h.Path("/wd/hub/sessions").Methods("GET").HandlerFunc(h.listSessions)
+	h.Path("/wd/hub/status").Methods("GET").HandlerFunc(h.status)
+	h.Path("/wd/hub/session/{sessionID}/se/{protocol}").MatcherFunc(isWebSocketUpgrade).HandlerFunc(h.routeWebSocketToSession)
 	h.PathPrefix("/wd/hub/session/{sessionID}").HandlerFunc(h.routeToSession)
 	h.PathPrefix("/wd/hub/{command}").HandlerFunc(h.defaultForward)
 	h.PathPrefix("/").HandlerFunc(unknownCommand)
 
+	if opts.idleTimeout > 0 {
+		h.startReaper(opts.idleTimeout)
+	}
+
 	return h, nil
 }
 
 func (h *WebDriverHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.Debugger != nil {
-		// allow debugger to pause for breakpoint, log to debugger front-end.
-		h.Debugger.Request(r)
+	// WebSocket connections cannot be buffered, so the debugger does not see them.
+	if h.Debugger == nil || websocket.IsUpgrade(r) {
+		h.Router.ServeHTTP(w, r)
+		return
 	}
-	// TODO(DrMarcII) add support for breakpointing on responses.
-	h.Router.ServeHTTP(w, r)
+
+	// Commands paused by the debugger are active, so their sessions are not reaped.
+	release := h.holdSession(r)
+	defer release()
+
+	// allow debugger to pause for breakpoint, log to debugger front-end.
+	h.Debugger.Request(r)
+
+	// Buffer the response so the debugger can pause on it and the front-end can modify it.
+	bw := newBufferedResponseWriter(w)
+	h.Router.ServeHTTP(bw, r)
+	if bw.hijacked {
+		return
+	}
+	body := h.Debugger.Response(r, bw.status, bw.body.Bytes())
+
+	for k, v := range bw.header {
+		w.Header()[k] = v
+	}
+	if w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(bw.status)
+	w.Write(body)
+}
+
+// bufferedResponseWriter is an http.ResponseWriter that holds the response in memory. Hijacking
+// it hijacks the underlying ResponseWriter, after which nothing should be written to either.
+type bufferedResponseWriter struct {
+	rw       http.ResponseWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	wrote    bool
+	hijacked bool
+}
+
+func newBufferedResponseWriter(rw http.ResponseWriter) *bufferedResponseWriter {
+	return &bufferedResponseWriter{
+		rw:     rw,
+		header: http.Header{},
+		status: http.StatusOK,
+	}
+}
+
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponseWriter) WriteHeader(status int) {
+	if b.wrote {
+		return
+	}
+	b.wrote = true
+	b.status = status
+}
+
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := b.rw.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("WebDriver Hub", "response writer does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err == nil {
+		b.hijacked = true
+	}
+	return conn, brw, err
 }
 
 // Name is the name of the component used in error messages.
@@ -134,6 +247,15 @@ func (h *WebDriverHub) GetSession(id string) *WebDriverSession {
 	return h.sessions[id]
 }
 
+// webDriver returns the WebDriver client for the session with the given ID, for use by the debugger.
+func (h *WebDriverHub) webDriver(id string) (webdriver.WebDriver, error) {
+	session := h.GetSession(id)
+	if session == nil {
+		return nil, fmt.Errorf("session %s does not exist", id)
+	}
+	return session.WebDriver, nil
+}
+
 // NextID gets the next available internal id for a session.
 func (h *WebDriverHub) NextID() int {
 	h.mu.Lock()
@@ -154,11 +276,25 @@ func (h *WebDriverHub) GetActiveSessions() []string {
 	return result
 }
 
+// FromProxy returns the WebDriverHub among p's handlers, or nil if there is none. Handlers that use
+// the hub should look it up on each request, since handler providers are not called in any
+// particular order.
+func FromProxy(p *proxy.Proxy) *WebDriverHub {
+	for _, h := range p.HTTPHandlers() {
+		if hub, ok := h.(*WebDriverHub); ok {
+			return hub
+		}
+	}
+	return nil
+}
+
 // Shutdown  shuts down any running sessions.
 func (h *WebDriverHub) Shutdown(ctx context.Context) error {
+	h.stopReaper()
 	for _, id := range h.GetActiveSessions() {
 		session := h.GetSession(id)
 		if session != nil {
+			session.closeWebSockets()
 			session.quit(ctx, false)
 		}
 	}
@@ -198,19 +334,52 @@ func (h *WebDriverHub) AddReusableSession(session *WebDriverSession) error {
 }
 
 func (h *WebDriverHub) routeToSession(w http.ResponseWriter, r *http.Request) {
+	if session, ok := h.requestSession(w, r); ok {
+		session.ServeHTTP(w, r)
+	}
+}
+
+func (h *WebDriverHub) routeWebSocketToSession(w http.ResponseWriter, r *http.Request) {
+	if session, ok := h.requestSession(w, r); ok {
+		session.forwardWebSocket(w, r)
+	}
+}
+
+// requestSession returns the session named in r's path. If there is no such session, it writes
+// an invalid session id error to w and returns false.
+func (h *WebDriverHub) requestSession(w http.ResponseWriter, r *http.Request) (*WebDriverSession, bool) {
 	sid := mux.Vars(r)["sessionID"]
 	session := h.GetSession(sid)
 
 	if session == nil {
+		if message, ok := h.reapedMessage(sid); ok {
+			invalidSessionIDMessage(w, message)
+			return nil, false
+		}
 		invalidSessionID(w, sid)
-		return
+		return nil, false
 	}
-	session.ServeHTTP(w, r)
+	return session, true
 }
 
 func (h *WebDriverHub) createSession(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	browser := "unknown"
+	created := false
+	defer func() {
+		if created {
+			metrics.SessionsCreated.Inc(browser)
+		} else {
+			metrics.SessionsFailed.Inc(browser)
+		}
+	}()
+
+	if h.Proxy != nil && h.Proxy.Draining() {
+		sessionNotCreated(w, errors.New(h.Name(), "WTL is shutting down and is not accepting new sessions"))
+		return
+	}
+
 	if err := h.waitForHealthyEnv(ctx); err != nil {
 		sessionNotCreated(w, err)
 		return
@@ -234,15 +403,42 @@ func (h *WebDriverHub) createSession(w http.ResponseWriter, r *http.Request) {
 		sessionNotCreated(w, err)
 		return
 	}
+	if bn, ok := requestedCaps.AlwaysMatch["browserName"].(string); ok && bn != "" {
+		browser = bn
+	}
+
+	env, err := h.selectEnv(requestedCaps)
+	if err != nil {
+		sessionNotCreated(w, err)
+		return
+	}
+
+	release, err := h.waitForSessionSlot(ctx, env)
+	if err != nil {
+		sessionNotCreated(w, err)
+		return
+	}
 
 	id := h.NextID()
 
-	caps, err := h.Env.StartSession(ctx, id, requestedCaps)
+	caps, err := env.StartSession(ctx, id, requestedCaps)
 	if err != nil {
+		release()
 		sessionNotCreated(w, err)
 		return
 	}
 
+	// Handlers read their configuration from caps, so it is checked before the browser is started
+	// rather than failing every command sent to the session.
+	if err := validate(h.Metadata, caps); err != nil {
+		if err2 := env.StopSession(ctx, id); err2 != nil {
+			log.Printf("error stopping session after rejecting its capabilities: %v", err2)
+		}
+		release()
+		invalidArgument(w, err)
+		return
+	}
+
 	var session *WebDriverSession
 
 	if reusable, ok := h.GetReusableSession(ctx, caps); ok {
@@ -250,37 +446,49 @@ func (h *WebDriverHub) createSession(w http.ResponseWriter, r *http.Request) {
 		session = reusable
 	} else {
 		// TODO(DrMarcII) parameterize attempts based on browser metadata
-		driver, err := webdriver.CreateSession(ctx, h.Env.WDAddress(ctx), 3, caps.Strip("google:canReuseSession"))
+		driver, err := webdriver.CreateSession(ctx, env.WDAddress(ctx), 3, caps.Strip(capabilityNames...))
 		if err != nil {
-			if err2 := h.Env.StopSession(ctx, id); err2 != nil {
+			if err2 := env.StopSession(ctx, id); err2 != nil {
 				log.Printf("error stopping session after failing to launch webdriver: %v", err2)
 			}
+			release()
 			sessionNotCreated(w, err)
 			return
 		}
 
+		environment.NotifySessionCreated(ctx, env, id, driver.SessionID())
+
 		s, err := CreateSession(id, h, driver, caps)
 		if err != nil {
+			release()
 			sessionNotCreated(w, err)
 			return
 		}
+		s.Env = env
 		session = s
 	}
 
+	session.holdSlot(release)
+
 	h.AddSession(session.WebDriver.SessionID(), session)
+	created = true
+
+	sessionCaps := session.proxyWebSockets(session.WebDriver.Capabilities(), r)
 
 	var respJSON map[string]interface{}
 
-	if session.WebDriver.W3C() {
+	// JWP-only clients get a JWP response even from W3C remote ends, whose commands are
+	// translated for them by jwptranslator.
+	if session.WebDriver.W3C() && requestedCaps.W3CSupported {
 		respJSON = map[string]interface{}{
 			"value": map[string]interface{}{
-				"capabilities": session.WebDriver.Capabilities(),
+				"capabilities": sessionCaps,
 				"sessionId":    session.WebDriver.SessionID(),
 			},
 		}
 	} else {
 		respJSON = map[string]interface{}{
-			"value":     session.WebDriver.Capabilities(),
+			"value":     sessionCaps,
 			"sessionId": session.WebDriver.SessionID(),
 			"status":    0,
 		}
@@ -298,6 +506,59 @@ func (h *WebDriverHub) createSession(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
+// selectEnv returns the environment that should be used for a new session requested with caps.
+func (h *WebDriverHub) selectEnv(caps *capabilities.Capabilities) (environment.Env, error) {
+	if s, ok := h.Env.(environment.Selector); ok {
+		return s.Select(caps)
+	}
+	return h.Env, nil
+}
+
+// queueFor returns the session queue that limits the sessions running in env.
+func (h *WebDriverHub) queueFor(env environment.Env) *sessionQueue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.queues == nil {
+		h.queues = map[environment.Env]*sessionQueue{}
+	}
+	q, ok := h.queues[env]
+	if !ok {
+		q = newSessionQueue(h.sessionOpts)
+		h.queues[env] = q
+	}
+	return q
+}
+
+// waitForSessionSlot waits until the number of sessions running in env is below the configured
+// maximum. The returned func releases the slot.
+func (h *WebDriverHub) waitForSessionSlot(ctx context.Context, env environment.Env) (func(), error) {
+	q := h.queueFor(env)
+	start := time.Now()
+	depth, release, err := q.acquire(ctx)
+	if q.max > 0 {
+		if err := h.Timing(h.Name(), "session queue wait", fmt.Sprintf("%d request(s) ahead in queue for %s", depth, env.Name()), start, time.Now()); err != nil {
+			log.Print(err)
+		}
+	}
+	if err != nil {
+		h.Warning(err)
+		return nil, err
+	}
+	return release, nil
+}
+
+// QueueDepth returns the number of new session requests waiting for a session slot in any
+// environment.
+func (h *WebDriverHub) QueueDepth() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	depth := 0
+	for _, q := range h.queues {
+		depth += q.depth()
+	}
+	return depth
+}
+
 func (h *WebDriverHub) defaultForward(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if err := h.waitForHealthyEnv(ctx); err != nil {
@@ -318,8 +579,20 @@ func (h *WebDriverHub) waitForHealthyEnv(ctx context.Context) error {
 		healthreporter.WaitForHealthy(healthyCtx, h.Env)
 	})
 	err := h.Env.Healthy(ctx)
+	h.recordEnvHealth(err == nil)
 	if err != nil {
 		err = errors.New(h.Name(), fmt.Sprintf("environment is unhealthy: %v", err))
 	}
 	return err
 }
+
+// recordEnvHealth counts changes in the health of the environment.
+func (h *WebDriverHub) recordEnvHealth(healthy bool) {
+	state, label := envHealthUnhealthy, "unhealthy"
+	if healthy {
+		state, label = envHealthHealthy, "healthy"
+	}
+	if atomic.SwapInt32(&h.envHealth, state) != state {
+		envHealthTransitions.Inc(h.Env.Name(), label)
+	}
+}
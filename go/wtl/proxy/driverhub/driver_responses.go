@@ -57,6 +57,24 @@ func sessionNotCreated(w http.ResponseWriter, err error) {
 	w.Write(body)
 }
 
+func invalidArgument(w http.ResponseWriter, err error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"status":  13,
+		"error":   "invalid argument",
+		"message": err.Error(),
+		"value": map[string]string{
+			"message": err.Error(),
+		},
+	})
+	if err != nil {
+		log.Printf("Error marshalling json: %v", err)
+	}
+	w.Header().Set("Content-Type", contentType)
+	httphelper.SetDefaultResponseHeaders(w.Header())
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(body)
+}
+
 func unknownError(w http.ResponseWriter, err error) {
 	body, err := json.Marshal(map[string]interface{}{
 		"status":  13,
@@ -114,7 +132,10 @@ func unknownCommand(w http.ResponseWriter, r *http.Request) {
 }
 
 func invalidSessionID(w http.ResponseWriter, id string) {
-	message := fmt.Sprintf("session %s does not exist", id)
+	invalidSessionIDMessage(w, fmt.Sprintf("session %s does not exist", id))
+}
+
+func invalidSessionIDMessage(w http.ResponseWriter, message string) {
 	body, err := json.Marshal(map[string]interface{}{
 		"status":  6,
 		"error":   "invalid session id",
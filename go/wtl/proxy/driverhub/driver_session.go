@@ -19,19 +19,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/errors"
 	"github.com/bazelbuild/rules_webtesting/go/httphelper"
 	"github.com/bazelbuild/rules_webtesting/go/metadata"
 	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 	"github.com/bazelbuild/rules_webtesting/go/webdriver"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
 	"github.com/gorilla/mux"
 )
 
@@ -41,14 +47,26 @@ type WebDriverSession struct {
 	diagnostics.Diagnostics
 	WebDriverHub *WebDriverHub
 	webdriver.WebDriver
+	// The environment the session was started in. If nil, the hub's environment.
+	Env           environment.Env
 	ID            int
 	handler       HandlerFunc
+	bodyFilters   []BodyFilter
 	sessionPath   string
 	RequestedCaps *capabilities.Capabilities
 	Metadata      *metadata.Metadata
-
-	mu      sync.RWMutex
-	stopped bool
+	created       time.Time
+
+	mu             sync.RWMutex
+	stopped        bool
+	releaseSlot    func()
+	lastActivity   time.Time
+	activeCommands int
+	// WebSocket URLs on the remote end, keyed by the protocol name they are proxied under.
+	webSockets map[string]*url.URL
+	// Closes each forwarded WebSocket connection that is open, keyed by connection number.
+	webSocketClosers map[int]context.CancelFunc
+	nextWebSocket    int
 }
 
 // HandlerProvider wraps another HandlerFunc to create a new HandlerFunc.
@@ -68,6 +86,13 @@ type Request struct {
 	Header http.Header
 	// The body of the request.
 	Body []byte
+	// The body of the request, if it is streamed instead of buffered in Body.
+	BodyReader io.Reader
+	// The length of BodyReader.
+	ContentLength int64
+
+	// Whether the response may be streamed instead of buffered.
+	stream bool
 }
 
 // Response describes what response should be returned for a request to WebDriver session.
@@ -78,9 +103,38 @@ type Response struct {
 	Header http.Header
 	// The body of the response.
 	Body []byte
+	// The body of the response, if it is streamed instead of buffered in Body. It is closed once
+	// it has been copied to the client.
+	BodyReader io.ReadCloser
+	// The length of BodyReader, or -1 if it is unknown.
+	ContentLength int64
+	// If true, the connection to the client is closed without writing a response, e.g. to
+	// simulate a remote end that has gone away. The rest of the response is ignored.
+	Abort bool
+}
+
+// A BodyFilter reports whether a handler needs the bodies of a command buffered.
+//
+// For commands where no handler of a session needs buffered bodies, Request.Body and
+// Response.Body are nil and the bodies are streamed between the client and the remote end
+// through Request.BodyReader and Response.BodyReader. Handlers must pass these through
+// unchanged, and must not call their base HandlerFunc more than once for such commands.
+type BodyFilter func(method string, path []string) bool
+
+type registeredProvider struct {
+	provider  HandlerProvider
+	needsBody BodyFilter
 }
 
-var providers = []HandlerProvider{}
+var providers = []registeredProvider{}
+
+func alwaysNeedsBody(string, []string) bool {
+	return true
+}
+
+func neverNeedsBody(string, []string) bool {
+	return false
+}
 
 // HandlerProviderFunc adds additional handlers that will wrap any previously defined handlers.
 //
@@ -96,19 +150,67 @@ var providers = []HandlerProvider{}
 //	hp3(session, caps, hp2(session, caps, hp1(session, caps, base)))
 //
 // where base is the a default function that forwards commands to WebDriver unchanged.
+//
+// Handlers added this way always see buffered bodies.
 func HandlerProviderFunc(provider HandlerProvider) {
-	providers = append(providers, provider)
+	providers = append(providers, registeredProvider{provider, alwaysNeedsBody})
 }
 
-func createHandler(session *WebDriverSession, caps *capabilities.Capabilities) HandlerFunc {
+// StreamingHandlerProviderFunc is like HandlerProviderFunc, but the handlers provided by provider
+// only need buffered bodies for commands for which needsBody returns true. If needsBody is nil,
+// they never need buffered bodies.
+func StreamingHandlerProviderFunc(provider HandlerProvider, needsBody BodyFilter) {
+	if needsBody == nil {
+		needsBody = neverNeedsBody
+	}
+	providers = append(providers, registeredProvider{provider, needsBody})
+}
+
+// capabilityNames are the capabilities that configure WTL rather than the remote end. They are
+// removed from the capabilities sent to the remote end when a session is created.
+var capabilityNames = []string{"google:canReuseSession"}
+
+// CapabilityFunc declares capabilities that are used to configure handlers or environments, so
+// that they are not sent to the remote end, which may reject capabilities it does not know.
+func CapabilityFunc(names ...string) {
+	capabilityNames = append(capabilityNames, names...)
+}
+
+// A Validator checks the configuration that a handler reads from the metadata and the capabilities
+// of a session. caps is nil when only the metadata is being checked.
+type Validator func(m *metadata.Metadata, caps *capabilities.Capabilities) error
+
+var validators = []Validator{}
+
+// ValidatorFunc adds a Validator for the configuration of handlers added with HandlerProviderFunc
+// or StreamingHandlerProviderFunc. Validators are run against the metadata once when the hub is
+// created, which fails if the metadata is invalid, and against the capabilities of each new
+// session before it is created, which fails the new session request if they are invalid. Handlers
+// can rely on their configuration having been validated.
+func ValidatorFunc(v Validator) {
+	validators = append(validators, v)
+}
+
+func validate(m *metadata.Metadata, caps *capabilities.Capabilities) error {
+	for _, v := range validators {
+		if err := v(m, caps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createHandler(session *WebDriverSession, caps *capabilities.Capabilities) (HandlerFunc, []BodyFilter) {
 	handler := createBaseHandler(session.WebDriver)
+	var filters []BodyFilter
 
-	for _, provider := range providers {
-		if h, ok := provider(session, caps, handler); ok {
+	for _, p := range providers {
+		if h, ok := p.provider(session, caps, handler); ok {
 			handler = h
+			filters = append(filters, p.needsBody)
 		}
 	}
-	return handler
+	return handler, filters
 }
 
 // CreateSession creates a WebDriverSession object.
@@ -123,9 +225,11 @@ func CreateSession(id int, hub *WebDriverHub, driver webdriver.WebDriver, caps *
 		Router:        mux.NewRouter(),
 		RequestedCaps: caps,
 		Metadata:      hub.Metadata,
+		created:       time.Now(),
+		lastActivity:  time.Now(),
 	}
 
-	session.handler = createHandler(session, caps)
+	session.handler, session.bodyFilters = createHandler(session, caps)
 	// Route for commands for this session.
 	session.PathPrefix(sessionPath).HandlerFunc(session.defaultHandler)
 	// Route for commands for some other session. If this happens, the hub has
@@ -138,6 +242,14 @@ func CreateSession(id int, hub *WebDriverHub, driver webdriver.WebDriver, caps *
 	return session, nil
 }
 
+// Environment returns the environment the session was started in.
+func (s *WebDriverSession) Environment() environment.Env {
+	if s.Env != nil {
+		return s.Env
+	}
+	return s.WebDriverHub.Env
+}
+
 // Name is the name of the component used in error messages.
 func (s *WebDriverSession) Name() string {
 	return "WebDriver Session Handler"
@@ -149,6 +261,16 @@ func (s *WebDriverSession) wrongSession(w http.ResponseWriter, r *http.Request)
 	unknownError(w, fmt.Errorf("request for session %q was routed to handler for %q", vars["sessionID"], s.SessionID()))
 }
 
+// stoppedSession responds to a request sent to the session after it was stopped, explaining why
+// the session no longer exists if it was reaped.
+func (s *WebDriverSession) stoppedSession(w http.ResponseWriter, sessionID string) {
+	if message, ok := s.WebDriverHub.reapedMessage(s.SessionID()); ok {
+		invalidSessionIDMessage(w, message)
+		return
+	}
+	invalidSessionID(w, sessionID)
+}
+
 func (s *WebDriverSession) unknownCommand(w http.ResponseWriter, r *http.Request) {
 	s.Severe(errors.New(s.Name(), "unknown command routed to session handler"))
 	unknownCommand(w, r)
@@ -182,11 +304,18 @@ func (s *WebDriverSession) quit(ctx context.Context, reusable bool) error {
 		}
 	}
 
-	envErr := s.WebDriverHub.Env.StopSession(ctx, s.ID)
+	envErr := s.Environment().StopSession(ctx, s.ID)
 	if envErr != nil {
 		s.Warning(envErr)
 	}
 
+	// The slot is only released once the environment has stopped the session, so that a queued
+	// session cannot start while this session's browser is still running.
+	if s.releaseSlot != nil {
+		s.releaseSlot()
+		s.releaseSlot = nil
+	}
+
 	s.WebDriverHub.RemoveSession(s.SessionID())
 
 	if wdErr != nil {
@@ -216,6 +345,14 @@ func (s *WebDriverSession) Unpause(id int) {
 	s.mu.Lock()
 	s.stopped = false
 	s.ID = id
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+}
+
+// holdSlot associates a session queue slot with this session, to be released when it quits.
+func (s *WebDriverSession) holdSlot(release func()) {
+	s.mu.Lock()
+	s.releaseSlot = release
 	s.mu.Unlock()
 }
 
@@ -224,28 +361,36 @@ func (s *WebDriverSession) defaultHandler(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	pathTokens := s.commandPathTokens(r.URL.Path)
 
-	s.mu.Lock()
-	stopped := s.stopped
-	s.mu.Unlock()
-
-	if stopped {
-		invalidSessionID(w, vars["sessionID"])
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		unknownError(w, err)
+	if !s.beginCommand() {
+		s.stoppedSession(w, vars["sessionID"])
 		return
 	}
+	defer s.endCommand()
 
+	buffered := s.needsBody(r.Method, pathTokens)
 	req := Request{
 		Method: r.Method,
 		Path:   pathTokens,
 		Header: r.Header,
-		Body:   body,
+		stream: !buffered,
 	}
+	// Request bodies of unknown length are buffered, as some remote ends do not accept chunked
+	// requests.
+	if !buffered && r.ContentLength >= 0 {
+		req.BodyReader = r.Body
+		req.ContentLength = r.ContentLength
+	} else {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			unknownError(w, err)
+			return
+		}
+		req.Body = body
+	}
+
+	start := time.Now()
 	resp, err := s.handler(ctx, req)
+	metrics.CommandLatency.Observe(time.Since(start).Seconds(), r.Method, metrics.CommandEndpoint(pathTokens))
 	if err != nil {
 		if ctx.Err() == context.Canceled {
 			log.Printf("[%s] request %+v was canceled.", s.Name(), req)
@@ -261,7 +406,16 @@ func (s *WebDriverSession) defaultHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if len(resp.Body) != 0 {
+	if resp.BodyReader != nil {
+		defer resp.BodyReader.Close()
+	}
+
+	if resp.Abort {
+		s.abort(w, r)
+		return
+	}
+
+	if len(resp.Body) != 0 || resp.BodyReader != nil {
 		w.Header().Set("Content-Type", contentType)
 	}
 	if resp.Header != nil {
@@ -274,9 +428,17 @@ func (s *WebDriverSession) defaultHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	// TODO(fisherii): needed to play nice with Dart Sync WebDriver. Delete when Dart Sync WebDriver is deleted.
-	w.Header().Set("Transfer-Encoding", "identity")
-	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	length := int64(len(resp.Body))
+	if resp.BodyReader != nil {
+		length = resp.ContentLength
+	}
+	if length >= 0 {
+		// TODO(fisherii): needed to play nice with Dart Sync WebDriver. Delete when Dart Sync WebDriver is deleted.
+		w.Header().Set("Transfer-Encoding", "identity")
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	} else {
+		w.Header().Del("Content-Length")
+	}
 
 	httphelper.SetDefaultResponseHeaders(w.Header())
 
@@ -284,22 +446,84 @@ func (s *WebDriverSession) defaultHandler(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(resp.Status)
 
 	// Write body from resp to w
+	if resp.BodyReader != nil {
+		if _, err := io.Copy(w, resp.BodyReader); err != nil && ctx.Err() == nil {
+			s.Warning(errors.New(s.Name(), fmt.Errorf("error streaming response to %s %s: %v", r.Method, r.URL.Path, err)))
+		}
+		return
+	}
 	w.Write(resp.Body)
 }
 
-func createBaseHandler(driver webdriver.WebDriver) HandlerFunc {
-	client := &http.Client{}
+// abort closes the client's connection without writing a response. If the connection cannot be
+// hijacked, an unknown error is returned instead.
+func (s *WebDriverSession) abort(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[%s] closing connection for %s %s without a response", s.Name(), r.Method, r.URL.Path)
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		unknownError(w, errors.New(s.Name(), fmt.Sprintf("unable to close connection for %s %s: response writer does not support hijacking", r.Method, r.URL.Path)))
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		unknownError(w, errors.New(s.Name(), fmt.Errorf("unable to close connection for %s %s: %v", r.Method, r.URL.Path, err)))
+		return
+	}
+	if err := conn.Close(); err != nil {
+		s.Warning(errors.New(s.Name(), err))
+	}
+}
+
+// needsBody returns whether any of the session's handlers needs the bodies of a command buffered.
+func (s *WebDriverSession) needsBody(method string, path []string) bool {
+	for _, f := range s.bodyFilters {
+		if f(method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// transport is shared by all sessions so that connections to remote ends are kept alive and
+// reused between commands.
+var transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns: 100,
+	// Commands for a session all go to the same host; the default of 2 would close connections
+	// whenever a test issues commands concurrently.
+	MaxIdleConnsPerHost: 32,
+	IdleConnTimeout:     90 * time.Second,
+	// Pass bodies through as the remote end sent them.
+	DisableCompression: true,
+}
+
+var client = &http.Client{Transport: transport}
 
+func createBaseHandler(driver webdriver.WebDriver) HandlerFunc {
 	return func(ctx context.Context, rq Request) (Response, error) {
 		url, err := driver.CommandURL(rq.Path...)
 		if err != nil {
 			return Response{}, err
 		}
 
-		req, err := http.NewRequest(rq.Method, url.String(), bytes.NewReader(rq.Body))
+		var body io.Reader = bytes.NewReader(rq.Body)
+		if rq.BodyReader != nil {
+			body = rq.BodyReader
+		}
+		req, err := http.NewRequest(rq.Method, url.String(), body)
 		if err != nil {
 			return Response{}, err
 		}
+		if rq.BodyReader != nil {
+			req.ContentLength = rq.ContentLength
+			if req.ContentLength == 0 {
+				req.Body = http.NoBody
+			}
+		}
 		req = req.WithContext(ctx)
 		for k, v := range rq.Header {
 			if !strings.HasPrefix(k, "x-google-") {
@@ -311,12 +535,20 @@ func createBaseHandler(driver webdriver.WebDriver) HandlerFunc {
 		if err != nil {
 			return Response{}, err
 		}
+		if rq.stream {
+			return Response{
+				Status:        resp.StatusCode,
+				Header:        resp.Header,
+				BodyReader:    resp.Body,
+				ContentLength: resp.ContentLength,
+			}, nil
+		}
 		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
+		respBody, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return Response{}, err
 		}
-		return Response{resp.StatusCode, resp.Header, body}, nil
+		return Response{Status: resp.StatusCode, Header: resp.Header, Body: respBody}, nil
 	}
 }
 
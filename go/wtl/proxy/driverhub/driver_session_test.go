@@ -0,0 +1,224 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+type urlDriver struct {
+	fakeDriver
+	base string
+}
+
+func (d *urlDriver) CommandURL(endpoint ...string) (*url.URL, error) {
+	return url.Parse(d.base + "/session/" + d.id + "/" + strings.Join(endpoint, "/"))
+}
+
+func TestDefaultHandlerBodies(t *testing.T) {
+	screenshot := `{"value": "` + strings.Repeat("A", 100000) + `"}`
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/session/abc/screenshot" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(screenshot)))
+			w.Write([]byte(screenshot))
+			return
+		}
+		w.Write([]byte(`{"value": ` + string(body) + `}`))
+	}))
+	defer backend.Close()
+
+	for _, tc := range []struct {
+		name       string
+		filters    []BodyFilter
+		wantBuffer bool
+	}{
+		{"streamed", nil, false},
+		{"buffered", []BodyFilter{alwaysNeedsBody}, true},
+		{"filtered", []BodyFilter{neverNeedsBody, func(m string, _ []string) bool { return m == http.MethodPost }}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &WebDriverSession{
+				Diagnostics: diagnostics.NoOP(),
+				WebDriver:   &urlDriver{fakeDriver{id: "abc"}, backend.URL},
+				sessionPath: "/wd/hub/session/abc",
+				bodyFilters: tc.filters,
+			}
+			base := createBaseHandler(s.WebDriver)
+			var buffered []bool
+			s.handler = func(ctx context.Context, rq Request) (Response, error) {
+				resp, err := base(ctx, rq)
+				buffered = append(buffered, rq.BodyReader == nil && resp.BodyReader == nil)
+				return resp, err
+			}
+
+			for _, c := range []struct {
+				method, path, body, want string
+			}{
+				{http.MethodGet, "/wd/hub/session/abc/screenshot", "", screenshot},
+				{http.MethodPost, "/wd/hub/session/abc/url", `{"url": "http://example.com"}`, `{"value": {"url": "http://example.com"}}`},
+			} {
+				w := httptest.NewRecorder()
+				s.defaultHandler(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+				if w.Code != http.StatusOK || w.Body.String() != c.want {
+					t.Errorf("%s %s: got %d %.40q, want %d %.40q", c.method, c.path, w.Code, w.Body.String(), http.StatusOK, c.want)
+				}
+				if got, want := w.Header().Get("Content-Length"), w.Body.Len(); got != strconv.Itoa(want) {
+					t.Errorf("%s %s: got Content-Length %q, want %d", c.method, c.path, got, want)
+				}
+			}
+
+			// The screenshot is only buffered if every command is.
+			if buffered[0] != (tc.name == "buffered") {
+				t.Errorf("Got screenshot buffered %v, want %v", buffered[0], tc.name == "buffered")
+			}
+			if buffered[1] != tc.wantBuffer {
+				t.Errorf("Got navigation buffered %v, want %v", buffered[1], tc.wantBuffer)
+			}
+		})
+	}
+}
+
+func TestCreateHandlerBodyFilters(t *testing.T) {
+	saved := providers
+	defer func() { providers = saved }()
+
+	install := func(*WebDriverSession, *capabilities.Capabilities, HandlerFunc) (HandlerFunc, bool) {
+		return func(context.Context, Request) (Response, error) { return Response{}, nil }, true
+	}
+	skip := func(_ *WebDriverSession, _ *capabilities.Capabilities, base HandlerFunc) (HandlerFunc, bool) {
+		return base, false
+	}
+
+	providers = nil
+	HandlerProviderFunc(skip)
+	StreamingHandlerProviderFunc(install, nil)
+	StreamingHandlerProviderFunc(skip, nil)
+
+	_, filters := createHandler(&WebDriverSession{WebDriver: &fakeDriver{id: "abc"}}, nil)
+	if len(filters) != 1 || filters[0](http.MethodGet, nil) {
+		t.Errorf("Got %d filters, want only the never-buffering filter of the installed provider", len(filters))
+	}
+}
+
+// startingEnv is a healthyEnv that starts sessions with the requested capabilities.
+type startingEnv struct {
+	healthyEnv
+}
+
+func (*startingEnv) StartSession(_ context.Context, _ int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	return caps, nil
+}
+
+func TestCreateSessionValidatesCapabilities(t *testing.T) {
+	saved := validators
+	defer func() { validators = saved }()
+
+	validators = nil
+	ValidatorFunc(func(_ *metadata.Metadata, caps *capabilities.Capabilities) error {
+		if caps != nil && caps.AlwaysMatch["google:bad"] != nil {
+			return errors.New("google:bad is not allowed")
+		}
+		return nil
+	})
+
+	env := &startingEnv{}
+	h := &WebDriverHub{
+		Env:         env,
+		Diagnostics: diagnostics.NoOP(),
+		sessionOpts: sessionOptions{maxSessions: 1},
+		sessions:    map[string]*WebDriverSession{},
+	}
+
+	w := httptest.NewRecorder()
+	h.createSession(w, httptest.NewRequest(http.MethodPost, "/wd/hub/session", strings.NewReader(`{"capabilities": {"alwaysMatch": {"google:bad": true}}}`)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	resp := map[string]interface{}{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["error"] != "invalid argument" {
+		t.Errorf("Got error %v, want invalid argument", resp["error"])
+	}
+	if len(env.stopped) != 1 {
+		t.Errorf("Got StopSession calls for %v, want the rejected session stopped", env.stopped)
+	}
+	if q := h.queueFor(env); q.active != 0 {
+		t.Errorf("Got %d active slots after rejecting the session, want 0", q.active)
+	}
+}
+
+func TestDefaultHandlerAbort(t *testing.T) {
+	s := &WebDriverSession{
+		Diagnostics: diagnostics.NoOP(),
+		WebDriver:   &fakeDriver{id: "abc"},
+		sessionPath: "/wd/hub/session/abc",
+		handler: func(context.Context, Request) (Response, error) {
+			return Response{Abort: true}, nil
+		},
+	}
+	returned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.defaultHandler(w, r)
+		close(returned)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/wd/hub/session/abc/url")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("Got status %d, want the connection closed without a response", resp.StatusCode)
+	}
+	// The handler returns normally, so wrapping handlers such as the access log see the command.
+	<-returned
+}
+
+func TestCapabilityFunc(t *testing.T) {
+	saved := capabilityNames
+	defer func() { capabilityNames = saved }()
+
+	CapabilityFunc("google:plugin")
+
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{
+		"browserName":            "chrome",
+		"google:canReuseSession": true,
+		"google:plugin":          map[string]interface{}{"enabled": true},
+	}}
+	stripped := caps.Strip(capabilityNames...)
+	for _, name := range []string{"google:canReuseSession", "google:plugin"} {
+		if _, ok := stripped.AlwaysMatch[name]; ok {
+			t.Errorf("Got %s sent to the remote end, want it stripped", name)
+		}
+	}
+	if stripped.AlwaysMatch["browserName"] != "chrome" {
+		t.Errorf("Got browserName %v, want chrome", stripped.AlwaysMatch["browserName"])
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy"
+)
+
+// SessionInfo describes a session known to a WebDriverHub.
+type SessionInfo struct {
+	// SessionID is the WebDriver session id.
+	SessionID string `json:"sessionId"`
+	// State is "active" for sessions in use, and "reusable" for sessions waiting to be reused.
+	State string `json:"state"`
+	// Environment is the name of the environment the session was started in.
+	Environment string `json:"environment"`
+	// RequestedCapabilities are the capabilities the session was created with.
+	RequestedCapabilities map[string]interface{} `json:"requestedCapabilities"`
+	// Created is when the browser for this session was started.
+	Created time.Time `json:"created"`
+	// Age is the number of seconds since the browser for this session was started.
+	Age float64 `json:"age"`
+}
+
+// ComponentStatus is the health of a single component of WTL.
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PoolStatus describes the session pool of a WebDriverHub.
+type PoolStatus struct {
+	// Active is the number of sessions in use.
+	Active int `json:"active"`
+	// Reusable is the number of sessions waiting to be reused.
+	Reusable int `json:"reusable"`
+	// Queued is the number of new session requests waiting for a session slot.
+	Queued int `json:"queued"`
+	// MaxSessions is the maximum number of concurrent sessions per environment, or 0 if unlimited.
+	MaxSessions int `json:"maxSessions"`
+	// Reaped is the number of sessions quit by WTL after being idle for too long.
+	Reaped int `json:"reaped"`
+}
+
+// Status is the combined status of the WebDriverHub, its environment, and the proxy handlers.
+type Status struct {
+	Ready       bool              `json:"ready"`
+	Message     string            `json:"message"`
+	Environment ComponentStatus   `json:"environment"`
+	Pool        PoolStatus        `json:"pool"`
+	Handlers    []ComponentStatus `json:"handlers"`
+}
+
+func componentStatus(name string, err error) ComponentStatus {
+	cs := ComponentStatus{Name: name, Healthy: err == nil}
+	if err != nil {
+		cs.Error = err.Error()
+	}
+	return cs
+}
+
+// SessionInfos returns information about all active and reusable sessions, oldest first.
+func (h *WebDriverHub) SessionInfos() []SessionInfo {
+	now := time.Now()
+	var infos []SessionInfo
+
+	h.mu.RLock()
+	for id, session := range h.sessions {
+		infos = append(infos, session.info(id, "active", now))
+	}
+	for _, session := range h.reusableSessions {
+		infos = append(infos, session.info(session.SessionID(), "reusable", now))
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos
+}
+
+// Status returns the combined health of the environment, session pool, and proxy handlers.
+func (h *WebDriverHub) Status(ctx context.Context) Status {
+	status := Status{
+		Environment: componentStatus(h.Env.Name(), h.Env.Healthy(ctx)),
+		Pool: PoolStatus{
+			Active:      len(h.GetActiveSessions()),
+			Queued:      h.QueueDepth(),
+			MaxSessions: h.sessionOpts.maxSessions,
+		},
+	}
+
+	h.mu.RLock()
+	status.Pool.Reusable = len(h.reusableSessions)
+	status.Pool.Reaped = h.reapedCount
+	h.mu.RUnlock()
+
+	var handlers map[string]proxy.HTTPHandler
+	if h.Proxy != nil {
+		handlers = h.Proxy.HTTPHandlers()
+	}
+	var routes []string
+	for route := range handlers {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	handlersHealthy := true
+	for _, route := range routes {
+		handler := handlers[route]
+		cs := componentStatus(handler.Name(), handler.Healthy(ctx))
+		handlersHealthy = handlersHealthy && cs.Healthy
+		status.Handlers = append(status.Handlers, cs)
+	}
+
+	switch {
+	case !status.Environment.Healthy:
+		status.Message = "environment is unhealthy"
+	case !handlersHealthy:
+		status.Message = "one or more proxy handlers are unhealthy"
+	case status.Pool.MaxSessions > 0 && status.Pool.Active >= status.Pool.MaxSessions:
+		status.Message = "all session slots are in use"
+	default:
+		status.Ready = true
+		status.Message = "ready to create new sessions"
+	}
+
+	return status
+}
+
+func (h *WebDriverHub) listSessions(w http.ResponseWriter, _ *http.Request) {
+	infos := h.SessionInfos()
+	if infos == nil {
+		infos = []SessionInfo{}
+	}
+	success(w, infos)
+}
+
+func (h *WebDriverHub) status(w http.ResponseWriter, r *http.Request) {
+	success(w, h.Status(r.Context()))
+}
+
+func (s *WebDriverSession) info(id, state string, now time.Time) SessionInfo {
+	return SessionInfo{
+		SessionID:             id,
+		State:                 state,
+		Environment:           s.Environment().Name(),
+		RequestedCapabilities: capabilitiesJSON(s.RequestedCaps),
+		Created:               s.created,
+		Age:                   now.Sub(s.created).Seconds(),
+	}
+}
+
+func capabilitiesJSON(caps *capabilities.Capabilities) map[string]interface{} {
+	if caps == nil {
+		return nil
+	}
+	j := map[string]interface{}{
+		"alwaysMatch": caps.AlwaysMatch,
+	}
+	if len(caps.FirstMatch) != 0 {
+		j["firstMatch"] = caps.FirstMatch
+	}
+	return j
+}
@@ -0,0 +1,179 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+)
+
+type fakeEnv struct {
+	environment.Env
+}
+
+func (fakeEnv) Name() string {
+	return "fake env"
+}
+
+func TestListSessions(t *testing.T) {
+	h := &WebDriverHub{
+		Env:      fakeEnv{},
+		sessions: map[string]*WebDriverSession{},
+	}
+	now := time.Now()
+	h.sessions["newer"] = &WebDriverSession{
+		WebDriverHub:  h,
+		RequestedCaps: &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{"browserName": "firefox"}},
+		created:       now.Add(-time.Minute),
+	}
+	h.sessions["older"] = &WebDriverSession{
+		WebDriverHub:  h,
+		RequestedCaps: &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{"browserName": "chrome"}},
+		created:       now.Add(-time.Hour),
+	}
+
+	w := httptest.NewRecorder()
+	h.listSessions(w, httptest.NewRequest(http.MethodGet, "/wd/hub/sessions", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	resp := struct {
+		Value []SessionInfo
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Value) != 2 {
+		t.Fatalf("Got %d sessions, want 2", len(resp.Value))
+	}
+
+	for i, want := range []string{"older", "newer"} {
+		info := resp.Value[i]
+		if info.SessionID != want {
+			t.Errorf("Got session %q at index %d, want %q", info.SessionID, i, want)
+		}
+		if info.State != "active" {
+			t.Errorf("Got state %q for %s, want active", info.State, want)
+		}
+		if info.Environment != "fake env" {
+			t.Errorf("Got environment %q for %s, want fake env", info.Environment, want)
+		}
+		if info.Age <= 0 {
+			t.Errorf("Got age %v for %s, want > 0", info.Age, want)
+		}
+	}
+
+	if got := resp.Value[0].RequestedCapabilities["alwaysMatch"].(map[string]interface{})["browserName"]; got != "chrome" {
+		t.Errorf("Got browserName %v for older session, want chrome", got)
+	}
+}
+
+func TestListSessionsEmpty(t *testing.T) {
+	h := &WebDriverHub{
+		Env:      fakeEnv{},
+		sessions: map[string]*WebDriverSession{},
+	}
+
+	w := httptest.NewRecorder()
+	h.listSessions(w, httptest.NewRequest(http.MethodGet, "/wd/hub/sessions", nil))
+
+	resp := map[string]interface{}{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := resp["value"].([]interface{}); !ok || len(v) != 0 {
+		t.Errorf("Got value %#v, want []", resp["value"])
+	}
+}
+
+// healthyEnv is a stoppingEnv that is always healthy.
+type healthyEnv struct {
+	stoppingEnv
+}
+
+func (*healthyEnv) Healthy(context.Context) error {
+	return nil
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	env := &healthyEnv{}
+	h := &WebDriverHub{
+		Env:         env,
+		Diagnostics: diagnostics.NoOP(),
+		sessionOpts: sessionOptions{maxSessions: 1},
+		sessions:    map[string]*WebDriverSession{},
+	}
+	now := time.Now()
+
+	// One active session holding the only slot, one queued request, and one reaped session.
+	if _, err := h.waitForSessionSlot(ctx, env); err != nil {
+		t.Fatal(err)
+	}
+	queueCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go h.waitForSessionSlot(queueCtx, env)
+	for h.QueueDepth() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	h.sessions["active"] = &WebDriverSession{
+		WebDriverHub: h,
+		WebDriver:    &fakeDriver{id: "active"},
+		created:      now,
+		lastActivity: now,
+	}
+	h.sessions["idle"] = &WebDriverSession{
+		ID:           1,
+		WebDriverHub: h,
+		WebDriver:    &fakeDriver{id: "idle"},
+		Diagnostics:  diagnostics.NoOP(),
+		created:      now.Add(-time.Hour),
+		lastActivity: now.Add(-time.Hour),
+	}
+	h.reapIdleSessions(now, time.Minute)
+
+	w := httptest.NewRecorder()
+	h.status(w, httptest.NewRequest(http.MethodGet, "/wd/hub/status", nil))
+
+	var resp struct {
+		Value Status `json:"value"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	want := PoolStatus{Active: 1, Queued: 1, MaxSessions: 1, Reaped: 1}
+	if resp.Value.Pool != want {
+		t.Errorf("Got pool %+v, want %+v", resp.Value.Pool, want)
+	}
+	if resp.Value.Ready || resp.Value.Message != "all session slots are in use" {
+		t.Errorf("Got ready %v with message %q, want not ready because all slots are in use", resp.Value.Ready, resp.Value.Message)
+	}
+	if !resp.Value.Environment.Healthy || resp.Value.Environment.Name != "fake env" {
+		t.Errorf("Got environment %+v, want healthy fake env", resp.Value.Environment)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package driverhubtest provides utilities for testing driverhub handlers.
+package driverhubtest
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+// NewSession returns a session whose metadata has config, a JSON value, as its extension named
+// key.
+func NewSession(t *testing.T, key, config string) *driverhub.WebDriverSession {
+	t.Helper()
+	m, err := metadata.FromBytes([]byte(`{"extension": {"`+key+`": `+config+`}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &driverhub.WebDriverSession{
+		Diagnostics: diagnostics.NoOP(),
+		Metadata:    m,
+	}
+}
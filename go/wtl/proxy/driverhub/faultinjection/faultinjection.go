@@ -0,0 +1,340 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faultinjection provides a handler that injects failures into WebDriver commands so that
+// clients can be tested against flaky remote ends. It is configured by the faultInjection section
+// of a Metadata.Extension field, or by the google:faultInjection capability, which takes
+// precedence, e.g.:
+//
+//	"faultInjection": {
+//	  "seed": 42,
+//	  "rate": 0.05,
+//	  "faults": [
+//	    {"type": "latency", "delay": "2s"},
+//	    {"type": "error", "error": "stale element reference", "path": "^/element/[^/]+/click$", "rate": 0.5},
+//	    {"type": "drop", "method": "POST", "path": "^/url$", "rate": 1},
+//	    {"type": "http500"},
+//	    {"type": "truncate", "bytes": 10}
+//	  ]
+//	}
+//
+// type is one of latency (wait for delay, a number of seconds or a duration string, then
+// continue), drop (close the client's connection without a response), http500 (return a
+// non-WebDriver HTTP 500), error (return the W3C error with message), or truncate (forward the
+// command and cut its response body to bytes, by default half of it).
+//
+// A fault applies to commands matching method and path (the command path relative to the session,
+// with a leading /), or to all commands if neither is set, with probability rate. If a fault has
+// no rate, rate defaults to 1 for faults with a method or path, otherwise to the top-level rate.
+// Faults are considered in order; every latency fault that fires is applied, and the first other
+// fault that fires ends the command. Random choices are made from seed (default 0), so a given
+// sequence of commands always sees the same faults. Faults are never injected into quit commands.
+package faultinjection
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+const (
+	compName = "Fault Injection Handler"
+	// Capability is the capability used to configure fault injection for a single session.
+	Capability = "google:faultInjection"
+)
+
+// fault is a single compiled entry in faultInjection.faults.
+type fault struct {
+	// One of latency, drop, http500, error, or truncate.
+	kind string
+	// The HTTP method to match. If empty, matches all methods.
+	method string
+	// Matched against the command path. If nil, matches all commands.
+	path *regexp.Regexp
+	// Probability the fault is applied to a matching command.
+	rate float64
+	// For latency, how long to wait.
+	delay time.Duration
+	// For error, the W3C error and message returned to the client.
+	err     string
+	message string
+	// For truncate, how many bytes of the response to keep. If negative, keeps half.
+	bytes int
+}
+
+// Validate returns an error if the fault injection configured by m and caps is invalid.
+func Validate(m *metadata.Metadata, caps *capabilities.Capabilities) error {
+	if _, _, err := configuredFaults(m, caps); err != nil {
+		return errors.New(compName, fmt.Errorf("invalid faultInjection: %v", err))
+	}
+	return nil
+}
+
+// ProviderFunc provides a handler that injects the faults configured for the session. The
+// configuration must have been checked with Validate.
+func ProviderFunc(session *driverhub.WebDriverSession, caps *capabilities.Capabilities, base driverhub.HandlerFunc) (driverhub.HandlerFunc, bool) {
+	seed, faults, err := configuredFaults(session.Metadata, caps)
+	if err != nil {
+		session.Warning(errors.New(compName, fmt.Errorf("ignoring invalid faultInjection: %v", err)))
+		return base, false
+	}
+	if len(faults) == 0 {
+		return base, false
+	}
+
+	log.Printf("[%s] injecting %d fault(s) with seed %d", compName, len(faults), seed)
+
+	var mu sync.Mutex
+	rnd := rand.New(rand.NewSource(seed))
+	fires := func(f *fault) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return rnd.Float64() < f.rate
+	}
+
+	return func(ctx context.Context, rq driverhub.Request) (driverhub.Response, error) {
+		if rq.Method == http.MethodDelete && len(rq.Path) == 0 {
+			return base(ctx, rq)
+		}
+
+		path := "/" + strings.Join(rq.Path, "/")
+
+		for _, f := range faults {
+			if !f.matches(rq.Method, path) || !fires(f) {
+				continue
+			}
+			log.Printf("[%s] injecting %s into %s %s", compName, f.kind, rq.Method, path)
+
+			switch f.kind {
+			case "latency":
+				select {
+				case <-time.After(f.delay):
+				case <-ctx.Done():
+					return driverhub.Response{}, ctx.Err()
+				}
+			case "drop":
+				return driverhub.Response{Abort: true}, nil
+			case "http500":
+				return driverhub.Response{
+					Status: http.StatusInternalServerError,
+					Header: http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+					Body:   []byte("Internal Server Error"),
+				}, nil
+			case "error":
+				return driverhub.ResponseFromError(webdriver.ErrorFromError(f.err, f.message))
+			case "truncate":
+				resp, err := base(ctx, rq)
+				if err != nil {
+					return resp, err
+				}
+				n := f.bytes
+				if n < 0 {
+					n = len(resp.Body) / 2
+				}
+				if n < len(resp.Body) {
+					resp.Body = resp.Body[:n]
+				}
+				return resp, nil
+			}
+		}
+
+		return base(ctx, rq)
+	}, true
+}
+
+func (f *fault) matches(method, path string) bool {
+	if f.method != "" && f.method != method {
+		return false
+	}
+	return f.path == nil || f.path.MatchString(path)
+}
+
+// configuredFaults returns the seed and faults configured by m and caps.
+func configuredFaults(m *metadata.Metadata, caps *capabilities.Capabilities) (int64, []*fault, error) {
+	config, err := findConfig(m, caps)
+	if err != nil || config == nil {
+		return 0, nil, err
+	}
+	return compileFaults(config)
+}
+
+// findConfig returns the google:faultInjection capability if present, otherwise the faultInjection
+// section of m, or nil if neither is present.
+func findConfig(m *metadata.Metadata, caps *capabilities.Capabilities) (map[string]interface{}, error) {
+	if caps != nil {
+		if c, ok := caps.AlwaysMatch[Capability]; ok {
+			config, ok := c.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s %#v is not an object", Capability, c)
+			}
+			return config, nil
+		}
+	}
+
+	if m == nil {
+		return nil, nil
+	}
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return nil, nil
+	}
+	c, ok := extMap["faultInjection"]
+	if !ok {
+		return nil, nil
+	}
+	config, ok := c.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("faultInjection %#v is not an object", c)
+	}
+	return config, nil
+}
+
+func compileFaults(config map[string]interface{}) (int64, []*fault, error) {
+	var seed int64
+	if s, ok := config["seed"]; ok {
+		sf, ok := s.(float64)
+		if !ok {
+			return 0, nil, fmt.Errorf("seed %#v is not a number", s)
+		}
+		seed = int64(sf)
+	}
+
+	rate := 0.0
+	if r, ok := config["rate"]; ok {
+		rf, ok := r.(float64)
+		if !ok || rf < 0 || rf > 1 {
+			return 0, nil, fmt.Errorf("rate %#v is not a number between 0 and 1", r)
+		}
+		rate = rf
+	}
+
+	fs, ok := config["faults"]
+	if !ok {
+		return seed, nil, nil
+	}
+	fl, ok := fs.([]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("faults %#v is not a list", fs)
+	}
+
+	var faults []*fault
+	for _, e := range fl {
+		fm, ok := e.(map[string]interface{})
+		if !ok {
+			return 0, nil, fmt.Errorf("fault %#v is not an object", e)
+		}
+		f, err := compileFault(fm, rate)
+		if err != nil {
+			return 0, nil, err
+		}
+		faults = append(faults, f)
+	}
+	return seed, faults, nil
+}
+
+func compileFault(fm map[string]interface{}, defaultRate float64) (*fault, error) {
+	f := &fault{bytes: -1}
+
+	getString := func(name string) (string, error) {
+		v, ok := fm[name]
+		if !ok {
+			return "", nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("%s %#v in fault %v is not a string", name, v, fm)
+		}
+		return s, nil
+	}
+
+	var err error
+	if f.kind, err = getString("type"); err != nil {
+		return nil, err
+	}
+	if f.method, err = getString("method"); err != nil {
+		return nil, err
+	}
+	f.method = strings.ToUpper(f.method)
+
+	path, err := getString("path")
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if f.path, err = regexp.Compile(path); err != nil {
+			return nil, fmt.Errorf("path %q in fault %v is not a valid regular expression: %v", path, fm, err)
+		}
+	}
+
+	f.rate = defaultRate
+	if f.method != "" || f.path != nil {
+		f.rate = 1
+	}
+	if r, ok := fm["rate"]; ok {
+		rf, ok := r.(float64)
+		if !ok || rf < 0 || rf > 1 {
+			return nil, fmt.Errorf("rate %#v in fault %v is not a number between 0 and 1", r, fm)
+		}
+		f.rate = rf
+	}
+
+	switch f.kind {
+	case "latency":
+		d, ok := fm["delay"]
+		if !ok {
+			return nil, fmt.Errorf("latency fault %v has no delay", fm)
+		}
+		if f.delay, err = metadata.Duration(d); err != nil {
+			return nil, fmt.Errorf("delay %#v in fault %v is not a valid duration: %v", d, fm, err)
+		}
+	case "error":
+		if f.err, err = getString("error"); err != nil {
+			return nil, err
+		}
+		if f.err == "" {
+			return nil, fmt.Errorf("error fault %v has no error", fm)
+		}
+		if f.message, err = getString("message"); err != nil {
+			return nil, err
+		}
+		if f.message == "" {
+			f.message = fmt.Sprintf("[%s] injected %s", compName, f.err)
+		}
+	case "truncate":
+		if b, ok := fm["bytes"]; ok {
+			bf, ok := b.(float64)
+			if !ok || bf < 0 {
+				return nil, fmt.Errorf("bytes %#v in fault %v is not a non-negative number", b, fm)
+			}
+			f.bytes = int(bf)
+		}
+	case "drop", "http500":
+	default:
+		return nil, fmt.Errorf("type %q in fault %v must be one of latency, drop, http500, error, or truncate", f.kind, fm)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faultinjection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/driverhubtest"
+)
+
+func ok(context.Context, driverhub.Request) (driverhub.Response, error) {
+	return driverhub.Response{Status: http.StatusOK, Body: []byte(`{"value": "0123456789"}`)}, nil
+}
+
+func TestNoConfig(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ProviderFunc(&driverhub.WebDriverSession{Metadata: m}, nil, ok); ok {
+		t.Error("Got true, want false when faultInjection is not configured")
+	}
+}
+
+func TestErrorOnPattern(t *testing.T) {
+	session := driverhubtest.NewSession(t, "faultInjection", `{"faults": [{"type": "error", "error": "stale element reference", "method": "POST", "path": "^/element/[^/]+/click$"}]}`)
+	handler, ok := ProviderFunc(session, nil, ok)
+	if !ok {
+		t.Fatal("Got false, want handler")
+	}
+
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodPost, Path: []string{"element", "abc", "click"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	respJSON := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Body, &respJSON); err != nil {
+		t.Fatal(err)
+	}
+	if respJSON["error"] != "stale element reference" {
+		t.Errorf("Got %d %s, want stale element reference error", resp.Status, resp.Body)
+	}
+
+	resp, err = handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"url"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Errorf("Got status %d for non-matching command, want %d", resp.Status, http.StatusOK)
+	}
+}
+
+func TestCapabilityOverridesMetadata(t *testing.T) {
+	session := driverhubtest.NewSession(t, "faultInjection", `{"faults": [{"type": "error", "error": "unexpected alert open"}], "rate": 1}`)
+	caps := &capabilities.Capabilities{
+		AlwaysMatch: map[string]interface{}{
+			Capability: map[string]interface{}{
+				"faults": []interface{}{map[string]interface{}{"type": "http500", "path": "^/url$"}},
+			},
+		},
+	}
+	handler, _ := ProviderFunc(session, caps, ok)
+
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"url"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusInternalServerError || string(resp.Body) != "Internal Server Error" {
+		t.Errorf("Got %d %s, want HTTP 500", resp.Status, resp.Body)
+	}
+	resp, err = handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"title"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Errorf("Got status %d, want %d", resp.Status, http.StatusOK)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	session := driverhubtest.NewSession(t, "faultInjection", `{"faults": [{"type": "truncate", "bytes": 5, "path": "^/title$"}]}`)
+	handler, _ := ProviderFunc(session, nil, ok)
+
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"title"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != `{"val` {
+		t.Errorf("Got body %q, want %q", resp.Body, `{"val`)
+	}
+}
+
+func TestDrop(t *testing.T) {
+	session := driverhubtest.NewSession(t, "faultInjection", `{"faults": [{"type": "drop", "path": "^/url$"}]}`)
+	handler, _ := ProviderFunc(session, nil, ok)
+
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"url"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Abort {
+		t.Error("Got Abort false for dropped command, want true")
+	}
+}
+
+func TestRateIsDeterministic(t *testing.T) {
+	run := func() []int {
+		session := driverhubtest.NewSession(t, "faultInjection", `{"seed": 7, "rate": 0.5, "faults": [{"type": "http500"}]}`)
+		handler, _ := ProviderFunc(session, nil, ok)
+		var statuses []int
+		for i := 0; i < 50; i++ {
+			resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodGet, Path: []string{"url"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses = append(statuses, resp.Status)
+		}
+		return statuses
+	}
+
+	first, second := run(), run()
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Got different results at command %d with the same seed", i)
+		}
+		if first[i] == http.StatusInternalServerError {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("Got %d failures out of %d with rate 0.5", failures, len(first))
+	}
+}
+
+func TestQuitIsNeverFaulted(t *testing.T) {
+	session := driverhubtest.NewSession(t, "faultInjection", `{"rate": 1, "faults": [{"type": "http500"}]}`)
+	handler, _ := ProviderFunc(session, nil, ok)
+
+	resp, err := handler(context.Background(), driverhub.Request{Method: http.MethodDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Errorf("Got status %d for quit, want %d", resp.Status, http.StatusOK)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	session := driverhubtest.NewSession(t, "faultInjection", `{"faults": [{"type": "explode"}]}`)
+	if err := Validate(session.Metadata, nil); err == nil {
+		t.Error("Got nil error from Validate with invalid config, want error")
+	}
+	if _, ok := ProviderFunc(session, nil, ok); ok {
+		t.Error("Got true with invalid config, want false")
+	}
+
+	caps := &capabilities.Capabilities{AlwaysMatch: map[string]interface{}{Capability: "explode"}}
+	if err := Validate(nil, caps); err == nil {
+		t.Errorf("Got nil error from Validate with %s %q, want error", Capability, "explode")
+	}
+}
+
+func TestLatencyDelay(t *testing.T) {
+	for _, tc := range []struct {
+		delay interface{}
+		want  time.Duration
+	}{
+		{2.0, 2 * time.Second},
+		{0.5, 500 * time.Millisecond},
+		{"150ms", 150 * time.Millisecond},
+	} {
+		f, err := compileFault(map[string]interface{}{"type": "latency", "delay": tc.delay}, 1)
+		if err != nil {
+			t.Errorf("Got error %v for delay %#v, want nil", err, tc.delay)
+			continue
+		}
+		if f.delay != tc.want {
+			t.Errorf("Got delay %v for %#v, want %v", f.delay, tc.delay, tc.want)
+		}
+	}
+
+	for _, delay := range []interface{}{nil, "soon", true} {
+		fm := map[string]interface{}{"type": "latency"}
+		if delay != nil {
+			fm["delay"] = delay
+		}
+		if _, err := compileFault(fm, 1); err == nil {
+			t.Errorf("Got nil error for delay %#v, want error", delay)
+		}
+	}
+}
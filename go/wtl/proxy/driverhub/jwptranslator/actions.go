@@ -0,0 +1,110 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwptranslator
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+// moveTo translates a JWP moveto command into a W3C pointer move. JWP offsets are relative to
+// the top-left corner of the element, whereas W3C offsets are relative to its center.
+func (t *translator) moveTo(ctx context.Context, rq driverhub.Request, body map[string]interface{}) (driverhub.Response, error) {
+	x, hasX := number(body["xoffset"])
+	y, hasY := number(body["yoffset"])
+
+	move := map[string]interface{}{
+		"type":     "pointerMove",
+		"duration": 0,
+		"origin":   "pointer",
+	}
+
+	if element, ok := elementID(body["element"]); ok {
+		move["origin"] = map[string]interface{}{w3cElementKey: element}
+		if hasX || hasY {
+			v, err := t.value(ctx, rq, http.MethodGet, []string{"element", element, "rect"})
+			if err != nil {
+				return t.errorResponse(err)
+			}
+			rect, _ := v.(map[string]interface{})
+			width, _ := number(rect["width"])
+			height, _ := number(rect["height"])
+			x -= width / 2
+			y -= height / 2
+		}
+	}
+
+	move["x"] = int(x)
+	move["y"] = int(y)
+	return t.pointer(ctx, rq, move)
+}
+
+// click translates a JWP click or doubleclick command into W3C pointer actions at the current
+// pointer position.
+func (t *translator) click(ctx context.Context, rq driverhub.Request, body map[string]interface{}, count int) (driverhub.Response, error) {
+	b := button(body)
+	var actions []interface{}
+	for i := 0; i < count; i++ {
+		actions = append(actions, pointerAction("pointerDown", b), pointerAction("pointerUp", b))
+	}
+	return t.pointer(ctx, rq, actions...)
+}
+
+// pointer performs actions with the mouse input source.
+func (t *translator) pointer(ctx context.Context, rq driverhub.Request, actions ...interface{}) (driverhub.Response, error) {
+	return t.forward(ctx, rq, http.MethodPost, []string{"actions"}, map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{
+				"type":       "pointer",
+				"id":         mouseID,
+				"parameters": map[string]interface{}{"pointerType": "mouse"},
+				"actions":    actions,
+			},
+		},
+	}, nil)
+}
+
+func pointerAction(action string, button int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":   action,
+		"button": button,
+	}
+}
+
+// button returns the button of a JWP mouse command, defaulting to the left button.
+func button(body map[string]interface{}) int {
+	b, _ := number(body["button"])
+	return int(b)
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// elementID returns the ID of an element given either as a bare ID, as JWP moveto does, or as an
+// element reference.
+func elementID(v interface{}) (string, bool) {
+	switch e := v.(type) {
+	case string:
+		return e, e != ""
+	case map[string]interface{}:
+		id, ok := e[w3cElementKey].(string)
+		return id, ok
+	}
+	return "", false
+}
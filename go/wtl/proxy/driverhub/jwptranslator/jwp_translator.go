@@ -0,0 +1,411 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwptranslator provides a handler that lets JSON Wire Protocol clients use W3C-only
+// remote ends. Commands are rewritten to their W3C equivalents before being sent to the remote
+// end, and responses are converted back to JWP responses.
+//
+// The handler is only used when the client requested a session with JWP-only capabilities and
+// the remote end created a W3C session.
+package jwptranslator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+const (
+	// jwpElementKey is the key for element references in JWP.
+	jwpElementKey = "ELEMENT"
+	// w3cElementKey is the key for element references in W3C WebDriver.
+	w3cElementKey = "element-6066-11e4-a52e-4f735466cecf"
+	// mouseID is the ID of the pointer input source used for JWP mouse commands. W3C remote ends
+	// keep the state of input sources between action commands, so reusing it preserves the pointer
+	// position between commands as JWP clients expect.
+	mouseID = "mouse"
+)
+
+// rename is a command whose W3C equivalent differs only in method or path.
+type rename struct {
+	method    string
+	from      []string
+	w3cMethod string
+	to        []string
+}
+
+var renames = []rename{
+	{http.MethodPost, []string{"execute"}, http.MethodPost, []string{"execute", "sync"}},
+	{http.MethodPost, []string{"execute_async"}, http.MethodPost, []string{"execute", "async"}},
+	{http.MethodGet, []string{"window_handle"}, http.MethodGet, []string{"window"}},
+	{http.MethodGet, []string{"window_handles"}, http.MethodGet, []string{"window", "handles"}},
+	{http.MethodGet, []string{"alert_text"}, http.MethodGet, []string{"alert", "text"}},
+	{http.MethodPost, []string{"alert_text"}, http.MethodPost, []string{"alert", "text"}},
+	{http.MethodPost, []string{"accept_alert"}, http.MethodPost, []string{"alert", "accept"}},
+	{http.MethodPost, []string{"dismiss_alert"}, http.MethodPost, []string{"alert", "dismiss"}},
+	{http.MethodPost, []string{"element", "active"}, http.MethodGet, []string{"element", "active"}},
+}
+
+type translator struct {
+	sessionID string
+	base      driverhub.HandlerFunc
+}
+
+// ProviderFunc provides a handler that translates JWP commands to W3C for JWP clients of W3C
+// remote ends.
+func ProviderFunc(session *driverhub.WebDriverSession, caps *capabilities.Capabilities, base driverhub.HandlerFunc) (driverhub.HandlerFunc, bool) {
+	if caps == nil || caps.W3CSupported || !session.WebDriver.W3C() {
+		return base, false
+	}
+
+	t := &translator{
+		sessionID: session.WebDriver.SessionID(),
+		base:      base,
+	}
+	return t.handle, true
+}
+
+func (t *translator) handle(ctx context.Context, rq driverhub.Request) (driverhub.Response, error) {
+	body := map[string]interface{}{}
+	if len(rq.Body) != 0 {
+		if err := json.Unmarshal(rq.Body, &body); err != nil {
+			// Not a JSON object, so there is nothing to translate.
+			resp, err := t.base(ctx, rq)
+			if err != nil {
+				return resp, err
+			}
+			return t.toJWP(resp, nil)
+		}
+		body = toW3CElements(body).(map[string]interface{})
+	}
+
+	p := rq.Path
+	switch {
+	case match(rq, http.MethodPost, "moveto"):
+		return t.moveTo(ctx, rq, body)
+	case match(rq, http.MethodPost, "click"):
+		return t.click(ctx, rq, body, 1)
+	case match(rq, http.MethodPost, "doubleclick"):
+		return t.click(ctx, rq, body, 2)
+	case match(rq, http.MethodPost, "buttondown"):
+		return t.pointer(ctx, rq, pointerAction("pointerDown", button(body)))
+	case match(rq, http.MethodPost, "buttonup"):
+		return t.pointer(ctx, rq, pointerAction("pointerUp", button(body)))
+
+	case match(rq, http.MethodGet, "window", "*", "size"):
+		return t.windowRect(ctx, rq, p[1], nil, "width", "height")
+	case match(rq, http.MethodPost, "window", "*", "size"):
+		return t.windowRect(ctx, rq, p[1], body, "width", "height")
+	case match(rq, http.MethodGet, "window", "*", "position"):
+		return t.windowRect(ctx, rq, p[1], nil, "x", "y")
+	case match(rq, http.MethodPost, "window", "*", "position"):
+		return t.windowRect(ctx, rq, p[1], body, "x", "y")
+	case match(rq, http.MethodPost, "window", "*", "maximize"):
+		if err := t.checkWindow(ctx, rq, p[1]); err != nil {
+			return t.errorResponse(err)
+		}
+		return t.forward(ctx, rq, http.MethodPost, []string{"window", "maximize"}, map[string]interface{}{}, nil)
+
+	case match(rq, http.MethodGet, "element", "*", "location"):
+		return t.forward(ctx, rq, http.MethodGet, []string{"element", p[1], "rect"}, nil, project("x", "y"))
+	case match(rq, http.MethodGet, "element", "*", "size"):
+		return t.forward(ctx, rq, http.MethodGet, []string{"element", p[1], "rect"}, nil, project("width", "height"))
+	case match(rq, http.MethodPost, "element", "*", "value"):
+		if _, ok := body["text"]; !ok {
+			body["text"] = joinKeys(body["value"])
+		}
+
+	case match(rq, http.MethodPost, "element"), match(rq, http.MethodPost, "elements"),
+		match(rq, http.MethodPost, "element", "*", "element"), match(rq, http.MethodPost, "element", "*", "elements"):
+		translateLocator(body)
+
+	case match(rq, http.MethodPost, "timeouts"):
+		if kind, ok := body["type"].(string); ok {
+			if kind == "page load" {
+				kind = "pageLoad"
+			}
+			body = map[string]interface{}{kind: body["ms"]}
+		}
+	case match(rq, http.MethodPost, "timeouts", "implicit_wait"):
+		return t.forward(ctx, rq, http.MethodPost, []string{"timeouts"}, map[string]interface{}{"implicit": body["ms"]}, nil)
+	case match(rq, http.MethodPost, "timeouts", "async_script"):
+		return t.forward(ctx, rq, http.MethodPost, []string{"timeouts"}, map[string]interface{}{"script": body["ms"]}, nil)
+	}
+
+	for _, r := range renames {
+		if match(rq, r.method, r.from...) {
+			if r.w3cMethod == http.MethodGet {
+				body = nil
+			}
+			return t.forward(ctx, rq, r.w3cMethod, r.to, body, nil)
+		}
+	}
+
+	if len(rq.Body) == 0 {
+		return t.forward(ctx, rq, rq.Method, rq.Path, nil, nil)
+	}
+	return t.forward(ctx, rq, rq.Method, rq.Path, body, nil)
+}
+
+// match returns whether rq is for method and path, where "*" in path matches any segment.
+func match(rq driverhub.Request, method string, path ...string) bool {
+	if rq.Method != method || len(rq.Path) != len(path) {
+		return false
+	}
+	for i, s := range path {
+		if s != "*" && s != rq.Path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// forward sends a W3C command to the remote end and translates its response to JWP. If body is
+// nil, the command has no body. If project is non-nil, it is applied to the value of a
+// successful response.
+func (t *translator) forward(ctx context.Context, rq driverhub.Request, method string, path []string, body map[string]interface{}, project func(interface{}) interface{}) (driverhub.Response, error) {
+	resp, err := t.send(ctx, rq, method, path, body)
+	if err != nil {
+		return resp, err
+	}
+	return t.toJWP(resp, project)
+}
+
+// send sends a W3C command to the remote end.
+func (t *translator) send(ctx context.Context, rq driverhub.Request, method string, path []string, body map[string]interface{}) (driverhub.Response, error) {
+	w3c := driverhub.Request{
+		Method: method,
+		Path:   path,
+		Header: rq.Header,
+	}
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return driverhub.Response{}, err
+		}
+		w3c.Body = b
+	}
+	return t.base(ctx, w3c)
+}
+
+// value sends a W3C command and returns the value of its response, or an error if it failed.
+func (t *translator) value(ctx context.Context, rq driverhub.Request, method string, path []string) (interface{}, error) {
+	resp, err := t.send(ctx, rq, method, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil, err
+	}
+	if e, ok := responseError(resp, body); ok {
+		return nil, e
+	}
+	return body["value"], nil
+}
+
+// toJWP converts a W3C response into a JWP response. Responses that are already JWP responses
+// are returned unchanged.
+func (t *translator) toJWP(resp driverhub.Response, project func(interface{}) interface{}) (driverhub.Response, error) {
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return resp, nil
+	}
+	if _, ok := body["status"]; ok {
+		return resp, nil
+	}
+
+	if e, ok := responseError(resp, body); ok {
+		return t.errorResponse(e)
+	}
+
+	value := body["value"]
+	if project != nil {
+		value = project(value)
+	}
+	return t.jwpResponse(http.StatusOK, 0, toJWPElements(value), resp.Header)
+}
+
+func (t *translator) errorResponse(err error) (driverhub.Response, error) {
+	status := webdriver.ErrorStatus(err)
+	if status <= 0 {
+		// W3C errors without a JWP equivalent are reported as unknown errors.
+		status = 13
+	}
+	return t.jwpResponse(http.StatusInternalServerError, status, map[string]interface{}{"message": webdriver.ErrorMessage(err)}, nil)
+}
+
+func (t *translator) jwpResponse(httpStatus, status int, value interface{}, header http.Header) (driverhub.Response, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"sessionId": t.sessionID,
+		"status":    status,
+		"value":     value,
+	})
+	if err != nil {
+		return driverhub.Response{}, err
+	}
+
+	h := http.Header{}
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Del("Content-Length")
+	return driverhub.Response{
+		Status: httpStatus,
+		Header: h,
+		Body:   b,
+	}, nil
+}
+
+// responseError returns the error described by a W3C error response.
+func responseError(resp driverhub.Response, body map[string]interface{}) (error, bool) {
+	value, _ := body["value"].(map[string]interface{})
+	e, ok := value["error"].(string)
+	if !ok {
+		if resp.Status < http.StatusBadRequest {
+			return nil, false
+		}
+		e = "unknown error"
+	}
+	message, _ := value["message"].(string)
+	return webdriver.ErrorFromError(e, message), true
+}
+
+// checkWindow returns an error unless handle refers to the current window, since W3C window
+// commands always apply to the current window.
+func (t *translator) checkWindow(ctx context.Context, rq driverhub.Request, handle string) error {
+	if handle == "current" {
+		return nil
+	}
+	current, err := t.value(ctx, rq, http.MethodGet, []string{"window"})
+	if err != nil {
+		return err
+	}
+	if current != handle {
+		return webdriver.ErrorFromError("unsupported operation",
+			fmt.Sprintf("window %s is not the current window; switch to it before resizing or moving it", handle))
+	}
+	return nil
+}
+
+// windowRect gets or sets (if body is non-nil) the fields of the current window's rect.
+func (t *translator) windowRect(ctx context.Context, rq driverhub.Request, handle string, body map[string]interface{}, fields ...string) (driverhub.Response, error) {
+	if err := t.checkWindow(ctx, rq, handle); err != nil {
+		return t.errorResponse(err)
+	}
+	if body == nil {
+		return t.forward(ctx, rq, http.MethodGet, []string{"window", "rect"}, nil, project(fields...))
+	}
+	rect := map[string]interface{}{}
+	for _, f := range fields {
+		rect[f] = body[f]
+	}
+	return t.forward(ctx, rq, http.MethodPost, []string{"window", "rect"}, rect, func(interface{}) interface{} { return nil })
+}
+
+// project returns a func that keeps only fields of a map value.
+func project(fields ...string) func(interface{}) interface{} {
+	return func(v interface{}) interface{} {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		out := map[string]interface{}{}
+		for _, f := range fields {
+			out[f] = m[f]
+		}
+		return out
+	}
+}
+
+// translateLocator replaces locator strategies that W3C dropped with equivalent CSS selectors.
+func translateLocator(body map[string]interface{}) {
+	using, _ := body["using"].(string)
+	value, _ := body["value"].(string)
+	quoted := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+
+	switch using {
+	case "id":
+		body["value"] = "[id=" + quoted + "]"
+	case "name":
+		body["value"] = "[name=" + quoted + "]"
+	case "class name":
+		body["value"] = "[class~=" + quoted + "]"
+	default:
+		return
+	}
+	body["using"] = "css selector"
+}
+
+// joinKeys converts the JWP value of a send keys command, a list of strings, into W3C text.
+func joinKeys(v interface{}) string {
+	keys, _ := v.([]interface{})
+	text := ""
+	for _, k := range keys {
+		if s, ok := k.(string); ok {
+			text += s
+		}
+	}
+	return text
+}
+
+// toW3CElements replaces JWP element references in v with W3C element references.
+func toW3CElements(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, e := range t {
+			out[k] = toW3CElements(e)
+		}
+		if id, ok := out[jwpElementKey].(string); ok && len(out) == 1 {
+			return map[string]interface{}{w3cElementKey: id}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = toW3CElements(e)
+		}
+		return out
+	}
+	return v
+}
+
+// toJWPElements adds JWP element references to the W3C element references in v.
+func toJWPElements(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, e := range t {
+			out[k] = toJWPElements(e)
+		}
+		if id, ok := out[w3cElementKey].(string); ok {
+			out[jwpElementKey] = id
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = toJWPElements(e)
+		}
+		return out
+	}
+	return v
+}
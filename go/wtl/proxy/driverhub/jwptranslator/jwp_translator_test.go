@@ -0,0 +1,334 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwptranslator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+type fakeDriver struct {
+	webdriver.WebDriver
+	w3c bool
+}
+
+func (d *fakeDriver) W3C() bool {
+	return d.w3c
+}
+
+func (*fakeDriver) SessionID() string {
+	return "s1"
+}
+
+// fakeRemoteEnd records the W3C commands it receives and replies with canned responses keyed
+// by "METHOD path".
+type fakeRemoteEnd struct {
+	commands  []string
+	bodies    []map[string]interface{}
+	responses map[string]string
+}
+
+func (f *fakeRemoteEnd) handle(_ context.Context, rq driverhub.Request) (driverhub.Response, error) {
+	cmd := rq.Method + " " + strings.Join(rq.Path, "/")
+	f.commands = append(f.commands, cmd)
+	var body map[string]interface{}
+	if len(rq.Body) != 0 {
+		if err := json.Unmarshal(rq.Body, &body); err != nil {
+			return driverhub.Response{}, err
+		}
+	}
+	f.bodies = append(f.bodies, body)
+
+	resp, ok := f.responses[cmd]
+	if !ok {
+		return driverhub.Response{Status: http.StatusOK, Body: []byte(`{"value": null}`)}, nil
+	}
+	status := http.StatusOK
+	if strings.Contains(resp, `"error"`) {
+		status = http.StatusNotFound
+	}
+	return driverhub.Response{Status: status, Body: []byte(resp)}, nil
+}
+
+func newTranslator(t *testing.T, remote *fakeRemoteEnd) driverhub.HandlerFunc {
+	t.Helper()
+	session := &driverhub.WebDriverSession{WebDriver: &fakeDriver{w3c: true}}
+	h, ok := ProviderFunc(session, &capabilities.Capabilities{}, remote.handle)
+	if !ok {
+		t.Fatal("Got ok == false for JWP client of W3C remote end, expected true")
+	}
+	return h
+}
+
+func decode(t *testing.T, resp driverhub.Response) map[string]interface{} {
+	t.Helper()
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(resp.Body, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestProviderFuncEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		clientW3C  bool
+		remoteW3C  bool
+		translates bool
+	}{
+		{"JWP client, W3C remote end", false, true, true},
+		{"W3C client, W3C remote end", true, true, false},
+		{"JWP client, JWP remote end", false, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			session := &driverhub.WebDriverSession{WebDriver: &fakeDriver{w3c: tc.remoteW3C}}
+			_, ok := ProviderFunc(session, &capabilities.Capabilities{W3CSupported: tc.clientW3C}, (&fakeRemoteEnd{}).handle)
+			if ok != tc.translates {
+				t.Errorf("Got ok == %v, expected %v", ok, tc.translates)
+			}
+		})
+	}
+}
+
+func TestTranslateCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		commands []string
+		// The body of the last W3C command, if checked.
+		w3cBody map[string]interface{}
+	}{
+		{
+			"execute",
+			http.MethodPost, "execute", `{"script": "return arguments[0];", "args": [{"ELEMENT": "e1"}]}`,
+			[]string{"POST execute/sync"},
+			map[string]interface{}{"script": "return arguments[0];", "args": []interface{}{map[string]interface{}{w3cElementKey: "e1"}}},
+		},
+		{
+			"execute async",
+			http.MethodPost, "execute_async", `{"script": "", "args": []}`,
+			[]string{"POST execute/async"},
+			nil,
+		},
+		{
+			"active element",
+			http.MethodPost, "element/active", ``,
+			[]string{"GET element/active"},
+			nil,
+		},
+		{
+			"find element by id",
+			http.MethodPost, "element", `{"using": "id", "value": "a\"b"}`,
+			[]string{"POST element"},
+			map[string]interface{}{"using": "css selector", "value": `[id="a\"b"]`},
+		},
+		{
+			"send keys",
+			http.MethodPost, "element/e1/value", `{"value": ["ab", "c"]}`,
+			[]string{"POST element/e1/value"},
+			map[string]interface{}{"value": []interface{}{"ab", "c"}, "text": "abc"},
+		},
+		{
+			"implicit wait",
+			http.MethodPost, "timeouts/implicit_wait", `{"ms": 100}`,
+			[]string{"POST timeouts"},
+			map[string]interface{}{"implicit": float64(100)},
+		},
+		{
+			"page load timeout",
+			http.MethodPost, "timeouts", `{"type": "page load", "ms": 100}`,
+			[]string{"POST timeouts"},
+			map[string]interface{}{"pageLoad": float64(100)},
+		},
+		{
+			"set window size",
+			http.MethodPost, "window/current/size", `{"width": 800, "height": 600}`,
+			[]string{"POST window/rect"},
+			map[string]interface{}{"width": float64(800), "height": float64(600)},
+		},
+		{
+			"maximize named window",
+			http.MethodPost, "window/w1/maximize", ``,
+			[]string{"GET window", "POST window/maximize"},
+			nil,
+		},
+		{
+			"move to element",
+			http.MethodPost, "moveto", `{"element": "e1"}`,
+			[]string{"POST actions"},
+			pointerActions(map[string]interface{}{"type": "pointerMove", "duration": float64(0), "origin": map[string]interface{}{w3cElementKey: "e1"}, "x": float64(0), "y": float64(0)}),
+		},
+		{
+			"move to element with offset",
+			http.MethodPost, "moveto", `{"element": "e1", "xoffset": 5, "yoffset": 5}`,
+			[]string{"GET element/e1/rect", "POST actions"},
+			pointerActions(map[string]interface{}{"type": "pointerMove", "duration": float64(0), "origin": map[string]interface{}{w3cElementKey: "e1"}, "x": float64(-45), "y": float64(-5)}),
+		},
+		{
+			"move by offset",
+			http.MethodPost, "moveto", `{"xoffset": 5, "yoffset": 6}`,
+			[]string{"POST actions"},
+			pointerActions(map[string]interface{}{"type": "pointerMove", "duration": float64(0), "origin": "pointer", "x": float64(5), "y": float64(6)}),
+		},
+		{
+			"right click",
+			http.MethodPost, "click", `{"button": 2}`,
+			[]string{"POST actions"},
+			pointerActions(
+				map[string]interface{}{"type": "pointerDown", "button": float64(2)},
+				map[string]interface{}{"type": "pointerUp", "button": float64(2)}),
+		},
+		{
+			"unchanged command",
+			http.MethodGet, "title", ``,
+			[]string{"GET title"},
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			remote := &fakeRemoteEnd{responses: map[string]string{
+				"GET window":          `{"value": "w1"}`,
+				"GET element/e1/rect": `{"value": {"x": 10, "y": 10, "width": 100, "height": 20}}`,
+			}}
+			h := newTranslator(t, remote)
+
+			var path []string
+			if tc.path != "" {
+				path = strings.Split(tc.path, "/")
+			}
+			resp, err := h(context.Background(), driverhub.Request{Method: tc.method, Path: path, Body: []byte(tc.body)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m := decode(t, resp); m["status"] != float64(0) || m["sessionId"] != "s1" {
+				t.Errorf("Got response %v, expected JWP success", m)
+			}
+			if !reflect.DeepEqual(remote.commands, tc.commands) {
+				t.Errorf("Got W3C commands %v, expected %v", remote.commands, tc.commands)
+			}
+			if tc.w3cBody != nil && !reflect.DeepEqual(remote.bodies[len(remote.bodies)-1], tc.w3cBody) {
+				t.Errorf("Got W3C body %v, expected %v", remote.bodies[len(remote.bodies)-1], tc.w3cBody)
+			}
+		})
+	}
+}
+
+func pointerActions(actions ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{
+				"type":       "pointer",
+				"id":         mouseID,
+				"parameters": map[string]interface{}{"pointerType": "mouse"},
+				"actions":    actions,
+			},
+		},
+	}
+}
+
+func TestTranslateResponses(t *testing.T) {
+	remote := &fakeRemoteEnd{responses: map[string]string{
+		"POST elements":    `{"value": [{"` + w3cElementKey + `": "e1"}, {"` + w3cElementKey + `": "e2"}]}`,
+		"GET window/rect":  `{"value": {"x": 1, "y": 2, "width": 800, "height": 600}}`,
+		"GET window":       `{"value": "w1"}`,
+		"POST element":     `{"value": {"error": "no such element", "message": "gone"}}`,
+		"POST actions":     `{"value": {"error": "move target out of bounds", "message": "out"}}`,
+		"POST window/rect": `{"value": {"error": "unsupported operation", "message": "no"}}`,
+	}}
+	h := newTranslator(t, remote)
+
+	for _, tc := range []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		httpStatus int
+		status     float64
+		value      interface{}
+	}{
+		{
+			"element references",
+			http.MethodPost, "elements", `{"using": "css selector", "value": "a"}`,
+			http.StatusOK, 0,
+			[]interface{}{
+				map[string]interface{}{w3cElementKey: "e1", jwpElementKey: "e1"},
+				map[string]interface{}{w3cElementKey: "e2", jwpElementKey: "e2"},
+			},
+		},
+		{
+			"window size",
+			http.MethodGet, "window/current/size", ``,
+			http.StatusOK, 0,
+			map[string]interface{}{"width": float64(800), "height": float64(600)},
+		},
+		{
+			"window position",
+			http.MethodGet, "window/w1/position", ``,
+			http.StatusOK, 0,
+			map[string]interface{}{"x": float64(1), "y": float64(2)},
+		},
+		{
+			"error",
+			http.MethodPost, "element", `{"using": "css selector", "value": "a"}`,
+			http.StatusInternalServerError, 7,
+			map[string]interface{}{"message": "gone"},
+		},
+		{
+			"error with status code",
+			http.MethodPost, "moveto", `{"xoffset": 1, "yoffset": 1}`,
+			http.StatusInternalServerError, 34,
+			map[string]interface{}{"message": "out"},
+		},
+		{
+			"error without JWP status code",
+			http.MethodPost, "window/current/size", `{"width": 1, "height": 1}`,
+			http.StatusInternalServerError, 13,
+			map[string]interface{}{"message": "no"},
+		},
+		{
+			"window other than current",
+			http.MethodGet, "window/w2/size", ``,
+			http.StatusInternalServerError, 13,
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := h(context.Background(), driverhub.Request{Method: tc.method, Path: strings.Split(tc.path, "/"), Body: []byte(tc.body)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tc.httpStatus {
+				t.Errorf("Got HTTP status %d, expected %d", resp.Status, tc.httpStatus)
+			}
+			m := decode(t, resp)
+			if m["status"] != tc.status {
+				t.Errorf("Got status %v, expected %v", m["status"], tc.status)
+			}
+			if tc.value != nil && !reflect.DeepEqual(m["value"], tc.value) {
+				t.Errorf("Got value %#v, expected %#v", m["value"], tc.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package networkmock provides vendor extension commands for stubbing the browser's network
+// requests. Rules are enforced by the session's network proxy, so networkProxy.enabled must be set
+// in the metadata.
+//
+// The commands are:
+//
+//	POST   /session/{id}/google/network/rules           add a rule, returns {"id": ...}
+//	GET    /session/{id}/google/network/rules           list the rules and how often each matched
+//	DELETE /session/{id}/google/network/rules           remove all rules
+//	DELETE /session/{id}/google/network/rules/{ruleId}  remove a single rule
+//
+// A rule is, e.g.:
+//
+//	{"urlPattern": "^https://api\\.example\\.com/users", "method": "GET", "action": "respond",
+//	 "status": 200, "headers": {"Content-Type": "application/json"}, "body": "[]"}
+//
+// action is one of respond (return status, headers and body), delay (wait for delay, a number of
+// seconds or a duration string such as "2s", then forward the request), fail (drop the
+// connection), or passthrough (forward the request unchanged). A respond rule may also specify a delay. The first rule that matches a request is
+// applied. All rules are removed when the session quits.
+package networkmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/netproxy"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+const compName = "Network Mock Handler"
+
+// rule is a single network mocking rule.
+type rule struct {
+	// The id assigned when the rule was added.
+	ID string `json:"id"`
+	// Matched against the full URL of the request.
+	URLPattern string `json:"urlPattern"`
+	// The HTTP method to match. If empty, matches all methods.
+	Method string `json:"method,omitempty"`
+	// One of respond, delay, fail, or passthrough.
+	Action string `json:"action"`
+	// For respond, the response returned to the browser. Status defaults to 200.
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// For delay and respond, how long to wait before responding, as a number of seconds or a
+	// duration string.
+	Delay interface{} `json:"delay,omitempty"`
+	// The number of requests this rule has been applied to.
+	Hits int `json:"hits"`
+
+	urlPattern *regexp.Regexp
+	delay      time.Duration
+}
+
+// mocker holds the rules for a single session.
+type mocker struct {
+	mu     sync.Mutex
+	rules  []*rule
+	nextID int
+}
+
+// NeedsBody returns true for the google/network vendor extension commands.
+func NeedsBody(_ string, path []string) bool {
+	return len(path) >= 3 && path[0] == "google" && path[1] == "network" && path[2] == "rules"
+}
+
+// ProviderFunc provides a handler for the google/network vendor extension commands.
+func ProviderFunc(session *driverhub.WebDriverSession, _ *capabilities.Capabilities, base driverhub.HandlerFunc) (driverhub.HandlerFunc, bool) {
+	m := &mocker{}
+
+	return func(ctx context.Context, rq driverhub.Request) (driverhub.Response, error) {
+		// If quit command, then clear all rules before quitting.
+		if rq.Method == http.MethodDelete && len(rq.Path) == 0 {
+			if p, ok := netproxy.ForSession(session.Environment(), session.ID); ok {
+				p.SetInterceptor(nil)
+			}
+			m.clear()
+			return base(ctx, rq)
+		}
+
+		if !NeedsBody(rq.Method, rq.Path) {
+			return base(ctx, rq)
+		}
+
+		p, ok := netproxy.ForSession(session.Environment(), session.ID)
+		if !ok {
+			return driverhub.ResponseFromError(webdriver.ErrorFromError("unsupported operation",
+				fmt.Sprintf("[%s] network mocking requires networkProxy.enabled to be set in the test metadata", compName)))
+		}
+
+		switch {
+		case rq.Method == http.MethodPost && len(rq.Path) == 3:
+			r, err := newRule(rq.Body)
+			if err != nil {
+				return driverhub.ResponseFromError(webdriver.ErrorFromError("invalid argument", fmt.Sprintf("[%s] %v", compName, err)))
+			}
+			id := m.add(r)
+			p.SetInterceptor(m.intercept)
+			return driverhub.SuccessfulResponse(map[string]interface{}{"id": id})
+		case rq.Method == http.MethodGet && len(rq.Path) == 3:
+			return driverhub.SuccessfulResponse(m.list())
+		case rq.Method == http.MethodDelete && len(rq.Path) == 3:
+			m.clear()
+			return driverhub.SuccessfulResponse(nil)
+		case rq.Method == http.MethodDelete && len(rq.Path) == 4:
+			if !m.remove(rq.Path[3]) {
+				return driverhub.ResponseFromError(webdriver.ErrorFromError("invalid argument", fmt.Sprintf("[%s] no rule with id %q", compName, rq.Path[3])))
+			}
+			return driverhub.SuccessfulResponse(nil)
+		}
+
+		return driverhub.ResponseFromError(webdriver.ErrorFromError("unknown command",
+			fmt.Sprintf("[%s] unknown command %s /%s", compName, rq.Method, strings.Join(rq.Path, "/"))))
+	}, true
+}
+
+func newRule(body []byte) (*rule, error) {
+	r := &rule{}
+	if err := json.Unmarshal(body, r); err != nil {
+		return nil, fmt.Errorf("unable to parse rule %s: %v", body, err)
+	}
+
+	if r.URLPattern == "" {
+		return nil, fmt.Errorf("rule %s has no urlPattern", body)
+	}
+	re, err := regexp.Compile(r.URLPattern)
+	if err != nil {
+		return nil, fmt.Errorf("urlPattern %q is not a valid regular expression: %v", r.URLPattern, err)
+	}
+	r.urlPattern = re
+	r.Method = strings.ToUpper(r.Method)
+
+	switch r.Action {
+	case "respond":
+		if r.Status == 0 {
+			r.Status = http.StatusOK
+		}
+	case "delay":
+		if r.Delay == nil {
+			return nil, fmt.Errorf("delay rule for %q has no delay", r.URLPattern)
+		}
+	case "fail", "passthrough":
+	default:
+		return nil, fmt.Errorf("action %q must be one of respond, delay, fail, or passthrough", r.Action)
+	}
+
+	if r.Delay != nil {
+		d, err := metadata.Duration(r.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("delay %#v is not a valid duration: %v", r.Delay, err)
+		}
+		r.delay = d
+	}
+	r.Hits = 0
+
+	return r, nil
+}
+
+func (m *mocker) add(r *rule) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	r.ID = strconv.Itoa(m.nextID)
+	m.rules = append(m.rules, r)
+	return r.ID
+}
+
+func (m *mocker) remove(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mocker) clear() {
+	m.mu.Lock()
+	m.rules = nil
+	m.mu.Unlock()
+}
+
+func (m *mocker) list() []rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := []rule{}
+	for _, r := range m.rules {
+		rules = append(rules, *r)
+	}
+	return rules
+}
+
+// match returns a copy of the first rule matching req, and records the hit.
+func (m *mocker) match(req *http.Request) (rule, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	url := req.URL.String()
+	for _, r := range m.rules {
+		if r.Method != "" && r.Method != req.Method {
+			continue
+		}
+		if r.urlPattern.MatchString(url) {
+			r.Hits++
+			return *r, true
+		}
+	}
+	return rule{}, false
+}
+
+// intercept is the netproxy.Interceptor that applies the rules.
+func (m *mocker) intercept(req *http.Request) (*http.Response, error) {
+	r, ok := m.match(req)
+	if !ok {
+		return nil, nil
+	}
+
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch r.Action {
+	case "respond":
+		header := http.Header{}
+		for k, v := range r.Headers {
+			header.Set(k, v)
+		}
+		return &http.Response{
+			StatusCode:    r.Status,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(r.Body)),
+			ContentLength: int64(len(r.Body)),
+			Request:       req,
+		}, nil
+	case "fail":
+		return nil, fmt.Errorf("request for %s failed by network mock rule %s", req.URL, r.ID)
+	}
+	return nil, nil
+}
@@ -0,0 +1,260 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmock
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/metadata/capabilities"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/netproxy"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+type fakeEnv struct {
+	environment.Env
+}
+
+func (*fakeEnv) SetUp(context.Context) error    { return nil }
+func (*fakeEnv) TearDown(context.Context) error { return nil }
+
+func (*fakeEnv) StartSession(_ context.Context, _ int, caps *capabilities.Capabilities) (*capabilities.Capabilities, error) {
+	return caps, nil
+}
+
+func (*fakeEnv) StopSession(context.Context, int) error {
+	return nil
+}
+
+func newSession(t *testing.T, enabled bool) (*driverhub.WebDriverSession, func()) {
+	t.Helper()
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir(bazel.TestTmpDir(), "networkmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"environment": "local",
+		"extension": map[string]interface{}{
+			"networkProxy": map[string]interface{}{
+				"enabled": enabled,
+				"mitm":    false,
+				"harDir":  dir,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := metadata.FromBytes(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := netproxy.WrapIfEnabled(&fakeEnv{}, m, diagnostics.NoOP())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.StartSession(ctx, 1, &capabilities.Capabilities{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := &driverhub.WebDriverSession{
+		ID:           1,
+		WebDriverHub: &driverhub.WebDriverHub{Env: env},
+	}
+	return session, func() {
+		env.TearDown(ctx)
+		os.RemoveAll(dir)
+	}
+}
+
+func baseHandler(context.Context, driverhub.Request) (driverhub.Response, error) {
+	return driverhub.SuccessfulResponse("from driver")
+}
+
+func get(t *testing.T, session *driverhub.WebDriverSession, target string) (int, string, error) {
+	t.Helper()
+	p, ok := netproxy.ForSession(session.WebDriverHub.Env, session.ID)
+	if !ok {
+		t.Fatal("got no proxy for session")
+	}
+	u, err := url.Parse("http://" + p.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	resp, err := client.Get(target)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("real"))
+	}))
+	defer backend.Close()
+
+	session, cleanup := newSession(t, true)
+	defer cleanup()
+
+	handler, ok := ProviderFunc(session, nil, baseHandler)
+	if !ok {
+		t.Fatal("got ok false, want true")
+	}
+
+	resp, err := handler(ctx, driverhub.Request{
+		Method: http.MethodPost,
+		Path:   []string{"google", "network", "rules"},
+		Body:   []byte(`{"urlPattern": "/users$", "action": "respond", "status": 201, "body": "stubbed"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Fatalf("got status %d adding rule, want 200: %s", resp.Status, resp.Body)
+	}
+
+	if _, err := handler(ctx, driverhub.Request{
+		Method: http.MethodPost,
+		Path:   []string{"google", "network", "rules"},
+		Body:   []byte(`{"urlPattern": "/broken$", "action": "fail"}`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, body, err := get(t, session, backend.URL+"/users"); err != nil || status != http.StatusCreated || body != "stubbed" {
+		t.Errorf("got %d %q %v, want 201 %q", status, body, err, "stubbed")
+	}
+	if status, body, err := get(t, session, backend.URL+"/other"); err != nil || status != http.StatusOK || body != "real" {
+		t.Errorf("got %d %q %v, want 200 %q", status, body, err, "real")
+	}
+	if _, _, err := get(t, session, backend.URL+"/broken"); err == nil {
+		t.Error("got nil error for failed request, want error")
+	}
+
+	resp, err = handler(ctx, driverhub.Request{Method: http.MethodGet, Path: []string{"google", "network", "rules"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Value []rule `json:"value"`
+	}
+	if err := json.Unmarshal(resp.Body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Value) != 2 || list.Value[0].Hits != 1 {
+		t.Errorf("got rules %+v, want 2 rules with first having 1 hit", list.Value)
+	}
+
+	resp, err = handler(ctx, driverhub.Request{Method: http.MethodDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.Body), "from driver") {
+		t.Errorf("got quit response %s, want forwarded to driver", resp.Body)
+	}
+
+	if status, body, err := get(t, session, backend.URL+"/users"); err != nil || status != http.StatusOK || body != "real" {
+		t.Errorf("after quit got %d %q %v, want 200 %q", status, body, err, "real")
+	}
+}
+
+func TestInvalidRule(t *testing.T) {
+	session, cleanup := newSession(t, true)
+	defer cleanup()
+
+	handler, _ := ProviderFunc(session, nil, baseHandler)
+
+	for _, body := range []string{
+		`{"action": "respond"}`,
+		`{"urlPattern": "(", "action": "respond"}`,
+		`{"urlPattern": "x", "action": "explode"}`,
+		`{"urlPattern": "x", "action": "delay"}`,
+		`{"urlPattern": "x", "action": "delay", "delay": "soon"}`,
+	} {
+		resp, err := handler(context.Background(), driverhub.Request{
+			Method: http.MethodPost,
+			Path:   []string{"google", "network", "rules"},
+			Body:   []byte(body),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != http.StatusBadRequest {
+			t.Errorf("got status %d for rule %s, want 400", resp.Status, body)
+		}
+	}
+}
+
+func TestNewRuleDelay(t *testing.T) {
+	for _, tc := range []struct {
+		delay string
+		want  time.Duration
+	}{
+		{`2`, 2 * time.Second},
+		{`0.25`, 250 * time.Millisecond},
+		{`"150ms"`, 150 * time.Millisecond},
+	} {
+		r, err := newRule([]byte(`{"urlPattern": "x", "action": "delay", "delay": ` + tc.delay + `}`))
+		if err != nil {
+			t.Errorf("got error %v for delay %s, want nil", err, tc.delay)
+			continue
+		}
+		if r.delay != tc.want {
+			t.Errorf("got delay %v for %s, want %v", r.delay, tc.delay, tc.want)
+		}
+	}
+}
+
+func TestNoNetworkProxy(t *testing.T) {
+	session, cleanup := newSession(t, false)
+	defer cleanup()
+
+	handler, _ := ProviderFunc(session, nil, baseHandler)
+
+	resp, err := handler(context.Background(), driverhub.Request{
+		Method: http.MethodGet,
+		Path:   []string{"google", "network", "rules"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.Body), "unsupported operation") {
+		t.Errorf("got %s, want unsupported operation error", resp.Body)
+	}
+}
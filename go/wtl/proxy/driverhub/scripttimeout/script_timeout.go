@@ -26,6 +26,11 @@ import (
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
 )
 
+// NeedsBody returns true for the set timeouts commands, whose bodies the handler rewrites.
+func NeedsBody(method string, path []string) bool {
+	return method == http.MethodPost && len(path) > 0 && path[0] == "timeouts"
+}
+
 // ProviderFunc provides a handler for set script timeout commands.
 func ProviderFunc(session *driverhub.WebDriverSession, _ *capabilities.Capabilities, base driverhub.HandlerFunc) (driverhub.HandlerFunc, bool) {
 	return func(ctx context.Context, rq driverhub.Request) (driverhub.Response, error) {
@@ -0,0 +1,171 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+)
+
+// sessionOptions is the set of options that can be defined in the sessionOptions section of
+// a Metadata.Extension field.
+type sessionOptions struct {
+	// The maximum number of sessions that can be running at once. Additional new session requests
+	// wait in a FIFO queue until a running session quits. If 0, the number of sessions is not limited.
+	maxSessions int
+	// How long a new session request will wait in the queue before failing. Can be a number of seconds
+	// or a duration string (e.g. "90s"). If 0, requests wait until the client gives up.
+	queueTimeout time.Duration
+	// How long a session can go without receiving a command before it is quit. Can be a number of
+	// seconds or a duration string (e.g. "10m"). If 0, sessions are never reaped.
+	idleTimeout time.Duration
+}
+
+func extractSessionOptions(m *metadata.Metadata) (sessionOptions, error) {
+	opts := sessionOptions{}
+
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return opts, nil
+	}
+
+	soMap, ok := extMap["sessionOptions"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+
+	if ms, ok := soMap["maxSessions"]; ok {
+		f, ok := ms.(float64)
+		if !ok || f < 0 {
+			return opts, fmt.Errorf("sessionOptions.maxSessions %#v is not a non-negative number", ms)
+		}
+		opts.maxSessions = int(f)
+	}
+
+	if qt, ok := soMap["queueTimeout"]; ok {
+		d, err := metadata.Duration(qt)
+		if err != nil {
+			return opts, fmt.Errorf("sessionOptions.queueTimeout: %v", err)
+		}
+		opts.queueTimeout = d
+	}
+
+	if it, ok := soMap["idleTimeout"]; ok {
+		d, err := metadata.Duration(it)
+		if err != nil {
+			return opts, fmt.Errorf("sessionOptions.idleTimeout: %v", err)
+		}
+		opts.idleTimeout = d
+	}
+
+	return opts, nil
+}
+
+// sessionQueue limits the number of concurrently running sessions. Requests for a slot that
+// cannot be satisfied immediately are granted in the order they were made.
+type sessionQueue struct {
+	max     int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	active  int
+	waiting []chan struct{}
+}
+
+func newSessionQueue(opts sessionOptions) *sessionQueue {
+	return &sessionQueue{
+		max:     opts.maxSessions,
+		timeout: opts.queueTimeout,
+	}
+}
+
+// acquire blocks until a slot is available, ctx is done, or the queue timeout expires. It returns
+// the number of requests that were ahead of this one when it was made, and a func that must be
+// called exactly once to release the slot.
+func (q *sessionQueue) acquire(ctx context.Context) (int, func(), error) {
+	q.mu.Lock()
+	if q.max <= 0 || (q.active < q.max && len(q.waiting) == 0) {
+		q.active++
+		q.mu.Unlock()
+		return 0, q.releaseFunc(), nil
+	}
+
+	depth := len(q.waiting)
+	ready := make(chan struct{})
+	q.waiting = append(q.waiting, ready)
+	q.mu.Unlock()
+
+	var expired <-chan time.Time
+	if q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return depth, q.releaseFunc(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-expired:
+		err = fmt.Errorf("timed out after %v waiting for one of %d session slots", q.timeout, q.max)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, w := range q.waiting {
+		if w == ready {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return depth, nil, errors.New("session queue", err)
+		}
+	}
+	// A slot was handed to this request while it was giving up, so pass it along.
+	q.releaseLocked()
+	return depth, nil, errors.New("session queue", err)
+}
+
+func (q *sessionQueue) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.releaseLocked()
+		})
+	}
+}
+
+func (q *sessionQueue) releaseLocked() {
+	if len(q.waiting) != 0 {
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		close(next)
+		return
+	}
+	q.active--
+}
+
+// depth returns the number of requests currently waiting for a slot.
+func (q *sessionQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
@@ -0,0 +1,195 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+func TestSessionQueueUnlimited(t *testing.T) {
+	q := newSessionQueue(sessionOptions{})
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := q.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionQueueFIFO(t *testing.T) {
+	q := newSessionQueue(sessionOptions{maxSessions: 1})
+
+	_, release, err := q.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			_, release, err := q.acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			release()
+		}(i)
+		// Wait for the goroutine to be queued so that queue order is deterministic.
+		for q.depth() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	release()
+
+	for i := 0; i < 3; i++ {
+		if got := <-order; got != i {
+			t.Fatalf("Got request %d granted slot, want %d", got, i)
+		}
+	}
+}
+
+func TestSessionQueueTimeout(t *testing.T) {
+	q := newSessionQueue(sessionOptions{maxSessions: 1, queueTimeout: 10 * time.Millisecond})
+
+	_, release, err := q.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := q.acquire(context.Background()); err == nil {
+		t.Fatal("Got nil error, want queue timeout")
+	}
+
+	if d := q.depth(); d != 0 {
+		t.Errorf("Got depth %d after timeout, want 0", d)
+	}
+
+	release()
+
+	if _, _, err := q.acquire(context.Background()); err != nil {
+		t.Fatalf("Got %v after slot released, want nil", err)
+	}
+}
+
+func TestSessionQueueContextCanceled(t *testing.T) {
+	q := newSessionQueue(sessionOptions{maxSessions: 1})
+
+	if _, _, err := q.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := q.acquire(ctx); err == nil {
+		t.Fatal("Got nil error, want context canceled")
+	}
+}
+
+func TestExtractSessionOptions(t *testing.T) {
+	m, err := metadata.FromBytes([]byte(`{
+  "extension": {
+    "sessionOptions": {
+      "maxSessions": 3,
+      "queueTimeout": "90s"
+    }
+  }
+}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := extractSessionOptions(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.maxSessions != 3 {
+		t.Errorf("Got maxSessions %d, want 3", opts.maxSessions)
+	}
+	if opts.queueTimeout != 90*time.Second {
+		t.Errorf("Got queueTimeout %v, want 90s", opts.queueTimeout)
+	}
+}
+
+func TestSessionSlotsPerEnvironment(t *testing.T) {
+	h := &WebDriverHub{
+		Diagnostics: diagnostics.NoOP(),
+		sessionOpts: sessionOptions{maxSessions: 1},
+	}
+	chrome, firefox := &stoppingEnv{}, &stoppingEnv{}
+
+	if _, err := h.waitForSessionSlot(context.Background(), chrome); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := h.waitForSessionSlot(ctx, firefox); err != nil {
+		t.Errorf("Got error %v waiting for a slot in another environment, want nil", err)
+	}
+	if _, err := h.waitForSessionSlot(ctx, chrome); err == nil {
+		t.Error("Got a second slot in a full environment, want error")
+	}
+}
+
+// slotCheckingEnv records whether its session slot was still held when StopSession was called.
+type slotCheckingEnv struct {
+	fakeEnv
+	q        *sessionQueue
+	heldStop bool
+}
+
+func (e *slotCheckingEnv) StopSession(context.Context, int) error {
+	e.q.mu.Lock()
+	e.heldStop = e.q.active == 1
+	e.q.mu.Unlock()
+	return nil
+}
+
+func TestQuitReleasesSlotAfterStopSession(t *testing.T) {
+	env := &slotCheckingEnv{}
+	h := &WebDriverHub{
+		Env:         env,
+		Diagnostics: diagnostics.NoOP(),
+		sessionOpts: sessionOptions{maxSessions: 1},
+		sessions:    map[string]*WebDriverSession{},
+	}
+	env.q = h.queueFor(env)
+
+	release, err := h.waitForSessionSlot(context.Background(), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &WebDriverSession{WebDriverHub: h, WebDriver: &fakeDriver{id: "s"}, Diagnostics: diagnostics.NoOP()}
+	s.holdSlot(release)
+
+	if err := s.quit(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if !env.heldStop {
+		t.Error("Got slot released before StopSession, want it held until the environment stopped the session")
+	}
+	if env.q.active != 0 {
+		t.Errorf("Got %d active slots after quit, want 0", env.q.active)
+	}
+}
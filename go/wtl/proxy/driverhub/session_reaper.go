@@ -0,0 +1,170 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
+)
+
+const (
+	// reapTimeout is how long quitting an idle session may take.
+	reapTimeout = 60 * time.Second
+	// maxReapedMessages is how many reaped sessions are remembered to explain why commands sent to
+	// them fail. Older ones get the usual invalid session id error.
+	maxReapedMessages = 100
+)
+
+var sessionsReaped = metrics.NewCounter("webtesting_sessions_reaped_total",
+	"Number of WebDriver sessions quit because they were idle for longer than the idle timeout.")
+
+// startReaper starts a goroutine that quits sessions that have not received a command for
+// longer than timeout. It runs until stopReaper is called.
+func (h *WebDriverHub) startReaper(timeout time.Duration) {
+	interval := timeout / 4
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+
+	h.reaperStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.reaperStop:
+				return
+			case now := <-ticker.C:
+				h.reapIdleSessions(now, timeout)
+			}
+		}
+	}()
+}
+
+// stopReaper stops the goroutine started by startReaper, if any.
+func (h *WebDriverHub) stopReaper() {
+	h.reaperOnce.Do(func() {
+		if h.reaperStop != nil {
+			close(h.reaperStop)
+		}
+	})
+}
+
+// reapIdleSessions quits every session that has not received a command since now - timeout and
+// that is not currently handling a command.
+func (h *WebDriverHub) reapIdleSessions(now time.Time, timeout time.Duration) {
+	for _, id := range h.GetActiveSessions() {
+		session := h.GetSession(id)
+		if session == nil {
+			continue
+		}
+		idle, ok := session.stopIfIdle(now, timeout)
+		if !ok {
+			continue
+		}
+
+		message := fmt.Sprintf("session %s was quit by WTL after being idle for %v (sessionOptions.idleTimeout is %v)",
+			id, idle.Round(time.Second), timeout)
+		h.Warning(errors.New(h.Name(), message))
+
+		h.mu.Lock()
+		if h.reaped == nil {
+			h.reaped = map[string]string{}
+		}
+		h.reaped[id] = message
+		h.reapedOrder = append(h.reapedOrder, id)
+		if len(h.reapedOrder) > maxReapedMessages {
+			delete(h.reaped, h.reapedOrder[0])
+			h.reapedOrder = h.reapedOrder[1:]
+		}
+		h.reapedCount++
+		h.mu.Unlock()
+
+		sessionsReaped.Inc()
+
+		ctx, cancel := context.WithTimeout(context.Background(), reapTimeout)
+		if err := session.quit(ctx, false); err != nil {
+			h.Warning(errors.New(h.Name(), fmt.Errorf("error quitting idle session %s: %v", id, err)))
+		}
+		cancel()
+	}
+}
+
+// reapedMessage returns an explanation of why session id no longer exists if it was reaped.
+func (h *WebDriverHub) reapedMessage(id string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	message, ok := h.reaped[id]
+	return message, ok
+}
+
+// stopIfIdle marks the session as stopped if it has not received a command since now - timeout
+// and is not currently handling a command. It returns how long the session was idle, and whether
+// it was stopped.
+func (s *WebDriverSession) stopIfIdle(now time.Time, timeout time.Duration) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped || s.activeCommands != 0 {
+		return 0, false
+	}
+	idle := now.Sub(s.lastActivity)
+	if idle < timeout {
+		return idle, false
+	}
+	s.stopped = true
+	return idle, true
+}
+
+// beginCommand records that the session is handling a command, which keeps it from being reaped
+// until endCommand is called. It returns false if the session has been stopped.
+func (s *WebDriverSession) beginCommand() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.activeCommands++
+	s.lastActivity = time.Now()
+	return true
+}
+
+// endCommand records that the session has finished handling a command started with beginCommand.
+func (s *WebDriverSession) endCommand() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeCommands--
+	s.lastActivity = time.Now()
+}
+
+// holdSession keeps the session that r is sent to from being reaped while r is paused by the
+// debugger, before and after it is handled by the session. The returned func releases the hold.
+func (h *WebDriverHub) holdSession(r *http.Request) func() {
+	id := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/wd/hub/session/"), "/", 2)[0]
+	if id == "" || id == r.URL.Path {
+		return func() {}
+	}
+	session := h.GetSession(id)
+	if session == nil || !session.beginCommand() {
+		return func() {}
+	}
+	return session.endCommand
+}
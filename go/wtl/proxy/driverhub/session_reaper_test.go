@@ -0,0 +1,162 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/webdriver"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/gorilla/mux"
+)
+
+type fakeDriver struct {
+	webdriver.WebDriver
+	id   string
+	quit bool
+}
+
+func (d *fakeDriver) SessionID() string {
+	return d.id
+}
+
+func (d *fakeDriver) Quit(context.Context) error {
+	d.quit = true
+	return nil
+}
+
+type stoppingEnv struct {
+	fakeEnv
+	stopped []int
+}
+
+func (e *stoppingEnv) StopSession(_ context.Context, id int) error {
+	e.stopped = append(e.stopped, id)
+	return nil
+}
+
+func TestReapIdleSessions(t *testing.T) {
+	env := &stoppingEnv{}
+	h := &WebDriverHub{
+		Env:         env,
+		Diagnostics: diagnostics.NoOP(),
+		sessions:    map[string]*WebDriverSession{},
+	}
+	now := time.Now()
+
+	drivers := map[string]*fakeDriver{}
+	addSession := func(sid string, id int, lastActivity time.Time, activeCommands int) {
+		drivers[sid] = &fakeDriver{id: sid}
+		h.sessions[sid] = &WebDriverSession{
+			ID:             id,
+			WebDriverHub:   h,
+			WebDriver:      drivers[sid],
+			lastActivity:   lastActivity,
+			activeCommands: activeCommands,
+		}
+	}
+	addSession("idle", 1, now.Add(-2*time.Minute), 0)
+	addSession("busy", 2, now.Add(-2*time.Minute), 1)
+	addSession("fresh", 3, now.Add(-time.Second), 0)
+
+	h.reapIdleSessions(now, time.Minute)
+
+	if h.GetSession("idle") != nil {
+		t.Error("Got idle session still active, want it reaped")
+	}
+	if !drivers["idle"].quit {
+		t.Error("Got idle session's browser still running, want it quit")
+	}
+	if len(env.stopped) != 1 || env.stopped[0] != 1 {
+		t.Errorf("Got StopSession calls for %v, want [1]", env.stopped)
+	}
+	for _, sid := range []string{"busy", "fresh"} {
+		if h.GetSession(sid) == nil || drivers[sid].quit {
+			t.Errorf("Got %s session reaped, want it left running", sid)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/wd/hub/session/idle/url", nil), map[string]string{"sessionID": "idle"})
+	h.routeToSession(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	resp := map[string]interface{}{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["error"] != "invalid session id" || !strings.Contains(resp["message"].(string), "idle for") {
+		t.Errorf("Got %v, want invalid session id error explaining the session was reaped", resp)
+	}
+}
+
+func TestHoldSessionWhilePaused(t *testing.T) {
+	env := &stoppingEnv{}
+	h := &WebDriverHub{
+		Env:         env,
+		Diagnostics: diagnostics.NoOP(),
+		sessions:    map[string]*WebDriverSession{},
+	}
+	h.sessions["paused"] = &WebDriverSession{
+		ID:           1,
+		WebDriverHub: h,
+		WebDriver:    &fakeDriver{id: "paused"},
+		lastActivity: time.Now().Add(-2 * time.Minute),
+	}
+
+	// A command held at a debugger breakpoint before it reaches the session.
+	release := h.holdSession(httptest.NewRequest(http.MethodGet, "/wd/hub/session/paused/url", nil))
+	h.reapIdleSessions(time.Now().Add(2*time.Minute), time.Minute)
+	if h.GetSession("paused") == nil {
+		t.Fatal("Got session with a paused command reaped, want it left running")
+	}
+
+	release()
+	h.reapIdleSessions(time.Now().Add(2*time.Minute), time.Minute)
+	if h.GetSession("paused") != nil {
+		t.Error("Got idle session still active after the paused command finished, want it reaped")
+	}
+}
+
+func TestReapedMessagesAreBounded(t *testing.T) {
+	h := &WebDriverHub{
+		Env:         &stoppingEnv{},
+		Diagnostics: diagnostics.NoOP(),
+		sessions:    map[string]*WebDriverSession{},
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	for i := 0; i < maxReapedMessages+10; i++ {
+		sid := fmt.Sprintf("s%d", i)
+		h.sessions[sid] = &WebDriverSession{ID: i, WebDriverHub: h, WebDriver: &fakeDriver{id: sid}, lastActivity: old}
+	}
+
+	h.reapIdleSessions(time.Now(), time.Minute)
+
+	if len(h.reaped) != maxReapedMessages {
+		t.Errorf("Got %d reaped messages, want %d", len(h.reaped), maxReapedMessages)
+	}
+	if h.reapedCount != maxReapedMessages+10 {
+		t.Errorf("Got reaped count %d, want %d", h.reapedCount, maxReapedMessages+10)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/websocket"
+	"github.com/gorilla/mux"
+)
+
+// webSocketCapabilities maps capabilities whose values are WebSocket URLs on the remote end to
+// the protocol name WTL proxies them under, at /wd/hub/session/{sessionID}/se/{protocol} as on
+// Selenium Grid.
+var webSocketCapabilities = map[string]string{
+	"webSocketUrl": "bidi",
+	"se:cdp":       "cdp",
+}
+
+func isWebSocketUpgrade(r *http.Request, _ *mux.RouteMatch) bool {
+	return websocket.IsUpgrade(r)
+}
+
+// proxyWebSockets returns a copy of caps in which WebSocket URLs on the remote end are replaced
+// by URLs on the WTL listener that r was received on, and remembers the original URLs so that
+// connections to the replacements can be forwarded to them.
+func (s *WebDriverSession) proxyWebSockets(caps map[string]interface{}, r *http.Request) map[string]interface{} {
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+
+	proxied := map[string]interface{}{}
+	for k, v := range caps {
+		proxied[k] = v
+	}
+	targets := map[string]*url.URL{}
+
+	for name, protocol := range webSocketCapabilities {
+		str, ok := caps[name].(string)
+		if !ok {
+			continue
+		}
+		target, err := url.Parse(str)
+		if err != nil || (target.Scheme != "ws" && target.Scheme != "wss") {
+			continue
+		}
+		targets[protocol] = target
+		proxied[name] = (&url.URL{
+			Scheme: scheme,
+			Host:   r.Host,
+			Path:   path.Join(s.sessionPath, "se", protocol),
+		}).String()
+	}
+
+	s.mu.Lock()
+	s.webSockets = targets
+	s.mu.Unlock()
+	return proxied
+}
+
+// forwardWebSocket forwards a WebSocket connection to the remote end. The session is considered
+// active for as long as the connection is open. The connection is closed by closeWebSockets.
+func (s *WebDriverSession) forwardWebSocket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	protocol := vars["protocol"]
+
+	if !s.beginCommand() {
+		s.stoppedSession(w, vars["sessionID"])
+		return
+	}
+	defer s.endCommand()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	s.mu.Lock()
+	target, ok := s.webSockets[protocol]
+	id := s.nextWebSocket
+	if ok {
+		s.nextWebSocket++
+		if s.webSocketClosers == nil {
+			s.webSocketClosers = map[int]context.CancelFunc{}
+		}
+		s.webSocketClosers[id] = cancel
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		unknownCommand(w, r)
+		return
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.webSocketClosers, id)
+		s.mu.Unlock()
+	}()
+
+	if err := websocket.Forward(ctx, target, w, r); err != nil {
+		s.Warning(errors.New(s.Name(), fmt.Errorf("error forwarding %s WebSocket to %s: %v", protocol, target, err)))
+	}
+}
+
+// closeWebSockets closes the session's forwarded WebSocket connections. The HTTP servers do not
+// close connections that have been hijacked, so this must be called when the hub shuts down.
+func (s *WebDriverSession) closeWebSockets() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, closeConn := range s.webSocketClosers {
+		closeConn()
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driverhub
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/websocket"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+	"github.com/gorilla/mux"
+)
+
+func TestProxyWebSockets(t *testing.T) {
+	caps := map[string]interface{}{
+		"browserName":  "chrome",
+		"webSocketUrl": "ws://127.0.0.1:9515/session/abc",
+		"se:cdp":       "ws://localhost:9222/devtools/browser/xyz",
+	}
+
+	for _, tc := range []struct {
+		tls        bool
+		wantScheme string
+	}{
+		{false, "ws"},
+		{true, "wss"},
+	} {
+		s := &WebDriverSession{sessionPath: "/wd/hub/session/abc"}
+		r := httptest.NewRequest(http.MethodPost, "/wd/hub/session", nil)
+		r.Host = "wtl.example.com:8080"
+		if tc.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+
+		proxied := s.proxyWebSockets(caps, r)
+
+		want := map[string]string{
+			"webSocketUrl": tc.wantScheme + "://wtl.example.com:8080/wd/hub/session/abc/se/bidi",
+			"se:cdp":       tc.wantScheme + "://wtl.example.com:8080/wd/hub/session/abc/se/cdp",
+			"browserName":  "chrome",
+		}
+		for k, v := range want {
+			if proxied[k] != v {
+				t.Errorf("Got %s %v, want %s", k, proxied[k], v)
+			}
+		}
+		if caps["webSocketUrl"] != "ws://127.0.0.1:9515/session/abc" {
+			t.Errorf("Got original webSocketUrl %v, want it unchanged", caps["webSocketUrl"])
+		}
+		if got := s.webSockets["cdp"].String(); got != "ws://localhost:9222/devtools/browser/xyz" {
+			t.Errorf("Got cdp target %q, want remote end URL", got)
+		}
+	}
+}
+
+// newWebSocketSession returns a session whose BiDi WebSocket is forwarded to backendURL, and a
+// server for the hub that the session belongs to.
+func newWebSocketSession(t *testing.T, backendURL string) (*WebDriverSession, *httptest.Server) {
+	t.Helper()
+	h := &WebDriverHub{
+		Router:      mux.NewRouter(),
+		Diagnostics: diagnostics.NoOP(),
+		sessions:    map[string]*WebDriverSession{},
+	}
+	h.Path("/wd/hub/session/{sessionID}/se/{protocol}").MatcherFunc(isWebSocketUpgrade).HandlerFunc(h.routeWebSocketToSession)
+	s := &WebDriverSession{
+		Diagnostics:  diagnostics.NoOP(),
+		WebDriverHub: h,
+		WebDriver:    &fakeDriver{id: "abc"},
+		sessionPath:  "/wd/hub/session/abc",
+	}
+	h.sessions["abc"] = s
+
+	r := httptest.NewRequest(http.MethodPost, "/wd/hub/session", nil)
+	s.proxyWebSockets(map[string]interface{}{
+		"webSocketUrl": strings.Replace(backendURL, "http://", "ws://", 1) + "/session/abc",
+	}, r)
+
+	return s, httptest.NewServer(h)
+}
+
+// dialBiDi opens the BiDi WebSocket of session abc on front, returning the response to the
+// upgrade request and, if it was accepted, the connection.
+func dialBiDi(t *testing.T, front *httptest.Server) (*http.Response, *websocket.Conn) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET /wd/hub/session/abc/se/bidi HTTP/1.1\r\nHost: wtl\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return resp, nil
+	}
+	return resp, websocket.NewClientConn(conn, br)
+}
+
+func TestForwardWebSocket(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(msgType, append([]byte(r.URL.Path+": "), msg...))
+	}))
+	defer backend.Close()
+
+	_, front := newWebSocketSession(t, backend.URL)
+	defer front.Close()
+
+	resp, client := dialBiDi(t, front)
+	if client == nil {
+		t.Fatalf("Got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	defer client.Close()
+	if err := client.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/session/abc: hello"; string(got) != want {
+		t.Errorf("Got message %q, want %q", got, want)
+	}
+}
+
+func TestCloseWebSockets(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+
+	s, front := newWebSocketSession(t, backend.URL)
+	defer front.Close()
+
+	resp, client := dialBiDi(t, front)
+	if client == nil {
+		t.Fatalf("Got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	defer client.Close()
+
+	for {
+		s.mu.RLock()
+		open := len(s.webSocketClosers)
+		s.mu.RUnlock()
+		if open == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.closeWebSockets()
+
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Error("Got nil error reading from a closed WebSocket, want error")
+	}
+}
+
+func TestForwardWebSocketReapedSession(t *testing.T) {
+	s, front := newWebSocketSession(t, "http://127.0.0.1:1")
+	defer front.Close()
+	s.stopped = true
+	s.WebDriverHub.reaped = map[string]string{"abc": "session abc was deleted after being idle"}
+
+	resp, client := dialBiDi(t, front)
+	if client != nil {
+		client.Close()
+		t.Fatal("Got WebSocket connection to a reaped session, want error")
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "deleted after being idle") {
+		t.Errorf("Got body %q, want the reason the session was reaped", body)
+	}
+}
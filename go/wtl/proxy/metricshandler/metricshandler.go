@@ -0,0 +1,46 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metricshandler provides an HTTPHandler that exports WTL metrics in the Prometheus
+// text exposition format.
+package metricshandler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy"
+)
+
+type metricsHandler struct {
+	http.Handler
+}
+
+// HTTPHandlerProvider returns a HTTPHandlerProvider for handling metrics requests.
+func HTTPHandlerProvider(*proxy.Proxy) (proxy.HTTPHandler, error) {
+	return &metricsHandler{metrics.Handler()}, nil
+}
+
+func (*metricsHandler) Shutdown(context.Context) error {
+	return nil
+}
+
+func (*metricsHandler) Name() string {
+	return "metrics http handler"
+}
+
+func (*metricsHandler) Healthy(context.Context) error {
+	return nil
+}
@@ -17,12 +17,17 @@
 package proxy
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bazelbuild/rules_webtesting/go/errors"
@@ -31,6 +36,7 @@ import (
 	"github.com/bazelbuild/rules_webtesting/go/metadata"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/accesslog"
 )
 
 const (
@@ -71,11 +77,25 @@ type Proxy struct {
 	HTTPAddress  string
 	HTTPSAddress string
 	handlers     []HTTPHandler
+	routes       map[string]HTTPHandler
 	httpSrv      *http.Server
 	httpsSrv     *http.Server
 	httpPort     int
 	httpsPort    int
 	certs        *certs
+	accessLog    *accesslog.Log
+	draining     int32
+
+	mu       sync.Mutex
+	nextReq  uint64
+	inFlight map[uint64]inFlightRequest
+}
+
+// inFlightRequest describes a request that the proxy is still handling.
+type inFlightRequest struct {
+	method string
+	path   string
+	start  time.Time
 }
 
 // New creates a new Proxy object.
@@ -104,6 +124,8 @@ func New(env environment.Env, m *metadata.Metadata, d diagnostics.Diagnostics, h
 		httpPort:     httpPort,
 		httpsPort:    httpsPort,
 		certs:        certs,
+		routes:       map[string]HTTPHandler{},
+		inFlight:     map[uint64]inFlightRequest{},
 	}
 
 	mux := http.NewServeMux()
@@ -114,18 +136,30 @@ func New(env environment.Env, m *metadata.Metadata, d diagnostics.Diagnostics, h
 			return nil, err
 		}
 		p.handlers = append(p.handlers, h)
+		p.routes[route] = h
 		mux.Handle(route, h)
 	}
 
+	handler := p.track(mux)
+
+	accessLog, err := accesslog.New(m, d)
+	if err != nil {
+		return nil, err
+	}
+	if accessLog != nil {
+		p.accessLog = accessLog
+		handler = accessLog.Wrap(handler)
+	}
+
 	p.httpSrv = &http.Server{
 		Addr:    ":" + strconv.Itoa(p.httpPort),
-		Handler: mux,
+		Handler: handler,
 	}
 
 	if p.certs != nil {
 		p.httpsSrv = &http.Server{
 			Addr:    ":" + strconv.Itoa(p.httpsPort),
-			Handler: mux,
+			Handler: handler,
 		}
 	}
 
@@ -150,6 +184,15 @@ func (*Proxy) Name() string {
 	return compName
 }
 
+// HTTPHandlers returns the handlers installed in this proxy, keyed by route.
+func (p *Proxy) HTTPHandlers() map[string]HTTPHandler {
+	routes := map[string]HTTPHandler{}
+	for route, h := range p.routes {
+		routes[route] = h
+	}
+	return routes
+}
+
 // Start configures the proxy with handlers, starts its listen loop, and waits for it to respond to a health check.
 func (p *Proxy) Start(ctx context.Context) error {
 	start := time.Now()
@@ -161,15 +204,17 @@ func (p *Proxy) Start(ctx context.Context) error {
 
 	go func() {
 		log.Printf("launching HTTP server at: %v", p.HTTPAddress)
-		err := errors.New(p.Name(), p.httpSrv.ListenAndServe())
-		p.Diagnostics.Severe(err)
+		if err := p.httpSrv.ListenAndServe(); err != http.ErrServerClosed {
+			p.Diagnostics.Severe(errors.New(p.Name(), err))
+		}
 	}()
 
 	if p.httpsSrv != nil {
 		go func() {
 			log.Printf("launching HTTPS server at: %v", p.HTTPSAddress)
-			err := errors.New(p.Name(), p.httpsSrv.ListenAndServeTLS(p.certs.certFile, p.certs.keyFile))
-			p.Diagnostics.Severe(err)
+			if err := p.httpsSrv.ListenAndServeTLS(p.certs.certFile, p.certs.keyFile); err != http.ErrServerClosed {
+				p.Diagnostics.Severe(errors.New(p.Name(), err))
+			}
 		}()
 	}
 
@@ -223,13 +268,126 @@ func (p *Proxy) httpsHealthy(ctx context.Context) error {
 	return nil
 }
 
-// Shutdown calls Shutdown on all handlers, then shuts the HTTP server down.
+// Draining returns true once the proxy has begun shutting down. Handlers should not start new
+// long-lived work, such as new sessions, while the proxy is draining.
+func (p *Proxy) Draining() bool {
+	return atomic.LoadInt32(&p.draining) != 0
+}
+
+// track wraps h to keep track of the requests that are currently being handled. A request stops
+// being tracked once its connection is hijacked, e.g. for a WebSocket, as the HTTP servers no
+// longer manage the connection; the handler that hijacked it is responsible for closing it.
+func (p *Proxy) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.nextReq++
+		id := p.nextReq
+		p.inFlight[id] = inFlightRequest{method: r.Method, path: r.URL.Path, start: time.Now()}
+		p.mu.Unlock()
+
+		untrack := func() {
+			p.mu.Lock()
+			delete(p.inFlight, id)
+			p.mu.Unlock()
+		}
+		defer untrack()
+
+		h.ServeHTTP(&trackingWriter{ResponseWriter: w, hijacked: untrack}, r)
+	})
+}
+
+// trackingWriter calls hijacked when the connection is hijacked. It passes through Flush so that
+// streaming responses continue to work.
+type trackingWriter struct {
+	http.ResponseWriter
+	hijacked func()
+}
+
+func (t *trackingWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New(compName, "response writer does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err == nil {
+		t.hijacked()
+	}
+	return conn, brw, err
+}
+
+// inFlightRequests returns descriptions of the requests currently being handled, oldest first.
+func (p *Proxy) inFlightRequests() []string {
+	p.mu.Lock()
+	var reqs []inFlightRequest
+	for _, r := range p.inFlight {
+		reqs = append(reqs, r)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].start.Before(reqs[j].start) })
+
+	var descs []string
+	for _, r := range reqs {
+		descs = append(descs, fmt.Sprintf("%s %s (running for %v)", r.method, r.path, time.Since(r.start).Round(time.Millisecond)))
+	}
+	return descs
+}
+
+// Shutdown stops accepting new sessions, and waits for in-flight requests to finish for up to half
+// of the time remaining before ctx's deadline. It then stops the HTTP servers, reporting any
+// requests that were cut off, and calls Shutdown on all handlers.
 func (p *Proxy) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&p.draining, 1)
+
+	drainCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
+		defer cancel()
+	}
+
+	servers := []*http.Server{p.httpSrv}
+	if p.httpsSrv != nil {
+		servers = append(servers, p.httpsSrv)
+	}
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(drainCtx); err != nil && err != context.DeadlineExceeded && err != context.Canceled {
+				p.Diagnostics.Warning(errors.New(p.Name(), err))
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	if cutOff := p.inFlightRequests(); len(cutOff) != 0 {
+		p.Diagnostics.Warning(errors.New(p.Name(), fmt.Errorf("%d request(s) still in flight at shutdown were cut off: %s", len(cutOff), strings.Join(cutOff, "; "))))
+	}
+	for _, srv := range servers {
+		if err := srv.Close(); err != nil {
+			p.Diagnostics.Warning(errors.New(p.Name(), err))
+		}
+	}
+
 	for _, handler := range p.handlers {
 		if err := handler.Shutdown(ctx); err != nil {
 			p.Diagnostics.Warning(err)
 		}
 	}
-	// TODO(DrMarcII) figure out why Shutdown doesn't work.
+
+	if p.accessLog != nil {
+		if err := p.accessLog.Close(); err != nil {
+			p.Diagnostics.Warning(err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,202 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+	"github.com/bazelbuild/rules_webtesting/go/portpicker"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+// slowHandler handles each request by sleeping for the duration in its delay query parameter.
+type slowHandler struct{}
+
+func (slowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+	time.Sleep(d)
+	w.Write([]byte("done"))
+}
+
+func (slowHandler) Name() string                   { return "slow" }
+func (slowHandler) Healthy(context.Context) error  { return nil }
+func (slowHandler) Shutdown(context.Context) error { return nil }
+
+func startProxy(t *testing.T) (*Proxy, *diagnostics.Recorder) {
+	t.Helper()
+	AddHTTPHandlerProvider("/slow", func(*Proxy) (HTTPHandler, error) {
+		return slowHandler{}, nil
+	})
+
+	port, err := portpicker.PickUnusedPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := diagnostics.NewRecorder()
+	p, err := New(nil, &metadata.Metadata{}, d, port, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.httpSrv.ListenAndServe()
+
+	url := fmt.Sprintf("http://localhost:%d/slow", port)
+	for i := 0; ; i++ {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return p, d
+}
+
+func waitForInFlight(t *testing.T, p *Proxy) {
+	t.Helper()
+	for i := 0; len(p.inFlightRequests()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("request never became in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	p, d := startProxy(t)
+
+	result := make(chan error)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/slow?delay=200ms", p.httpPort))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("got status %d", resp.StatusCode)
+			}
+		}
+		result <- err
+	}()
+	waitForInFlight(t, p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Draining() {
+		t.Error("Got Draining() false after Shutdown, want true")
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Got error %v for in-flight request, want it to complete", err)
+	}
+	if w := d.Warnings(); len(w) != 0 {
+		t.Errorf("Got warnings %v, want none", w)
+	}
+	if _, err := http.Get(fmt.Sprintf("http://localhost:%d/slow", p.httpPort)); err == nil {
+		t.Error("Got nil error for request after Shutdown, want error")
+	}
+}
+
+func TestShutdownReportsCutOffRequests(t *testing.T) {
+	p, d := startProxy(t)
+
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/slow?delay=5s", p.httpPort))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	waitForInFlight(t, p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v, want it bounded by its context", elapsed)
+	}
+
+	w := d.Warnings()
+	if len(w) != 1 || !strings.Contains(w[0].Error(), "GET /slow") {
+		t.Errorf("Got warnings %v, want one reporting GET /slow was cut off", w)
+	}
+}
+
+// hijackHandler hijacks each connection and keeps it open until the handler is shut down.
+type hijackHandler struct {
+	closed chan struct{}
+}
+
+func (h hijackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+	<-h.closed
+	conn.Close()
+}
+
+func (hijackHandler) Name() string                  { return "hijack" }
+func (hijackHandler) Healthy(context.Context) error { return nil }
+func (h hijackHandler) Shutdown(context.Context) error {
+	close(h.closed)
+	return nil
+}
+
+func TestShutdownIgnoresHijackedConnections(t *testing.T) {
+	h := hijackHandler{closed: make(chan struct{})}
+	AddHTTPHandlerProvider("/hijack", func(*Proxy) (HTTPHandler, error) {
+		return h, nil
+	})
+	p, d := startProxy(t)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", p.httpPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /hijack HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := p.inFlightRequests(); len(reqs) != 0 {
+		t.Errorf("Got in-flight requests %v after the connection was hijacked, want none", reqs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if w := d.Warnings(); len(w) != 0 {
+		t.Errorf("Got warnings %v, want none for a hijacked connection", w)
+	}
+}
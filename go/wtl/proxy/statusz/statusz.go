@@ -0,0 +1,136 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statusz provides an HTTPHandler that renders the status of the WebDriver hub
+// and its sessions as an HTML page.
+package statusz
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/httphelper"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+var page = template.Must(template.New("statusz").Funcs(template.FuncMap{"json": toJSON}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Web Test Launcher Status</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.healthy { color: green; }
+.unhealthy { color: red; }
+pre { margin: 0; }
+</style>
+</head>
+<body>
+<h1>Web Test Launcher Status</h1>
+<p>Rendered at {{.Now.Format "15:04:05.000"}}.</p>
+{{if .Hub}}
+{{with .Status}}
+<h2 class="{{if .Ready}}healthy{{else}}unhealthy{{end}}">{{.Message}}</h2>
+<h3>Environment</h3>
+<table>
+<tr><th>Name</th><th>Healthy</th><th>Error</th></tr>
+<tr><td>{{.Environment.Name}}</td><td class="{{if .Environment.Healthy}}healthy{{else}}unhealthy{{end}}">{{.Environment.Healthy}}</td><td>{{.Environment.Error}}</td></tr>
+</table>
+<h3>Session pool</h3>
+<table>
+<tr><th>Active</th><th>Reusable</th><th>Queued</th><th>Reaped</th><th>Max sessions</th></tr>
+<tr><td>{{.Pool.Active}}</td><td>{{.Pool.Reusable}}</td><td>{{.Pool.Queued}}</td><td>{{.Pool.Reaped}}</td><td>{{if .Pool.MaxSessions}}{{.Pool.MaxSessions}}{{else}}unlimited{{end}}</td></tr>
+</table>
+<h3>Handlers</h3>
+<table>
+<tr><th>Name</th><th>Healthy</th><th>Error</th></tr>
+{{range .Handlers}}<tr><td>{{.Name}}</td><td class="{{if .Healthy}}healthy{{else}}unhealthy{{end}}">{{.Healthy}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}
+<h3>Sessions</h3>
+{{if .Sessions}}
+<table>
+<tr><th>Session ID</th><th>State</th><th>Environment</th><th>Age</th><th>Requested capabilities</th></tr>
+{{range .Sessions}}<tr><td>{{.SessionID}}</td><td>{{.State}}</td><td>{{.Environment}}</td><td>{{printf "%.1fs" .Age}}</td><td><pre>{{json .RequestedCapabilities}}</pre></td></tr>
+{{end}}</table>
+{{else}}
+<p>No sessions.</p>
+{{end}}
+{{else}}
+<p class="unhealthy">No WebDriver hub is installed in this proxy.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func toJSON(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+type statusz struct {
+	proxy *proxy.Proxy
+}
+
+type pageData struct {
+	Now      time.Time
+	Hub      bool
+	Status   driverhub.Status
+	Sessions []driverhub.SessionInfo
+}
+
+// HTTPHandlerProvider returns a HTTPHandlerProvider for rendering the status page.
+func HTTPHandlerProvider(p *proxy.Proxy) (proxy.HTTPHandler, error) {
+	return &statusz{proxy: p}, nil
+}
+
+func (s *statusz) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := pageData{Now: time.Now()}
+	if hub := driverhub.FromProxy(s.proxy); hub != nil {
+		data.Hub = true
+		data.Status = hub.Status(r.Context())
+		data.Sessions = hub.SessionInfos()
+	}
+
+	writePage(w, data)
+}
+
+func writePage(w http.ResponseWriter, data pageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	httphelper.SetDefaultResponseHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+	page.Execute(w, data)
+}
+
+func (*statusz) Shutdown(context.Context) error {
+	return nil
+}
+
+func (*statusz) Name() string {
+	return "statusz http handler"
+}
+
+func (*statusz) Healthy(context.Context) error {
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusz
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+)
+
+func TestWritePage(t *testing.T) {
+	now := time.Now()
+	data := pageData{
+		Now: now,
+		Hub: true,
+		Status: driverhub.Status{
+			Message:     "all session slots are in use",
+			Environment: driverhub.ComponentStatus{Name: "fake env", Healthy: true},
+			Pool:        driverhub.PoolStatus{Active: 1, Reusable: 1, Queued: 2, MaxSessions: 2, Reaped: 3},
+			Handlers:    []driverhub.ComponentStatus{{Name: "WebDriver Hub", Healthy: false, Error: "debugger is not connected"}},
+		},
+		Sessions: []driverhub.SessionInfo{
+			{SessionID: "abc", State: "active", Environment: "fake env", Created: now, Age: 1.5,
+				RequestedCapabilities: map[string]interface{}{"alwaysMatch": map[string]interface{}{"browserName": "chrome"}}},
+			{SessionID: "def", State: "reusable", Environment: "fake env", Created: now},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	writePage(w, data)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Got Content-Type %q, want text/html", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<h2 class="unhealthy">all session slots are in use</h2>`,
+		`<tr><td>1</td><td>1</td><td>2</td><td>3</td><td>2</td></tr>`,
+		`<td>debugger is not connected</td>`,
+		`<tr><td>abc</td><td>active</td><td>fake env</td><td>1.5s</td>`,
+		`&#34;browserName&#34;: &#34;chrome&#34;`,
+		`<tr><td>def</td><td>reusable</td>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Got page without %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestWritePageWithoutHub(t *testing.T) {
+	w := httptest.NewRecorder()
+	writePage(w, pageData{Now: time.Now()})
+
+	if body := w.Body.String(); !strings.Contains(body, "No WebDriver hub is installed") {
+		t.Errorf("Got page %q, want it to say there is no hub", body)
+	}
+}
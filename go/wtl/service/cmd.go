@@ -25,6 +25,7 @@ import (
 
 	"github.com/bazelbuild/rules_webtesting/go/cmdhelper"
 	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/metrics"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
 )
 
@@ -69,6 +70,7 @@ func (c *Cmd) Start(ctx context.Context) error {
 	if err := c.cmd.Start(); err != nil {
 		return errors.New(c.Name(), err)
 	}
+	metrics.DriverStarts.Inc(c.Name())
 
 	go c.Monitor()
 	return nil
@@ -135,6 +137,7 @@ func (c *Cmd) Monitor() {
 	if signal == syscall.SIGKILL || signal == syscall.SIGTERM || exitCode == 0x80|0x09 || exitCode == 0x80|0x0f {
 		return
 	}
+	metrics.DriverCrashes.Inc(c.Name())
 	c.Warning(errors.New(c.Name(), fmt.Errorf("exited prematurely with status: %v", err)))
 }
 
@@ -13,25 +13,63 @@
 // limitations under the License.
 
 // Package sauce provides a Service for managing Sauce Connect.
+//
+// Sauce Connect is started with the Sauce Connect binary referenced by Web Test File SAUCE_CONNECT,
+// and is considered ready when it logs that it is up or, if statusServer is true, when its status
+// server reports that it is ready. The status server needs a Sauce Connect that supports
+// --status-address. Each run of the binary writes its log to sauce-connect-<n>.log in the test
+// outputs directory. If Sauce Connect exits while it is in use it is restarted with exponential
+// backoff; the backoff and restart count are reset once a run has stayed up for a while.
+// This is configured by the connect section of the sauceOptions section of a Metadata.Extension
+// field:
+//
+//	"sauceOptions": {
+//	  "connect": {
+//	    "startTimeout": "2m",
+//	    "maxRestarts": 3,
+//	    "restartBackoff": "1s",
+//	    "statusServer": true,
+//	    "logDir": "/tmp/sc-logs"
+//	  }
+//	}
 package sauce
 
 import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/bazelbuild/rules_webtesting/go/bazel"
 	"github.com/bazelbuild/rules_webtesting/go/errors"
 	"github.com/bazelbuild/rules_webtesting/go/metadata"
 	"github.com/bazelbuild/rules_webtesting/go/portpicker"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
 )
 
 const (
 	compName    = "Sauce Connect Service"
 	scNamedFile = "SAUCE_CONNECT"
+	// readyMarker is logged by Sauce Connect when the tunnel is ready for use.
+	readyMarker = "Sauce Connect is up, you may start your tests"
+	// pollInterval is how often the status server is polled while waiting for Sauce Connect to
+	// become ready.
+	pollInterval = 100 * time.Millisecond
+	// maxBackoff is the longest time waited before restarting Sauce Connect.
+	maxBackoff = 30 * time.Second
+	// defaultStableRun is how long Sauce Connect must stay up after becoming ready for its restart
+	// backoff and restart count to be reset.
+	defaultStableRun = time.Minute
 )
 
 // Connect is a service that manages Sauce Connect.
@@ -39,108 +77,370 @@ type Connect struct {
 	// Address is the address that the Sauce Connect Selenium relay is running on.
 	Address string
 
-	cmd *exec.Cmd
+	diagnostics.Diagnostics
+	exe        string
+	args       []string
+	port       int
+	statusPort int
+	statusURL  string
+	opts       options
+	client     *http.Client
+	stableRun  time.Duration
+
+	mu        sync.Mutex
+	started   bool
+	stopped   bool
+	attempts  int
+	proc      *process
+	readyProc *process
+	viaStatus bool
+	err       error
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
 
-	mu    sync.Mutex
-	ready bool
-	err   error
-	port  int
+// process is a single run of the Sauce Connect binary.
+type process struct {
+	cmd   *exec.Cmd
+	ready chan struct{} // closed when the ready marker is logged.
+	done  chan struct{} // closed when the process exits.
+	err   error         // the result of cmd.Wait, valid once done is closed.
 }
 
 // New creates a new service that manages Sauce Connect.
-func New(m *metadata.Metadata, username, accessKey, tunnelID string) (*Connect, error) {
+func New(m *metadata.Metadata, d diagnostics.Diagnostics, username, accessKey, tunnelID string) (*Connect, error) {
+	opts, err := extractOptions(m)
+	if err != nil {
+		return nil, errors.New(compName, err)
+	}
+
 	scPath, err := m.GetFilePath(scNamedFile)
 	if err != nil {
 		return nil, errors.New(compName, err)
 	}
 
+	return newConnect(d, scPath, opts, username, accessKey, tunnelID)
+}
+
+func newConnect(d diagnostics.Diagnostics, exe string, opts options, username, accessKey, tunnelID string) (*Connect, error) {
 	port, err := portpicker.PickUnusedPort()
 	if err != nil {
 		return nil, errors.New(compName, err)
 	}
-
-	cmd := exec.Command(
-		scPath,
+	args := []string{
 		"--user", username,
 		"--api-key", accessKey,
 		"--tunnel-identifier", tunnelID,
-		"--se-port", strconv.Itoa(port))
+		"--se-port", strconv.Itoa(port),
+	}
+
+	statusPort, statusURL := 0, ""
+	if opts.statusServer {
+		statusPort, err = portpicker.PickUnusedPort()
+		if err != nil {
+			return nil, errors.New(compName, err)
+		}
+		statusAddress := net.JoinHostPort("localhost", strconv.Itoa(statusPort))
+		args = append(args, "--status-address", statusAddress)
+		statusURL = fmt.Sprintf("http://%s/readiness", statusAddress)
+	}
+
+	if opts.logDir == "" {
+		opts.logDir = bazel.TestUndeclaredOutputsDir()
+	}
 
 	return &Connect{
-		cmd:     cmd,
-		port:    port,
-		Address: fmt.Sprintf("http://%s:%s@localhost:%d/wd/hub/", username, accessKey, port),
+		Address:     fmt.Sprintf("http://%s:%s@localhost:%d/wd/hub/", username, accessKey, port),
+		Diagnostics: d,
+		exe:         exe,
+		args:        args,
+		port:        port,
+		statusPort:  statusPort,
+		statusURL:   statusURL,
+		opts:        opts,
+		client:      &http.Client{Timeout: time.Second},
+		stableRun:   defaultStableRun,
 	}, nil
 }
 
-// Start starts Sauce Connect and waits for it to be ready for use.
-func (c *Connect) Start(_ context.Context) error {
+// Start starts Sauce Connect, waits for it to be ready for use, and restarts it if it exits before
+// Stop is called.
+func (c *Connect) Start(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	stdout, err := c.cmd.StdoutPipe()
-	if err != nil {
-		return err
+	if c.started {
+		c.mu.Unlock()
+		return errors.NewPermanent(c.Name(), "cannot be started; it has already been started once")
 	}
+	c.started = true
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.mu.Unlock()
 
-	if err := c.cmd.Start(); err != nil {
-		return err
+	if err := os.MkdirAll(c.opts.logDir, 0755); err != nil {
+		return errors.New(c.Name(), err)
 	}
 
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), "Sauce Connect is up, you may start your tests") {
-			c.ready = true
-			go c.monitor()
-			return nil
-		}
+	p, err := c.launch(ctx)
+	if err != nil {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		return err
 	}
 
-	return errors.New(c.Name(), "terminated without becoming healthy")
+	go c.supervise(p)
+	return nil
 }
 
 // Stop stops a running Sauce Connect.
-func (c *Connect) Stop(_ context.Context) error {
+func (c *Connect) Stop(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if !c.ready || c.err != nil {
+	if !c.started || c.stopped {
+		c.mu.Unlock()
 		return nil
 	}
-	c.ready = false
+	c.stopped = true
+	c.cancel()
+	p := c.proc
+	c.mu.Unlock()
 
-	if c.cmd.Process != nil {
-		c.err = c.cmd.Process.Kill()
+	if p != nil {
+		p.kill()
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return errors.New(c.Name(), fmt.Errorf("did not exit: %v", ctx.Err()))
+		}
+	}
+
+	portpicker.RecycleUnusedPort(c.port)
+	if c.statusPort != 0 {
+		portpicker.RecycleUnusedPort(c.statusPort)
 	}
 	return nil
 }
 
 // Healthy returns nil if Sauce Connect is running and ready for use, otherwise it returns an error.
-func (c *Connect) Healthy(_ context.Context) error {
+func (c *Connect) Healthy(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	err, started, stopped, p, viaStatus := c.err, c.started, c.stopped, c.proc, c.viaStatus
+	ready := p != nil && p == c.readyProc
+	c.mu.Unlock()
 
-	if c.err != nil {
-		return c.err
+	if err != nil {
+		return err
 	}
-
-	if !c.ready {
+	if !started || p == nil {
 		return errors.New(c.Name(), "has not been started")
 	}
+	if stopped {
+		return errors.NewPermanent(c.Name(), "has been stopped")
+	}
 
+	select {
+	case <-p.done:
+		return errors.New(c.Name(), fmt.Errorf("tunnel is down (exited with %v); restarting", p.err))
+	default:
+	}
+	if !ready {
+		return errors.New(c.Name(), "tunnel is starting")
+	}
+
+	if viaStatus && !c.statusReady(ctx) {
+		return errors.New(c.Name(), fmt.Sprintf("status server at %s does not report the tunnel as ready", c.statusURL))
+	}
 	return nil
 }
 
-func (c *Connect) monitor() {
-	err := c.cmd.Wait()
+// launch runs Sauce Connect and waits until it is ready. The returned process has exited if err
+// is not nil.
+func (c *Connect) launch(ctx context.Context) (*process, error) {
+	c.mu.Lock()
+	attempt := c.attempts
+	c.attempts++
+	c.mu.Unlock()
+
+	logFile := filepath.Join(c.opts.logDir, fmt.Sprintf("sauce-connect-%d.log", attempt))
+	cmd := exec.Command(c.exe, append(append([]string{}, c.args...), "--logfile", logFile)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return exited(err), errors.New(c.Name(), err)
+	}
+	if err := cmd.Start(); err != nil {
+		return exited(err), errors.New(c.Name(), err)
+	}
+
+	p := &process{
+		cmd:   cmd,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go p.watch(stdout)
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.ready && c.err == nil {
-		c.ready = false
-		c.err = err
+	stopped := c.stopped
+	if !stopped {
+		c.proc = p
+	}
+	c.mu.Unlock()
+	if stopped {
+		p.kill()
+		<-p.done
+		return p, errors.New(c.Name(), "was stopped while starting")
 	}
 
-	portpicker.RecycleUnusedPort(c.port)
+	if err := c.waitReady(ctx, p); err != nil {
+		return p, err
+	}
+	c.mu.Lock()
+	c.readyProc = p
+	c.mu.Unlock()
+	return p, nil
+}
+
+// waitReady waits for p to log the ready marker or for the status server, if any, to report that
+// the tunnel is ready. If p does not become ready within the start timeout it is killed.
+func (c *Connect) waitReady(ctx context.Context, p *process) error {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.startTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	stopCtx := c.ctx
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if c.statusReady(ctx) {
+			c.mu.Lock()
+			c.viaStatus = true
+			c.mu.Unlock()
+			return nil
+		}
+
+		select {
+		case <-p.ready:
+			return nil
+		case <-p.done:
+			return errors.New(c.Name(), fmt.Errorf("terminated without becoming healthy: %v", p.err))
+		case <-stopCtx.Done():
+			p.kill()
+			<-p.done
+			return errors.New(c.Name(), "was stopped while starting")
+		case <-ctx.Done():
+			p.kill()
+			<-p.done
+			return errors.New(c.Name(), fmt.Errorf("did not become healthy within %v", c.opts.startTimeout))
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusReady returns true if the Sauce Connect status server reports that the tunnel is ready.
+// It returns false if the status server is not enabled.
+func (c *Connect) statusReady(ctx context.Context) bool {
+	if c.statusURL == "" {
+		return false
+	}
+	req, err := http.NewRequest(http.MethodGet, c.statusURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// supervise restarts Sauce Connect whenever it exits until Stop is called, waiting
+// opts.restartBackoff before the first restart and doubling the wait for each further restart. If
+// a run stays up for c.stableRun after becoming ready, the backoff and restart count are reset. If
+// Sauce Connect has to be restarted more than opts.maxRestarts times in a row it is left stopped
+// and Healthy reports a permanent error.
+func (c *Connect) supervise(p *process) {
+	c.mu.Lock()
+	stopCtx := c.ctx
+	c.mu.Unlock()
+
+	backoff := c.opts.restartBackoff
+	readyAt := time.Now()
+	for restarts := 0; ; restarts++ {
+		select {
+		case <-stopCtx.Done():
+			return
+		case <-p.done:
+		}
+
+		if !readyAt.IsZero() && time.Since(readyAt) >= c.stableRun {
+			restarts = 0
+			backoff = c.opts.restartBackoff
+		}
+
+		if restarts >= c.opts.maxRestarts {
+			err := errors.NewPermanent(c.Name(), fmt.Errorf("tunnel exited with %v; giving up after %d restarts", p.err, restarts))
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			c.Severe(err)
+			return
+		}
+		c.Warning(errors.New(c.Name(), fmt.Errorf("tunnel exited with %v; restarting in %v (restart %d of %d)", p.err, backoff, restarts+1, c.opts.maxRestarts)))
+
+		select {
+		case <-stopCtx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		var err error
+		p, err = c.launch(stopCtx)
+		readyAt = time.Now()
+		if err != nil {
+			readyAt = time.Time{}
+			c.Warning(err)
+		}
+	}
+}
+
+// watch scans the output of p for the ready marker and waits for p to exit.
+func (p *process) watch(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	ready := false
+	for scanner.Scan() {
+		if !ready && strings.Contains(scanner.Text(), readyMarker) {
+			ready = true
+			close(p.ready)
+		}
+	}
+	// Drain anything the scanner could not handle so that the process never blocks on stdout.
+	io.Copy(ioutil.Discard, stdout)
+	p.err = p.cmd.Wait()
+	close(p.done)
+}
+
+func (p *process) kill() {
+	if p.cmd != nil && p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+// exited returns a process that failed to start with err.
+func exited(err error) *process {
+	p := &process{
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+		err:   err,
+	}
+	close(p.done)
+	return p
 }
 
 // Name is the name of this component used in error and log messages.
@@ -0,0 +1,229 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sauce
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/errors"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
+)
+
+// fakeModeEnvVar selects the behavior of the test binary when it is run as a fake Sauce Connect.
+const fakeModeEnvVar = "FAKE_SAUCE_CONNECT"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(fakeModeEnvVar); mode != "" {
+		fakeConnect(mode, os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// fakeConnect behaves like Sauce Connect according to mode:
+//
+//	marker       logs the ready marker and runs until killed.
+//	status       serves a ready status endpoint and runs until killed.
+//	silent       never becomes ready.
+//	crash        logs the ready marker and exits shortly afterwards.
+//	crash-first  behaves like crash on its first run, and like marker otherwise.
+func fakeConnect(mode string, args []string) {
+	flags := map[string]string{}
+	for i := 0; i+1 < len(args); i += 2 {
+		flags[args[i]] = args[i+1]
+	}
+	logFile := flags["--logfile"]
+	ioutil.WriteFile(logFile, []byte("fake Sauce Connect "+mode+" for "+flags["--tunnel-identifier"]+"\n"), 0644)
+
+	if mode == "crash-first" {
+		mode = "marker"
+		if strings.HasSuffix(logFile, "-0.log") {
+			mode = "crash"
+		}
+	}
+
+	switch mode {
+	case "marker":
+		fmt.Println(readyMarker)
+	case "status":
+		http.HandleFunc("/readiness", func(w http.ResponseWriter, _ *http.Request) {})
+		go http.ListenAndServe(flags["--status-address"], nil)
+	case "crash":
+		fmt.Println(readyMarker)
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(1)
+	}
+	select {}
+}
+
+func newFakeConnect(t *testing.T, mode string, opts options) (*Connect, *diagnostics.Recorder) {
+	t.Helper()
+	t.Setenv(fakeModeEnvVar, mode)
+	if opts.startTimeout == 0 {
+		opts.startTimeout = 10 * time.Second
+	}
+	opts.logDir = t.TempDir()
+
+	d := diagnostics.NewRecorder()
+	c, err := newConnect(d, os.Args[0], opts, "user", "key", "tunnel-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop(context.Background()) })
+	return c, d
+}
+
+// waitFor waits until cond returns true.
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartWithLogMarker(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newFakeConnect(t, "marker", options{})
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Healthy(ctx); err != nil {
+		t.Errorf("got Healthy error %v, want nil", err)
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(c.opts.logDir, "sauce-connect-0.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "tunnel-1") {
+		t.Errorf("got log %q, want it to contain the tunnel ID", log)
+	}
+
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Healthy(ctx); err == nil || !errors.IsPermanent(err) {
+		t.Errorf("got Healthy error %v after Stop, want permanent error", err)
+	}
+}
+
+func TestStartWithStatusEndpoint(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newFakeConnect(t, "status", options{statusServer: true})
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !c.viaStatus {
+		t.Error("got readiness from log marker, want status endpoint")
+	}
+	if err := c.Healthy(ctx); err != nil {
+		t.Errorf("got Healthy error %v, want nil", err)
+	}
+}
+
+func TestStatusServerDisabledByDefault(t *testing.T) {
+	c, _ := newFakeConnect(t, "status", options{startTimeout: 300 * time.Millisecond})
+
+	for _, arg := range c.args {
+		if arg == "--status-address" {
+			t.Fatalf("got args %v, want no --status-address unless statusServer is true", c.args)
+		}
+	}
+	if err := c.Start(context.Background()); err == nil {
+		t.Error("got nil error from Start, want timeout waiting for the log marker")
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	c, _ := newFakeConnect(t, "silent", options{startTimeout: 300 * time.Millisecond})
+
+	if err := c.Start(context.Background()); err == nil {
+		t.Fatal("got nil error from Start, want timeout error")
+	}
+	if err := c.Healthy(context.Background()); err == nil {
+		t.Error("got nil Healthy error after failed Start, want error")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	ctx := context.Background()
+	c, d := newFakeConnect(t, "crash-first", options{maxRestarts: 3, restartBackoff: 500 * time.Millisecond})
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "Healthy to notice the tunnel is gone", func() bool { return c.Healthy(ctx) != nil })
+	if err := c.Healthy(ctx); errors.IsPermanent(err) {
+		t.Errorf("got permanent Healthy error %v while restarting, want temporary error", err)
+	}
+
+	waitFor(t, "the tunnel to be restarted", func() bool { return c.Healthy(ctx) == nil })
+
+	if warnings := len(d.Warnings()); warnings != 1 {
+		t.Errorf("got %d warnings, want 1 for the restart", warnings)
+	}
+	for _, f := range []string{"sauce-connect-0.log", "sauce-connect-1.log"} {
+		if _, err := os.Stat(filepath.Join(c.opts.logDir, f)); err != nil {
+			t.Errorf("log of each run should be kept: %v", err)
+		}
+	}
+}
+
+func TestGiveUpAfterMaxRestarts(t *testing.T) {
+	ctx := context.Background()
+	c, d := newFakeConnect(t, "crash", options{maxRestarts: 2, restartBackoff: 10 * time.Millisecond})
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "Connect to give up", func() bool { return errors.IsPermanent(c.Healthy(ctx)) })
+
+	if warnings, severe := d.Warnings(), d.SevereErrors(); len(warnings) != 2 || len(severe) != 1 {
+		t.Errorf("got warnings %v and severe errors %v, want 2 warnings and 1 severe error", warnings, severe)
+	}
+}
+
+func TestRestartCountResetAfterStableRun(t *testing.T) {
+	ctx := context.Background()
+	c, d := newFakeConnect(t, "crash", options{maxRestarts: 1, restartBackoff: 10 * time.Millisecond})
+	c.stableRun = 50 * time.Millisecond
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each run stays up for longer than stableRun, so Connect never gives up.
+	waitFor(t, "several restarts", func() bool { return len(d.Warnings()) >= 3 })
+
+	if severe := d.SevereErrors(); len(severe) != 0 {
+		t.Errorf("got severe errors %v, want none while each run stays up", severe)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sauce
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bazelbuild/rules_webtesting/go/metadata"
+)
+
+// options is the set of options that can be defined in the connect section of the sauceOptions
+// section of a Metadata.Extension field.
+type options struct {
+	// How long to wait for Sauce Connect to become ready. Defaults to 2 minutes.
+	startTimeout time.Duration
+	// How many times Sauce Connect is restarted if it exits before it is stopped. Defaults to 3.
+	maxRestarts int
+	// How long to wait before the first restart. Doubled for each further restart. Defaults to 1s.
+	restartBackoff time.Duration
+	// The directory that Sauce Connect logs are written to. Defaults to the test outputs directory.
+	logDir string
+	// Whether to start the Sauce Connect status server and use it to check that the tunnel is ready.
+	// Requires a Sauce Connect that supports --status-address. Defaults to false.
+	statusServer bool
+}
+
+func extractOptions(m *metadata.Metadata) (options, error) {
+	opts := options{
+		startTimeout:   2 * time.Minute,
+		maxRestarts:    3,
+		restartBackoff: time.Second,
+	}
+
+	extMap, ok := m.ExtensionMap()
+	if !ok {
+		return opts, nil
+	}
+	soMap, ok := extMap["sauceOptions"].(map[string]interface{})
+	if !ok {
+		return opts, nil
+	}
+	c, ok := soMap["connect"]
+	if !ok {
+		return opts, nil
+	}
+	cMap, ok := c.(map[string]interface{})
+	if !ok {
+		return opts, fmt.Errorf("sauceOptions.connect %#v is not an object", c)
+	}
+
+	if st, ok := cMap["startTimeout"]; ok {
+		d, err := metadata.Duration(st)
+		if err != nil {
+			return opts, fmt.Errorf("sauceOptions.connect.startTimeout: %v", err)
+		}
+		opts.startTimeout = d
+	}
+
+	if mr, ok := cMap["maxRestarts"]; ok {
+		mrf, ok := mr.(float64)
+		if !ok || mrf < 0 {
+			return opts, fmt.Errorf("sauceOptions.connect.maxRestarts %#v is not a non-negative number", mr)
+		}
+		opts.maxRestarts = int(mrf)
+	}
+
+	if rb, ok := cMap["restartBackoff"]; ok {
+		d, err := metadata.Duration(rb)
+		if err != nil {
+			return opts, fmt.Errorf("sauceOptions.connect.restartBackoff: %v", err)
+		}
+		opts.restartBackoff = d
+	}
+
+	if ld, ok := cMap["logDir"]; ok {
+		lds, ok := ld.(string)
+		if !ok {
+			return opts, fmt.Errorf("sauceOptions.connect.logDir %#v is not a string", ld)
+		}
+		opts.logDir = lds
+	}
+
+	if ss, ok := cMap["statusServer"]; ok {
+		ssb, ok := ss.(bool)
+		if !ok {
+			return opts, fmt.Errorf("sauceOptions.connect.statusServer %#v is not a boolean", ss)
+		}
+		opts.statusServer = ssb
+	}
+
+	return opts, nil
+}
@@ -34,14 +34,26 @@ import (
 	"github.com/bazelbuild/rules_webtesting/go/wtl/diagnostics"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/environment"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/external"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/grid"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/local"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/multibrowser"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/replay"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/environment/sauce"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/netproxy"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/debuggerui"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/autowait"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/commandpolicy"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/drivermu"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/faultinjection"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/jwptranslator"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/networkmock"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/quithandler"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/driverhub/scripttimeout"
 	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/healthz"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/metricshandler"
+	"github.com/bazelbuild/rules_webtesting/go/wtl/proxy/statusz"
 )
 
 type envProvider func(m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error)
@@ -51,19 +63,38 @@ var envProviders = map[string]envProvider{}
 func init() {
 	// Configure Environments.
 	RegisterEnvProviderFunc("external", external.NewEnv)
+	RegisterEnvProviderFunc("grid", grid.NewEnv)
 	RegisterEnvProviderFunc("local", local.NewEnv)
+	RegisterEnvProviderFunc("replay", replay.NewEnv)
 	RegisterEnvProviderFunc("sauce", sauce.NewEnv)
+	driverhub.CapabilityFunc(multibrowser.Capability)
 
 	// Configure HTTP Handlers
 	proxy.AddHTTPHandlerProvider("/wd/hub/", driverhub.HTTPHandlerProvider)
 	proxy.AddHTTPHandlerProvider("/healthz", healthz.HTTPHandlerProvider)
+	proxy.AddHTTPHandlerProvider("/metrics", metricshandler.HTTPHandlerProvider)
+	proxy.AddHTTPHandlerProvider("/statusz", statusz.HTTPHandlerProvider)
+	proxy.AddHTTPHandlerProvider("/debugger/", debuggerui.HTTPHandlerProvider)
 
 	// Configure WebDriver handlers.
-	driverhub.HandlerProviderFunc(quithandler.ProviderFunc)
-	driverhub.HandlerProviderFunc(scripttimeout.ProviderFunc)
+	// Handlers that only inspect some commands are added as streaming handlers, so that other
+	// commands, such as screenshots, are streamed rather than buffered.
+	// jwptranslator should always be first so that other handlers see commands as the client sent them.
+	driverhub.HandlerProviderFunc(jwptranslator.ProviderFunc)
+	driverhub.StreamingHandlerProviderFunc(quithandler.ProviderFunc, nil)
+	driverhub.StreamingHandlerProviderFunc(scripttimeout.ProviderFunc, scripttimeout.NeedsBody)
+	driverhub.StreamingHandlerProviderFunc(autowait.ProviderFunc, autowait.NeedsBody)
+	driverhub.ValidatorFunc(autowait.Validate)
+	driverhub.CapabilityFunc(autowait.Capability)
+	driverhub.HandlerProviderFunc(commandpolicy.ProviderFunc)
+	driverhub.ValidatorFunc(commandpolicy.Validate)
+	driverhub.StreamingHandlerProviderFunc(networkmock.ProviderFunc, networkmock.NeedsBody)
+	driverhub.HandlerProviderFunc(faultinjection.ProviderFunc)
+	driverhub.ValidatorFunc(faultinjection.Validate)
+	driverhub.CapabilityFunc(faultinjection.Capability)
 
 	// drivermu should always be last.
-	driverhub.HandlerProviderFunc(drivermu.ProviderFunc)
+	driverhub.StreamingHandlerProviderFunc(drivermu.ProviderFunc, nil)
 }
 
 // RegisterEnvProviderFunc adds a new env provider.
@@ -167,6 +198,9 @@ func Run(d diagnostics.Diagnostics, testPath, mdPath string, httpPort, httpsPort
 		envStarted <- env.SetUp(ctx)
 	}()
 
+	// The exit status of the test, or -1 if it has not finished.
+	testStatus := -1
+
 	shutdownFunc := func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -174,9 +208,16 @@ func Run(d diagnostics.Diagnostics, testPath, mdPath string, httpPort, httpsPort
 		go func() {
 			var errors []error
 
-			if err := p.Shutdown(ctx); err != nil {
+			// The proxy drains in-flight commands and quits sessions within its share of the budget,
+			// leaving the rest for tearing down the environment.
+			proxyCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+			if err := p.Shutdown(proxyCtx); err != nil {
 				errors = append(errors, err)
 			}
+			cancel()
+			if testStatus >= 0 {
+				environment.NotifyTestFinished(ctx, env, testStatus)
+			}
 			if err := env.TearDown(ctx); err != nil {
 				errors = append(errors, err)
 			}
@@ -228,7 +269,7 @@ func Run(d diagnostics.Diagnostics, testPath, mdPath string, httpPort, httpsPort
 	go func() {
 		if status := testCmd.Run(); status != nil {
 			log.Printf("test failed %v", status)
-			if ee, ok := err.(*exec.ExitError); ok {
+			if ee, ok := status.(*exec.ExitError); ok {
 				if ws, ok := ee.Sys().(syscall.WaitStatus); ok {
 					testFinished <- ws.ExitStatus()
 					return
@@ -251,15 +292,44 @@ func Run(d diagnostics.Diagnostics, testPath, mdPath string, httpPort, httpsPort
 			}
 			defer shutdownFunc()
 		case status := <-testFinished:
+			testStatus = status
 			return status
 		}
 	}
 }
 
 func buildEnv(m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error) {
+	browsers, err := multibrowser.Browsers(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(browsers) == 0 {
+		return buildBrowserEnv(m, d)
+	}
+
+	browsers = append([]*multibrowser.Browser{{Name: multibrowser.DefaultBrowser, Metadata: m}}, browsers...)
+	for _, b := range browsers {
+		env, err := buildBrowserEnv(b.Metadata, d)
+		if err != nil {
+			return nil, fmt.Errorf("browser %s: %v", b.Name, err)
+		}
+		b.Env = env
+	}
+	return multibrowser.NewEnv(browsers, d)
+}
+
+func buildBrowserEnv(m *metadata.Metadata, d diagnostics.Diagnostics) (environment.Env, error) {
 	p, ok := envProviders[m.Environment]
 	if !ok {
 		return nil, fmt.Errorf("unknown environment: %s", m.Environment)
 	}
-	return p(m, d)
+	env, err := p(m, d)
+	if err != nil {
+		return nil, err
+	}
+	env, err = replay.RecordIfEnabled(env, m, d)
+	if err != nil {
+		return nil, err
+	}
+	return netproxy.WrapIfEnabled(env, m, d)
 }
@@ -21,6 +21,9 @@ DEFAULT_WEB_TEST_SUITE_TAGS = {
     "chrome-external": [
         "external",
     ],
+    "chrome-grid": [
+        "grid",
+    ],
     "chromium-local": [
         "native",
     ],
@@ -39,6 +42,9 @@ DEFAULT_WEB_TEST_SUITE_TAGS = {
     "firefox-external": [
         "external",
     ],
+    "firefox-grid": [
+        "grid",
+    ],
     "firefox-local": [
         "native",
     ],
@@ -16,6 +16,7 @@
 from __future__ import absolute_import
 from __future__ import division
 from __future__ import print_function
+import base64
 import code
 import getpass
 import hashlib
@@ -58,7 +59,8 @@ class Debugger:
     while True:
       n = self._read_next()
       print(n)
-      if n["status"] != "running":
+      # connected, role, and log messages are sent independently of commands.
+      if n["status"] not in ("running", "connected", "role", "log"):
         return
 
   def step(self):
@@ -82,7 +84,84 @@ class Debugger:
     self._file.flush()
     quit()
 
-  def set_breakpoint(self, path=None, methods=None, body=None):
+  def _inspect(self, cmd, session=None, **kwargs):
+    """Run an inspection command on a session while paused and return its result."""
+    id = self._get_next_id()
+    obj = {"id": id, "command": cmd}
+    if session:
+      obj["session"] = session
+    obj.update(kwargs)
+    json.dump(obj=obj, fp=self._file)
+    self._file.flush()
+    while True:
+      n = self._read_next()
+      if n.get("id") != id:
+        print(n)
+        continue
+      if n["status"] == "error":
+        print(n["error"])
+        return None
+      return n.get("result")
+
+  def screenshot(self, path, session=None):
+    """Save a PNG screenshot of the paused session to path."""
+    result = self._inspect("screenshot", session)
+    if result is not None:
+      with open(path, "wb") as f:
+        f.write(base64.b64decode(result))
+
+  def page_source(self, session=None):
+    """Return the page source of the paused session."""
+    return self._inspect("page source", session)
+
+  def current_url(self, session=None):
+    """Return the current URL of the paused session."""
+    return self._inspect("current url", session)
+
+  def find_elements(self, using, value, session=None):
+    """Return references to the elements matching a locator in the paused session.
+
+    Args:
+      using: string, the locator strategy ("css selector", "xpath", etc).
+      value: string, the selector.
+      session: string, the session to inspect. Defaults to the paused one.
+    """
+    return self._inspect("find elements", session, using=using, value=value)
+
+  def execute_script(self, script, *args, **kwargs):
+    """Execute script with args in the paused session and return its value.
+
+    Pass session= to run in a session other than the paused one.
+    """
+    return self._inspect(
+        "execute script", kwargs.get("session"), script=script, args=list(args))
+
+  def take_control(self):
+    """Become the controlling debugger front end.
+
+    Only the controlling front end may step, continue, stop, or change
+    breakpoints; other front ends observe.
+    """
+    id = self._get_next_id()
+    json.dump(obj={"id": id, "command": "take control"}, fp=self._file)
+    self._file.flush()
+    self._read_until_waiting()
+
+  def detach(self):
+    """Give up control and let the test run without pausing."""
+    id = self._get_next_id()
+    json.dump(obj={"id": id, "command": "detach"}, fp=self._file)
+    self._file.flush()
+    self._read_next()
+
+  def set_breakpoint(self,
+                     path=None,
+                     methods=None,
+                     body=None,
+                     session=None,
+                     hit_count=None,
+                     once=False,
+                     log=None):
     """Set a WTL breakpoint.
 
     Args:
@@ -90,6 +169,13 @@ class Debugger:
       methods: list of strings, a list of HTTP methods ("POST", "GET", etc).
       body: string, Go regular expression to compare to body of WebDriver
         command.
+      session: string, only match commands for the session with this ID.
+      hit_count: int, only trigger once the breakpoint has matched at least
+        this many times.
+      once: bool, delete the breakpoint the first time it triggers.
+      log: string, log this message instead of pausing. {method}, {path},
+        {session}, {body}, {status}, and {hits} are replaced with the values
+        for the matching command.
 
     Returns:
       int, id of the breakpoint (can be used in delete_breakpoint command).
@@ -103,6 +189,14 @@ class Debugger:
       bp["methods"] = methods
     if body:
       bp["body"] = body
+    if session:
+      bp["session"] = session
+    if hit_count:
+      bp["hitCount"] = hit_count
+    if once:
+      bp["once"] = True
+    if log:
+      bp["log"] = log
 
     json.dump(
         obj={
@@ -136,6 +230,25 @@ class Debugger:
     self._read_until_waiting()
 
 
+  def list_breakpoints(self):
+    """List the WTL breakpoints, including those set by other front ends.
+
+    Returns:
+      list of dicts, the breakpoints ordered by id, with their hit counts.
+    """
+    id = self._get_next_id()
+
+    json.dump(obj={"id": id, "command": "list breakpoints"}, fp=self._file)
+    self._file.flush()
+    while True:
+      n = self._read_next()
+      if n["status"] == "breakpoints":
+        return n["breakpoints"]
+      print(n)
+      if n["status"] == "error":
+        return []
+
+
 def collect_analytics():
   try:
     urllib.request.urlopen(